@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -60,6 +61,13 @@ func TestClients(t *testing.T) {
 				json.NewEncoder(w).Encode(body)
 			},
 		},
+		{
+			Path: "/api/v4/internal/skewed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+				fmt.Fprint(w, "Hello")
+			},
+		},
 		{
 			Path: "/api/v4/internal/broken",
 			Handler: func(w http.ResponseWriter, r *http.Request) {
@@ -106,6 +114,7 @@ func TestClients(t *testing.T) {
 			testMissing(t, client)
 			testErrorMessage(t, client)
 			testAuthenticationHeader(t, client)
+			testClockDriftWarning(t, client)
 		})
 	}
 }
@@ -133,6 +142,23 @@ func testSuccessfulGet(t *testing.T, client *GitlabNetClient) {
 	})
 }
 
+func testClockDriftWarning(t *testing.T, client *GitlabNetClient) {
+	t.Run("Clock drift warning", func(t *testing.T) {
+		hook := testhelper.SetupLogger()
+		response, err := client.Get("/skewed")
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		require.True(t, testhelper.WaitForLogEvent(hook))
+		entries := hook.AllEntries()
+		require.Equal(t, 2, len(entries))
+		assert.Contains(t, entries[0].Message, "level=warning")
+		assert.Contains(t, entries[0].Message, "clock_drift_s=3600")
+		assert.Contains(t, entries[0].Message, "Local clock differs from the internal API clock")
+		assert.Contains(t, entries[1].Message, "Finished HTTP request")
+	})
+}
+
 func testSuccessfulPost(t *testing.T, client *GitlabNetClient) {
 	t.Run("Successful Post", func(t *testing.T) {
 		hook := testhelper.SetupLogger()
@@ -202,6 +228,12 @@ func testErrorMessage(t *testing.T, client *GitlabNetClient) {
 		assert.EqualError(t, err, "Don't do that")
 		assert.Nil(t, response)
 	})
+
+	t.Run("Error with status code", func(t *testing.T) {
+		_, err := client.Get("/error")
+		require.IsType(t, &ApiError{}, err)
+		assert.Equal(t, http.StatusBadRequest, err.(*ApiError).StatusCode)
+	})
 }
 
 func testBrokenRequest(t *testing.T, client *GitlabNetClient) {
@@ -269,3 +301,54 @@ func testAuthenticationHeader(t *testing.T, client *GitlabNetClient) {
 		assert.Equal(t, "sssh, it's a secret", string(header))
 	})
 }
+
+func TestClockDrift(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(200 * time.Millisecond)
+
+	testCases := []struct {
+		desc          string
+		date          string
+		expectedDrift time.Duration
+		expectedOk    bool
+	}{
+		{
+			desc:          "In sync",
+			date:          "Wed, 01 Jan 2020 12:00:00 GMT",
+			expectedDrift: 0,
+			expectedOk:    true,
+		},
+		{
+			desc:          "Local clock ahead",
+			date:          "Wed, 01 Jan 2020 11:59:15 GMT",
+			expectedDrift: 45 * time.Second,
+			expectedOk:    true,
+		},
+		{
+			desc:          "Local clock behind",
+			date:          "Wed, 01 Jan 2020 12:01:00 GMT",
+			expectedDrift: -60 * time.Second,
+			expectedOk:    true,
+		},
+		{
+			desc: "Without a Date header",
+		},
+		{
+			desc: "With an invalid Date header",
+			date: "yesterday",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			response := &http.Response{Header: http.Header{}}
+			if tc.date != "" {
+				response.Header.Set("Date", tc.date)
+			}
+
+			drift, ok := ClockDrift(response, start, end)
+			require.Equal(t, tc.expectedOk, ok)
+			require.Equal(t, tc.expectedDrift, drift)
+		})
+	}
+}
@@ -16,12 +16,26 @@ import (
 const (
 	internalApiPath  = "/api/v4/internal"
 	secretHeaderName = "Gitlab-Shared-Secret"
+
+	// Gitaly rejects tokens whose timestamp is more than 30 seconds off, so
+	// drift is reported well before it breaks git operations.
+	ClockDriftThreshold = 10 * time.Second
 )
 
 type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
+// ApiError is returned when the internal API responds with an error status
+type ApiError struct {
+	Msg        string
+	StatusCode int
+}
+
+func (e *ApiError) Error() string {
+	return e.Msg
+}
+
 type GitlabNetClient struct {
 	httpClient             *HttpClient
 	user, password, secret string
@@ -84,9 +98,9 @@ func parseError(resp *http.Response) error {
 	parsedResponse := &ErrorResponse{}
 
 	if err := json.NewDecoder(resp.Body).Decode(parsedResponse); err != nil {
-		return fmt.Errorf("Internal API error (%v)", resp.StatusCode)
+		return &ApiError{Msg: fmt.Sprintf("Internal API error (%v)", resp.StatusCode), StatusCode: resp.StatusCode}
 	} else {
-		return fmt.Errorf(parsedResponse.Message)
+		return &ApiError{Msg: parsedResponse.Message, StatusCode: resp.StatusCode}
 	}
 
 }
@@ -118,10 +132,11 @@ func (c *GitlabNetClient) DoRequest(method, path string, data interface{}) (*htt
 
 	start := time.Now()
 	response, err := c.httpClient.Do(request)
+	end := time.Now()
 	fields := log.Fields{
 		"method":      method,
 		"url":         request.URL.String(),
-		"duration_ms": time.Since(start) / time.Millisecond,
+		"duration_ms": end.Sub(start) / time.Millisecond,
 	}
 	logger := log.WithFields(fields)
 
@@ -132,6 +147,10 @@ func (c *GitlabNetClient) DoRequest(method, path string, data interface{}) (*htt
 
 	if response != nil {
 		logger = logger.WithField("status", response.StatusCode)
+
+		if drift, ok := ClockDrift(response, start, end); ok && absDuration(drift) > ClockDriftThreshold {
+			logger.WithField("clock_drift_s", drift.Seconds()).Warn("Local clock differs from the internal API clock")
+		}
 	}
 	if err := parseError(response); err != nil {
 		logger.WithError(err).Error("Internal API error")
@@ -142,3 +161,27 @@ func (c *GitlabNetClient) DoRequest(method, path string, data interface{}) (*htt
 
 	return response, nil
 }
+
+// ClockDrift estimates how far the local clock is ahead of the clock of the
+// server that sent the response, using the Date header and the local time
+// halfway through the request. The Date header only has a resolution of one
+// second, so neither has the estimate.
+func ClockDrift(response *http.Response, start, end time.Time) (time.Duration, bool) {
+	date, err := http.ParseTime(response.Header.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+
+	local := start.Add(end.Sub(start) / 2)
+	drift := local.Sub(date) - 500*time.Millisecond
+
+	return drift.Round(time.Second), true
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+
+	return d
+}
@@ -14,9 +14,18 @@ import (
 	"google.golang.org/grpc/metadata"
 )
 
-type TestGitalyServer struct{ ReceivedMD metadata.MD }
+type TestGitalyServer struct {
+	ReceivedMD metadata.MD
+
+	// Err is returned by every call when set
+	Err error
+}
 
 func (s *TestGitalyServer) SSHReceivePack(stream pb.SSHService_SSHReceivePackServer) error {
+	if s.Err != nil {
+		return s.Err
+	}
+
 	req, err := stream.Recv()
 	if err != nil {
 		return err
@@ -31,6 +40,10 @@ func (s *TestGitalyServer) SSHReceivePack(stream pb.SSHService_SSHReceivePackSer
 }
 
 func (s *TestGitalyServer) SSHUploadPack(stream pb.SSHService_SSHUploadPackServer) error {
+	if s.Err != nil {
+		return s.Err
+	}
+
 	req, err := stream.Recv()
 	if err != nil {
 		return err
@@ -45,6 +58,10 @@ func (s *TestGitalyServer) SSHUploadPack(stream pb.SSHService_SSHUploadPackServe
 }
 
 func (s *TestGitalyServer) SSHUploadArchive(stream pb.SSHService_SSHUploadArchiveServer) error {
+	if s.Err != nil {
+		return s.Err
+	}
+
 	req, err := stream.Recv()
 	if err != nil {
 		return err
@@ -59,6 +76,17 @@ func (s *TestGitalyServer) SSHUploadArchive(stream pb.SSHService_SSHUploadArchiv
 }
 
 func StartGitalyServer(t *testing.T) (string, *TestGitalyServer, func()) {
+	return startGitalyServer(t, &TestGitalyServer{})
+}
+
+// StartFailingGitalyServer starts a server failing every call with err
+func StartFailingGitalyServer(t *testing.T, err error) (string, func()) {
+	address, _, cleanup := startGitalyServer(t, &TestGitalyServer{Err: err})
+
+	return address, cleanup
+}
+
+func startGitalyServer(t *testing.T, testServer *TestGitalyServer) (string, *TestGitalyServer, func()) {
 	tempDir, _ := ioutil.TempDir("", "gitlab-shell-test-api")
 	gitalySocketPath := path.Join(tempDir, "gitaly.sock")
 
@@ -70,8 +98,7 @@ func StartGitalyServer(t *testing.T) (string, *TestGitalyServer, func()) {
 	listener, err := net.Listen("unix", gitalySocketPath)
 	require.NoError(t, err)
 
-	testServer := TestGitalyServer{}
-	pb.RegisterSSHServiceServer(server, &testServer)
+	pb.RegisterSSHServiceServer(server, testServer)
 
 	go server.Serve(listener)
 
@@ -81,5 +108,5 @@ func StartGitalyServer(t *testing.T) (string, *TestGitalyServer, func()) {
 		os.RemoveAll(tempDir)
 	}
 
-	return gitalySocketUrl, &testServer, cleanup
+	return gitalySocketUrl, testServer, cleanup
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/executable"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/logger"
+)
+
+func main() {
+	readWriter := &readwriter.ReadWriter{
+		Out:    os.Stdout,
+		In:     os.Stdin,
+		ErrOut: os.Stderr,
+	}
+
+	executable, err := executable.New(executable.LogPseudonyms)
+	if err != nil {
+		fmt.Fprintln(readWriter.ErrOut, "Failed to determine executable, exiting")
+		os.Exit(1)
+	}
+
+	config, err := config.NewFromDir(executable.RootDir)
+	if err != nil {
+		fmt.Fprintln(readWriter.ErrOut, "Failed to read config, exiting")
+		os.Exit(1)
+	}
+
+	logger.Configure(config)
+
+	cmd, err := command.New(executable, os.Args[1:], config, readWriter)
+	if err != nil {
+		fmt.Fprintf(readWriter.ErrOut, "%v\n", err)
+		os.Exit(1)
+	}
+
+	if err = cmd.Execute(); err != nil {
+		fmt.Fprintf(readWriter.ErrOut, "%v\n", err)
+		os.Exit(1)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"gitlab.com/gitlab-org/gitlab-shell/internal/background"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
@@ -42,7 +43,17 @@ func main() {
 	}
 
 	if err = cmd.Execute(); err != nil {
-		console.DisplayWarningMessage(err.Error(), readWriter.ErrOut)
-		os.Exit(1)
+		exitCode := 1
+		if exitCoder, ok := err.(command.ExitCoder); ok {
+			// The command already told the user what went wrong
+			exitCode = exitCoder.ExitCode()
+		} else {
+			console.DisplayWarningMessage(err.Error(), readWriter.ErrOut)
+		}
+
+		background.Wait(config.BackgroundBudget())
+		os.Exit(exitCode)
 	}
+
+	background.Wait(config.BackgroundBudget())
 }
@@ -0,0 +1,43 @@
+package background
+
+// Work that shouldn't delay the user, such as notifications, runs in the
+// background while the command executes. The process waits for it before
+// exiting, but only up to a time budget so a slow API can't hold sessions
+// open.
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	tasks sync.WaitGroup
+)
+
+// Go runs fn in the background
+func Go(fn func()) {
+	tasks.Add(1)
+
+	go func() {
+		defer tasks.Done()
+		fn()
+	}()
+}
+
+// Wait blocks until all background work finished or budget has passed. It
+// returns false when work is abandoned.
+func Wait(budget time.Duration) bool {
+	done := make(chan struct{})
+
+	go func() {
+		tasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(budget):
+		return false
+	}
+}
@@ -0,0 +1,32 @@
+package background
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWait(t *testing.T) {
+	var finished int32
+
+	for i := 0; i < 3; i++ {
+		Go(func() {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&finished, 1)
+		})
+	}
+
+	require.True(t, Wait(time.Second))
+	require.Equal(t, int32(3), atomic.LoadInt32(&finished))
+}
+
+func TestWaitBudget(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	Go(func() { <-release })
+
+	require.False(t, Wait(10*time.Millisecond))
+}
@@ -0,0 +1,228 @@
+package accessgrant
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/accessgrant"
+)
+
+const (
+	listAction   = "list"
+	revokeAction = "revoke"
+
+	defaultRole = "developer"
+	timeFormat  = "2006-01-02 15:04:05 MST"
+
+	usage = "Usage:\n" +
+		"  grant <username> <project> --ttl <duration> [--role guest|reporter|developer|maintainer]\n" +
+		"  grant list <project>\n" +
+		"  grant revoke <username> <project>"
+)
+
+var (
+	roles = []string{"guest", "reporter", "developer", "maintainer"}
+
+	// now is overridden in tests
+	now = time.Now
+)
+
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.Shell
+	ReadWriter *readwriter.ReadWriter
+}
+
+type grantOptions struct {
+	grantee string
+	project string
+	role    string
+	ttl     time.Duration
+}
+
+func (c *Command) Execute() error {
+	args := c.Args.SshArgs[1:]
+
+	if len(args) > 0 {
+		switch args[0] {
+		case listAction:
+			return c.list(args[1:])
+		case revokeAction:
+			return c.revoke(args[1:])
+		}
+	}
+
+	return c.grant(args)
+}
+
+func (c *Command) grant(args []string) error {
+	options, err := parseGrantOptions(args)
+	if err != nil {
+		return err
+	}
+
+	client, err := accessgrant.NewClient(c.Config)
+	if err != nil {
+		return err
+	}
+
+	grant, err := client.Create(c.Args, options.grantee, options.project, options.role, options.ttl)
+	if err != nil {
+		c.logGrant(options.grantee, options.project, options.role).WithError(err).Warn("Failed to grant temporary access")
+		return err
+	}
+
+	c.logGrant(grant.Username, grant.Project, grant.Role).WithField("expires_at", grant.ExpiresAt).Info("Granted temporary access")
+
+	fmt.Fprintf(c.ReadWriter.Out, "Granted @%s %s access to %s.\n", grant.Username, grant.Role, grant.Project)
+	fmt.Fprintf(c.ReadWriter.Out, "Access expires at %s (in %s).\n", formatTime(grant.ExpiresAt), formatRemaining(grant.ExpiresAt))
+
+	return nil
+}
+
+func (c *Command) revoke(args []string) error {
+	if len(args) != 2 {
+		return usageError("Wrong number of arguments")
+	}
+
+	grantee, project := parseUsername(args[0]), args[1]
+
+	client, err := accessgrant.NewClient(c.Config)
+	if err != nil {
+		return err
+	}
+
+	grant, err := client.Revoke(c.Args, grantee, project)
+	if err != nil {
+		c.logGrant(grantee, project, "").WithError(err).Warn("Failed to revoke temporary access")
+		return err
+	}
+
+	c.logGrant(grant.Username, grant.Project, grant.Role).Info("Revoked temporary access")
+
+	fmt.Fprintf(c.ReadWriter.Out, "Revoked temporary %s access of @%s to %s.\n", grant.Role, grant.Username, grant.Project)
+
+	return nil
+}
+
+func (c *Command) list(args []string) error {
+	if len(args) != 1 {
+		return usageError("Wrong number of arguments")
+	}
+
+	project := args[0]
+
+	client, err := accessgrant.NewClient(c.Config)
+	if err != nil {
+		return err
+	}
+
+	grants, err := client.List(c.Args, project)
+	if err != nil {
+		return err
+	}
+
+	if len(grants) == 0 {
+		fmt.Fprintf(c.ReadWriter.Out, "There are no temporary access grants for %s.\n", project)
+		return nil
+	}
+
+	fmt.Fprintf(c.ReadWriter.Out, "Temporary access grants for %s:\n\n", project)
+	for _, grant := range grants {
+		fmt.Fprintf(c.ReadWriter.Out, "  @%s\t%s\texpires at %s (in %s)\tgranted by @%s\n",
+			grant.Username, grant.Role, formatTime(grant.ExpiresAt), formatRemaining(grant.ExpiresAt), grant.GrantedBy)
+	}
+
+	return nil
+}
+
+func (c *Command) logGrant(grantee, project, role string) *log.Entry {
+	fields := log.Fields{
+		"command": string(commandargs.AccessGrant),
+		"grantee": grantee,
+		"project": project,
+		"role":    role,
+	}
+
+	if c.Args.GitlabUsername != "" {
+		fields["username"] = c.Args.GitlabUsername
+	} else {
+		fields["gl_key_id"] = c.Args.GitlabKeyId
+	}
+
+	return log.WithFields(fields)
+}
+
+func parseGrantOptions(args []string) (*grantOptions, error) {
+	options := &grantOptions{}
+
+	flags := flag.NewFlagSet("grant", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.StringVar(&options.role, "role", defaultRole, "")
+	flags.DurationVar(&options.ttl, "ttl", 0, "")
+
+	// Positional arguments come first, but are also accepted after the flags
+	var positional []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, usageError(err.Error())
+	}
+
+	positional = append(positional, flags.Args()...)
+	if len(positional) != 2 {
+		return nil, usageError("Wrong number of arguments")
+	}
+
+	options.grantee = parseUsername(positional[0])
+	options.project = positional[1]
+
+	if options.ttl <= 0 {
+		return nil, usageError("A positive --ttl is required")
+	}
+
+	if !isValidRole(options.role) {
+		return nil, usageError(fmt.Sprintf("Unknown role: %s", options.role))
+	}
+
+	return options, nil
+}
+
+// A leading @ is accepted so users named like a subcommand can be granted access
+func parseUsername(username string) string {
+	return strings.TrimPrefix(username, "@")
+}
+
+func isValidRole(role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+func formatRemaining(t time.Time) string {
+	return t.Sub(now()).Round(time.Second).String()
+}
+
+func usageError(message string) error {
+	return errors.New(message + "\n" + usage)
+}
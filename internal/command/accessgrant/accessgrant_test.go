@@ -0,0 +1,229 @@
+package accessgrant
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/accessgrant"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
+)
+
+var (
+	currentTime = time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	expiresAt   = currentTime.Add(2 * time.Hour)
+)
+
+func setup(t *testing.T) []testserver.TestRequestHandler {
+	return []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/access_grants",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					var grants []map[string]interface{}
+					if r.URL.Query().Get("project") == "group/project" {
+						grants = append(grants, map[string]interface{}{
+							"username": "jane", "project": "group/project", "role": "developer", "granted_by": "john", "expires_at": expiresAt,
+						})
+					}
+
+					body := map[string]interface{}{"success": true, "grants": grants}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+					return
+				}
+
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				var request *accessgrant.Request
+				require.NoError(t, json.Unmarshal(b, &request))
+
+				if request.KeyId != "1" {
+					body := map[string]interface{}{"success": false, "message": "Only maintainers of the project can grant access"}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+					return
+				}
+
+				expires := currentTime.Add(time.Duration(request.ExpiresIn) * time.Second)
+				body := map[string]interface{}{
+					"success": true,
+					"grant":   map[string]interface{}{"username": request.Grantee, "project": request.Project, "role": request.Role, "expires_at": expires},
+				}
+				require.NoError(t, json.NewEncoder(w).Encode(body))
+			},
+		},
+		{
+			Path: "/api/v4/internal/access_grants/revoke",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				var request *accessgrant.Request
+				require.NoError(t, json.Unmarshal(b, &request))
+
+				body := map[string]interface{}{
+					"success": true,
+					"grant":   map[string]interface{}{"username": request.Grantee, "project": request.Project, "role": "developer"},
+				}
+				require.NoError(t, json.NewEncoder(w).Encode(body))
+			},
+		},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	url, cleanup := testserver.StartSocketHttpServer(t, setup(t))
+	defer cleanup()
+
+	now = func() time.Time { return currentTime }
+	defer func() { now = time.Now }()
+
+	testCases := []struct {
+		desc           string
+		sshArgs        []string
+		expectedOutput string
+	}{
+		{
+			desc:    "Granting access",
+			sshArgs: []string{"grant", "jane", "group/project", "--role", "reporter", "--ttl", "2h"},
+			expectedOutput: "Granted @jane reporter access to group/project.\n" +
+				"Access expires at 2020-01-01 12:00:00 UTC (in 2h0m0s).\n",
+		},
+		{
+			desc:    "Granting access with the default role and flags first",
+			sshArgs: []string{"grant", "--ttl", "30m", "@list", "group/project"},
+			expectedOutput: "Granted @list developer access to group/project.\n" +
+				"Access expires at 2020-01-01 10:30:00 UTC (in 30m0s).\n",
+		},
+		{
+			desc:           "Revoking access",
+			sshArgs:        []string{"grant", "revoke", "jane", "group/project"},
+			expectedOutput: "Revoked temporary developer access of @jane to group/project.\n",
+		},
+		{
+			desc:    "Listing grants",
+			sshArgs: []string{"grant", "list", "group/project"},
+			expectedOutput: "Temporary access grants for group/project:\n\n" +
+				"  @jane\tdeveloper\texpires at 2020-01-01 12:00:00 UTC (in 2h0m0s)\tgranted by @john\n",
+		},
+		{
+			desc:           "Listing without grants",
+			sshArgs:        []string{"grant", "list", "group/other"},
+			expectedOutput: "There are no temporary access grants for group/other.\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     &config.Config{GitlabUrl: url},
+				Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: tc.sshArgs},
+				ReadWriter: &readwriter.ReadWriter{Out: output},
+			}
+
+			err := cmd.Execute()
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedOutput, output.String())
+		})
+	}
+}
+
+func TestFailingExecute(t *testing.T) {
+	url, cleanup := testserver.StartSocketHttpServer(t, setup(t))
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		keyId         string
+		sshArgs       []string
+		expectedError string
+	}{
+		{
+			desc:          "Without a ttl",
+			keyId:         "1",
+			sshArgs:       []string{"grant", "jane", "group/project"},
+			expectedError: "A positive --ttl is required\n" + usage,
+		},
+		{
+			desc:          "With an unknown role",
+			keyId:         "1",
+			sshArgs:       []string{"grant", "jane", "group/project", "--ttl", "1h", "--role", "owner"},
+			expectedError: "Unknown role: owner\n" + usage,
+		},
+		{
+			desc:          "With an invalid ttl",
+			keyId:         "1",
+			sshArgs:       []string{"grant", "jane", "group/project", "--ttl", "forever"},
+			expectedError: "invalid value \"forever\" for flag -ttl: parse error\n" + usage,
+		},
+		{
+			desc:          "With missing arguments",
+			keyId:         "1",
+			sshArgs:       []string{"grant", "jane", "--ttl", "1h"},
+			expectedError: "Wrong number of arguments\n" + usage,
+		},
+		{
+			desc:          "When revoking with missing arguments",
+			keyId:         "1",
+			sshArgs:       []string{"grant", "revoke", "jane"},
+			expectedError: "Wrong number of arguments\n" + usage,
+		},
+		{
+			desc:          "When the user isn't a maintainer",
+			keyId:         "2",
+			sshArgs:       []string{"grant", "jane", "group/project", "--ttl", "1h"},
+			expectedError: "Only maintainers of the project can grant access",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     &config.Config{GitlabUrl: url},
+				Args:       &commandargs.Shell{GitlabKeyId: tc.keyId, SshArgs: tc.sshArgs},
+				ReadWriter: &readwriter.ReadWriter{Out: output},
+			}
+
+			err := cmd.Execute()
+
+			require.EqualError(t, err, tc.expectedError)
+			require.Empty(t, output.String())
+		})
+	}
+}
+
+func TestGrantIsLogged(t *testing.T) {
+	url, cleanup := testserver.StartSocketHttpServer(t, setup(t))
+	defer cleanup()
+
+	hook := testhelper.SetupLogger()
+
+	cmd := &Command{
+		Config:     &config.Config{GitlabUrl: url},
+		Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: []string{"grant", "jane", "group/project", "--ttl", "1h"}},
+		ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}},
+	}
+
+	require.NoError(t, cmd.Execute())
+
+	require.True(t, testhelper.WaitForLogEvent(hook))
+	entry := hook.LastEntry()
+	require.Contains(t, entry.Message, "Granted temporary access")
+	require.Contains(t, entry.Message, "grantee=jane")
+	require.Contains(t, entry.Message, "project=group/project")
+	require.Contains(t, entry.Message, "role=developer")
+	require.Contains(t, entry.Message, "gl_key_id=1")
+	require.Contains(t, entry.Message, "expires_at=")
+}
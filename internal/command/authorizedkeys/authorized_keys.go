@@ -1,9 +1,14 @@
 package authorizedkeys
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/http"
 	"strconv"
 
+	"golang.org/x/crypto/ssh"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
@@ -37,6 +42,11 @@ func (c *Command) Execute() error {
 func (c *Command) printKeyLine() error {
 	response, err := c.getAuthorizedKey()
 	if err != nil {
+		// Registered keys mustn't become anonymous when GitLab fails
+		if isUnknownKey(err) && (c.Config.AnonymousSsh.Enabled || c.Config.Enrollment.Enabled) {
+			return c.printAnonymousKeyLine()
+		}
+
 		fmt.Fprintln(c.ReadWriter.Out, fmt.Sprintf("# No key was found for %s", c.Args.Key))
 		return nil
 	}
@@ -46,11 +56,67 @@ func (c *Command) printKeyLine() error {
 		return err
 	}
 
+	// A key allowed no commands is printed nothing for, so it's denied
+	if err := keyLine.RestrictCommands(response.AllowedCommands); err == keyline.NoAllowedCommandsError {
+		fmt.Fprintln(c.ReadWriter.Out, fmt.Sprintf("# No commands are allowed for %s", c.Args.Key))
+		return nil
+	} else if err != nil {
+		return err
+	}
+
 	fmt.Fprintln(c.ReadWriter.Out, keyLine.ToString())
 
 	return nil
 }
 
+func (c *Command) printAnonymousKeyLine() error {
+	// sshd only passes the base64 encoded key, the type has to be recovered
+	// from the key itself to build a valid authorized_keys line.
+	keyType, err := parseKeyType(c.Args.Key)
+	if err != nil {
+		fmt.Fprintln(c.ReadWriter.Out, fmt.Sprintf("# No key was found for %s", c.Args.Key))
+		return nil
+	}
+
+	keyLine, err := keyline.NewAnonymousKeyLine(keyType+" "+c.Args.Key, c.Config)
+	if err != nil {
+		return err
+	}
+
+	// Without anonymous access, unknown keys may only enroll themselves
+	if !c.Config.AnonymousSsh.Enabled {
+		if err := keyLine.RestrictCommands([]string{string(commandargs.Enroll)}); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(c.ReadWriter.Out, keyLine.ToString())
+
+	return nil
+}
+
+// isUnknownKey tells whether GitLab doesn't know the key, rather than failed
+// to look it up.
+func isUnknownKey(err error) bool {
+	apiErr, ok := err.(*client.ApiError)
+
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+func parseKeyType(key string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", err
+	}
+
+	publicKey, err := ssh.ParsePublicKey(data)
+	if err != nil {
+		return "", err
+	}
+
+	return publicKey.Type(), nil
+}
+
 func (c *Command) getAuthorizedKey() (*authorizedkeys.Response, error) {
 	client, err := authorizedkeys.NewClient(c.Config)
 	if err != nil {
@@ -14,6 +14,11 @@ import (
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
 )
 
+const (
+	unknownKey = "AAAAC3NzaC1lZDI1NTE5AAAAIBmhkEhEIE1ovGritMH9yeeCkmVEnE7NDt1wstiTR9+Q"
+	failingKey = "AAAAC3NzaC1lZDI1NTE5AAAAIKMwqzhrXhKKw+ad/YBHLuTMNKl7yvPPwn1VOu5F7ngm"
+)
+
 var (
 	requests = []testserver.TestRequestHandler{
 		{
@@ -25,13 +30,27 @@ var (
 						"key": "public-key",
 					}
 					json.NewEncoder(w).Encode(body)
+				} else if r.URL.Query().Get("key") == "lfs-key" {
+					body := map[string]interface{}{
+						"id":               2,
+						"key":              "lfs-public-key",
+						"allowed_commands": []string{"git-lfs-authenticate"},
+					}
+					json.NewEncoder(w).Encode(body)
+				} else if r.URL.Query().Get("key") == "no-commands-key" {
+					body := map[string]interface{}{
+						"id":               3,
+						"key":              "no-commands-public-key",
+						"allowed_commands": []string{},
+					}
+					json.NewEncoder(w).Encode(body)
 				} else if r.URL.Query().Get("key") == "broken-message" {
 					body := map[string]string{
 						"message": "Forbidden!",
 					}
 					w.WriteHeader(http.StatusForbidden)
 					json.NewEncoder(w).Encode(body)
-				} else if r.URL.Query().Get("key") == "broken" {
+				} else if r.URL.Query().Get("key") == "broken" || r.URL.Query().Get("key") == failingKey {
 					w.WriteHeader(http.StatusInternalServerError)
 				} else {
 					w.WriteHeader(http.StatusNotFound)
@@ -47,6 +66,14 @@ func TestExecute(t *testing.T) {
 
 	defaultConfig := &config.Config{RootDir: "/tmp", GitlabUrl: url}
 	configWithSslCertDir := &config.Config{RootDir: "/tmp", GitlabUrl: url, SslCertDir: "/tmp/certs"}
+	configWithAnonymousSsh := &config.Config{RootDir: "/tmp", GitlabUrl: url, AnonymousSsh: config.AnonymousSshConfig{Enabled: true}}
+	configWithEnrollment := &config.Config{RootDir: "/tmp", GitlabUrl: url, Enrollment: config.EnrollmentConfig{Enabled: true}}
+	configWithAnonymousSshAndEnrollment := &config.Config{
+		RootDir:      "/tmp",
+		GitlabUrl:    url,
+		AnonymousSsh: config.AnonymousSshConfig{Enabled: true},
+		Enrollment:   config.EnrollmentConfig{Enabled: true},
+	}
 
 	testCases := []struct {
 		desc           string
@@ -65,6 +92,16 @@ func TestExecute(t *testing.T) {
 			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "key"},
 			expectedOutput: "command=\"SSL_CERT_DIR=/tmp/certs /tmp/bin/gitlab-shell key-1\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty public-key\n",
 		},
+		{
+			desc:           "With allowed commands",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "lfs-key"},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell key-2 allowed-commands=git-lfs-authenticate\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty lfs-public-key\n",
+		},
+		{
+			desc:           "With no allowed commands",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "no-commands-key"},
+			expectedOutput: "# No commands are allowed for no-commands-key\n",
+		},
 		{
 			desc:           "When key doesn't match any existing key",
 			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "not-found"},
@@ -80,6 +117,54 @@ func TestExecute(t *testing.T) {
 			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "broken"},
 			expectedOutput: "# No key was found for broken\n",
 		},
+		{
+			desc:           "With anonymous SSH access and a known key",
+			config:         configWithAnonymousSsh,
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "key"},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell key-1\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty public-key\n",
+		},
+		{
+			desc:           "With anonymous SSH access and an unknown key",
+			config:         configWithAnonymousSsh,
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: unknownKey},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell anonymous\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-ed25519 " + unknownKey + "\n",
+		},
+		{
+			desc:           "With anonymous SSH access and an invalid key",
+			config:         configWithAnonymousSsh,
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "not-found"},
+			expectedOutput: "# No key was found for not-found\n",
+		},
+		{
+			desc:           "With anonymous SSH access and a failing API",
+			config:         configWithAnonymousSsh,
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: failingKey},
+			expectedOutput: "# No key was found for " + failingKey + "\n",
+		},
+		{
+			desc:           "With enrollment and a known key",
+			config:         configWithEnrollment,
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "key"},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell key-1\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty public-key\n",
+		},
+		{
+			desc:           "With enrollment and an unknown key",
+			config:         configWithEnrollment,
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: unknownKey},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell anonymous allowed-commands=enroll\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-ed25519 " + unknownKey + "\n",
+		},
+		{
+			desc:           "With anonymous SSH access, enrollment and an unknown key",
+			config:         configWithAnonymousSshAndEnrollment,
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: unknownKey},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell anonymous\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-ed25519 " + unknownKey + "\n",
+		},
+		{
+			desc:           "With enrollment and a failing API",
+			config:         configWithEnrollment,
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: failingKey},
+			expectedOutput: "# No key was found for " + failingKey + "\n",
+		},
 	}
 
 	for _, tc := range testCases {
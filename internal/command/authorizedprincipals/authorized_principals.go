@@ -3,10 +3,13 @@ package authorizedprincipals
 import (
 	"fmt"
 
+	log "github.com/sirupsen/logrus"
+
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/keyline"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/principals"
 )
 
 type Command struct {
@@ -23,20 +26,37 @@ func (c *Command) Execute() error {
 	return nil
 }
 
+// sshd matches the principals of the lines against the principals of the
+// certificate, so they're printed as given. The rules only rewrite the GitLab
+// username gitlab-shell runs as, which is the key ID without rules. A rule
+// producing an invalid username only skips that principal, the others of the
+// certificate can still be used.
 func (c *Command) printPrincipalLines() error {
-	principals := c.Args.Principals
+	mapper, err := principals.NewMapper(c.Config.AuthorizedPrincipals.Rules)
+	if err != nil {
+		return err
+	}
+
+	for _, mapped := range mapper.MapAll(c.Args.Principals) {
+		username := c.Args.KeyId
+		if mapper.HasRules() {
+			username = mapped.Username
+		}
+
+		if err := c.printPrincipalLine(username, mapped.Principal); err != nil {
+			if !mapper.HasRules() {
+				return err
+			}
 
-	for _, principal := range principals {
-		if err := c.printPrincipalLine(principal); err != nil {
-			return err
+			log.WithError(err).WithFields(log.Fields{"principal": mapped.Principal, "username": username}).Warn("Skipping principal mapped to an invalid username")
 		}
 	}
 
 	return nil
 }
 
-func (c *Command) printPrincipalLine(principal string) error {
-	principalKeyLine, err := keyline.NewPrincipalKeyLine(c.Args.KeyId, principal, c.Config)
+func (c *Command) printPrincipalLine(username, principal string) error {
+	principalKeyLine, err := keyline.NewPrincipalKeyLine(username, principal, c.Config)
 	if err != nil {
 		return err
 	}
@@ -2,6 +2,7 @@ package authorizedprincipals
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -9,11 +10,21 @@ import (
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
 )
 
 func TestExecute(t *testing.T) {
 	defaultConfig := &config.Config{RootDir: "/tmp"}
 	configWithSslCertDir := &config.Config{RootDir: "/tmp", SslCertDir: "/tmp/certs"}
+	configWithRules := &config.Config{
+		RootDir: "/tmp",
+		AuthorizedPrincipals: config.AuthorizedPrincipalsConfig{
+			Rules: []config.PrincipalRule{
+				{Match: `\A(.+)@corp\.example\z`, Replace: "$1"},
+				{Match: `\Aeng:(.+)\z`, Replace: "$1"},
+			},
+		},
+	}
 
 	testCases := []struct {
 		desc           string
@@ -37,6 +48,23 @@ func TestExecute(t *testing.T) {
 			arguments:      &commandargs.AuthorizedPrincipals{KeyId: "key", Principals: []string{"principal-1", "principal-2"}},
 			expectedOutput: "command=\"/tmp/bin/gitlab-shell username-key\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty principal-1\ncommand=\"/tmp/bin/gitlab-shell username-key\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty principal-2\n",
 		},
+		{
+			desc:           "With principal mapping rules",
+			config:         configWithRules,
+			arguments:      &commandargs.AuthorizedPrincipals{KeyId: "key", Principals: []string{"jdoe@corp.example", "eng:jdoe", "root", "asmith@corp.example"}},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell username-jdoe\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty jdoe@corp.example\ncommand=\"/tmp/bin/gitlab-shell username-jdoe\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty eng:jdoe\ncommand=\"/tmp/bin/gitlab-shell username-asmith\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty asmith@corp.example\n",
+		},
+		{
+			desc:           "With a principal mapped to an invalid username",
+			config:         configWithRules,
+			arguments:      &commandargs.AuthorizedPrincipals{KeyId: "key", Principals: []string{"j.doe@corp.example", "eng:jdoe"}},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell username-jdoe\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty eng:jdoe\n",
+		},
+		{
+			desc:      "With no principal matching the rules",
+			config:    configWithRules,
+			arguments: &commandargs.AuthorizedPrincipals{KeyId: "key", Principals: []string{"root"}},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -58,6 +86,55 @@ func TestExecute(t *testing.T) {
 
 			require.NoError(t, err)
 			require.Equal(t, tc.expectedOutput, buffer.String())
+
+			// sshd only accepts lines for principals of the certificate
+			for _, line := range strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n") {
+				if line == "" {
+					continue
+				}
+
+				fields := strings.Fields(line)
+				require.Contains(t, tc.arguments.Principals, fields[len(fields)-1])
+			}
 		})
 	}
 }
+
+func TestSkippedPrincipalIsLogged(t *testing.T) {
+	hook := testhelper.SetupLogger()
+
+	cmd := &Command{
+		Config: &config.Config{
+			RootDir: "/tmp",
+			AuthorizedPrincipals: config.AuthorizedPrincipalsConfig{
+				Rules: []config.PrincipalRule{{Match: `\A(.+)@corp\.example\z`, Replace: "$1"}},
+			},
+		},
+		Args:       &commandargs.AuthorizedPrincipals{KeyId: "key", Principals: []string{"j.doe@corp.example"}},
+		ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}},
+	}
+
+	require.NoError(t, cmd.Execute())
+
+	require.True(t, testhelper.WaitForLogEvent(hook))
+	entry := hook.LastEntry()
+	require.Contains(t, entry.Message, "Skipping principal mapped to an invalid username")
+	require.Contains(t, entry.Message, "username=j.doe")
+}
+
+func TestFailingExecute(t *testing.T) {
+	cmd := &Command{
+		Config: &config.Config{
+			RootDir: "/tmp",
+			AuthorizedPrincipals: config.AuthorizedPrincipalsConfig{
+				Rules: []config.PrincipalRule{{Match: "(invalid"}},
+			},
+		},
+		Args:       &commandargs.AuthorizedPrincipals{KeyId: "key", Principals: []string{"principal"}},
+		ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}},
+	}
+
+	err := cmd.Execute()
+
+	require.EqualError(t, err, "Invalid principal rule 1: error parsing regexp: missing closing ): `(invalid`")
+}
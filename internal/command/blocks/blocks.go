@@ -0,0 +1,86 @@
+package blocks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/denials"
+)
+
+const (
+	listCommand  = "list"
+	clearCommand = "clear"
+	allFlag      = "--all"
+
+	usage = "Usage: check blocks list\n       check blocks clear <identity>|--all"
+)
+
+// Command lists and lifts the local blocks of SSH keys and addresses denied
+// too often.
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.GenericArgs
+	ReadWriter *readwriter.ReadWriter
+}
+
+func (c *Command) Execute() error {
+	args := c.Args.Arguments[1:]
+	tracker := &denials.Tracker{Dir: c.Config.StateDir, Config: c.Config.DenialBlocking}
+
+	switch {
+	case len(args) == 1 && args[0] == listCommand:
+		return c.list(tracker)
+	case len(args) == 2 && args[0] == clearCommand:
+		identity := args[1]
+		if identity == allFlag {
+			identity = ""
+		}
+
+		return c.clear(tracker, identity)
+	}
+
+	return errors.New(usage)
+}
+
+func (c *Command) list(tracker *denials.Tracker) error {
+	blocks, err := tracker.List()
+	if err != nil {
+		return err
+	}
+
+	if len(blocks) == 0 {
+		fmt.Fprintln(c.ReadWriter.Out, "No active blocks")
+		return nil
+	}
+
+	for _, block := range blocks {
+		fmt.Fprintf(c.ReadWriter.Out, "%s blocked until %s\n", block.Identity, block.Until.UTC().Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func (c *Command) clear(tracker *denials.Tracker, identity string) error {
+	cleared, err := tracker.Clear(identity)
+	if err != nil {
+		return err
+	}
+
+	for _, block := range cleared {
+		log.WithFields(log.Fields{"identity": block.Identity, "os_user": os.Getenv("USER")}).Info("Denial block cleared")
+		fmt.Fprintf(c.ReadWriter.Out, "Unblocked %s\n", block.Identity)
+	}
+
+	if len(cleared) == 0 {
+		fmt.Fprintln(c.ReadWriter.Out, "No matching blocks")
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package blocks
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/denials"
+)
+
+func TestExecute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := &config.Config{StateDir: dir, DenialBlocking: config.DenialBlockingConfig{MaxDenials: 1, WindowSeconds: 60, BlockDurationSeconds: 600}}
+
+	tracker := &denials.Tracker{Dir: dir, Config: cfg.DenialBlocking}
+	_, _, err = tracker.RecordDenial("key-1", "ip-192.0.2.1")
+	require.NoError(t, err)
+
+	run := func(args ...string) string {
+		output := &bytes.Buffer{}
+		cmd := &Command{Config: cfg, Args: &commandargs.GenericArgs{Arguments: append([]string{"blocks"}, args...)}, ReadWriter: &readwriter.ReadWriter{Out: output}}
+
+		require.NoError(t, cmd.Execute())
+
+		return output.String()
+	}
+
+	require.Regexp(t, `\Aip-192\.0\.2\.1 blocked until \S+\nkey-1 blocked until \S+\n\z`, run("list"))
+	require.Equal(t, "Unblocked key-1\n", run("clear", "key-1"))
+	require.Equal(t, "No matching blocks\n", run("clear", "key-1"))
+	require.Equal(t, "Unblocked ip-192.0.2.1\n", run("clear", "--all"))
+	require.Equal(t, "No active blocks\n", run("list"))
+}
+
+func TestFailingExecute(t *testing.T) {
+	for _, args := range [][]string{{"blocks"}, {"blocks", "clear"}, {"blocks", "unknown"}} {
+		cmd := &Command{Config: &config.Config{}, Args: &commandargs.GenericArgs{Arguments: args}, ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}}}
+
+		require.EqualError(t, cmd.Execute(), usage)
+	}
+}
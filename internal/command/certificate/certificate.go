@@ -0,0 +1,240 @@
+package certificate
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/discover"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/keyline"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/principals"
+)
+
+const (
+	issueCommand = "issue"
+
+	usage = "Usage: cert issue [--ttl <duration>] < ~/.ssh/id_ed25519.pub"
+
+	maxPublicKeySize = 16 * 1024
+	minRsaKeyBits    = 2048
+
+	// Certificates are valid a bit before they are issued in case the
+	// clocks of the servers differ
+	clockSkew = 5 * time.Minute
+)
+
+var (
+	// now is overridden in tests
+	now = time.Now
+
+	NotConfiguredError = errors.New("SSH certificates are not enabled on this server")
+)
+
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.Shell
+	ReadWriter *readwriter.ReadWriter
+}
+
+func (c *Command) Execute() error {
+	cfg := c.Config.SshCertificates
+	if cfg.CaKeyFile == "" {
+		return NotConfiguredError
+	}
+
+	ttl, err := c.parseArgs()
+	if err != nil {
+		return err
+	}
+
+	// A certificate can't be used to get another one, or certificates would
+	// never have to expire
+	if c.Args.GitlabKeyId == "" {
+		return errors.New("Certificates can only be issued to registered SSH keys")
+	}
+
+	publicKey, err := readPublicKey(c.ReadWriter.In)
+	if err != nil {
+		return err
+	}
+
+	user, err := c.getUser()
+	if err != nil {
+		return err
+	}
+
+	// The certificate is only of use if its principals line can be written
+	if _, err := keyline.NewPrincipalKeyLine(user.Username, principals.IssuedPrefix+user.Username, c.Config); err != nil {
+		return fmt.Errorf("Certificates can't be issued to the username %s", user.Username)
+	}
+
+	authority, err := loadAuthority(cfg.CaKeyFile)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"ca_key_file": cfg.CaKeyFile}).Error("Unable to load the SSH certificate authority")
+		return errors.New("Certificates can't be issued at the moment")
+	}
+
+	cert, err := c.sign(publicKey, user.Username, ttl, authority)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"username":     user.Username,
+		"gl_key_id":    c.Args.GitlabKeyId,
+		"serial":       cert.Serial,
+		"fingerprint":  ssh.FingerprintSHA256(publicKey),
+		"valid_before": time.Unix(int64(cert.ValidBefore), 0).UTC().Format(time.RFC3339),
+	}).Info("Issued SSH certificate")
+
+	_, err = c.ReadWriter.Out.Write(ssh.MarshalAuthorizedKey(cert))
+
+	return err
+}
+
+func (c *Command) parseArgs() (time.Duration, error) {
+	args := c.Args.SshArgs[1:]
+	if len(args) == 0 || args[0] != issueCommand {
+		return 0, errors.New(usage)
+	}
+
+	cfg := c.Config.SshCertificates
+	maxTtl := time.Duration(cfg.MaxTtlHours) * time.Hour
+
+	var ttl time.Duration
+	flags := flag.NewFlagSet("cert issue", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.DurationVar(&ttl, "ttl", time.Duration(cfg.TtlHours)*time.Hour, "")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return 0, errors.New(err.Error() + "\n" + usage)
+	}
+
+	if flags.NArg() > 0 {
+		return 0, errors.New("Wrong number of arguments\n" + usage)
+	}
+
+	if ttl <= 0 || ttl > maxTtl {
+		return 0, fmt.Errorf("The validity must be between 0 and %v", maxTtl)
+	}
+
+	return ttl, nil
+}
+
+func readPublicKey(in io.Reader) (ssh.PublicKey, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(in, maxPublicKeySize))
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, errors.New("Invalid public key, pass the public key on standard input\n" + usage)
+	}
+
+	if _, ok := publicKey.(*ssh.Certificate); ok {
+		return nil, errors.New("Certificates can't be signed, pass a public key")
+	}
+
+	if cryptoKey, ok := publicKey.(ssh.CryptoPublicKey); ok {
+		if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRsaKeyBits {
+			return nil, fmt.Errorf("RSA keys must have at least %d bits", minRsaKeyBits)
+		}
+	}
+
+	return publicKey, nil
+}
+
+func (c *Command) getUser() (*discover.Response, error) {
+	client, err := discover.NewClient(c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := client.GetByCommandArgs(c.Args)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get username: %v", err)
+	}
+
+	if user.IsAnonymous() {
+		return nil, errors.New("Certificates can only be issued to GitLab users")
+	}
+
+	return user, nil
+}
+
+// loadAuthority reads the CA private key, which must be a regular file only
+// accessible by the user gitlab-shell runs as.
+func loadAuthority(filename string) (ssh.Signer, error) {
+	info, err := os.Lstat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", filename)
+	}
+
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s must only be accessible by its owner", filename)
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return nil, fmt.Errorf("%s must be owned by the user gitlab-shell runs as", filename)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.ParsePrivateKey(data)
+}
+
+// The certificate carries the GitLab username as key ID, and as principal
+// after principals.IssuedPrefix. sshd passes both to
+// gitlab-shell-authorized-principals-check, which makes the username the one
+// gitlab-shell runs as, with or without principal rules, so the session isn't
+// taken for the SSH key the certificate was issued to.
+func (c *Command) sign(publicKey ssh.PublicKey, username string, ttl time.Duration, authority ssh.Signer) (*ssh.Certificate, error) {
+	serial := make([]byte, 8)
+	if _, err := rand.Read(serial); err != nil {
+		return nil, err
+	}
+
+	issuedAt := now()
+
+	cert := &ssh.Certificate{
+		Key:             publicKey,
+		Serial:          binary.BigEndian.Uint64(serial),
+		CertType:        ssh.UserCert,
+		KeyId:           username,
+		ValidPrincipals: []string{principals.IssuedPrefix + username},
+		ValidAfter:      uint64(issuedAt.Add(-clockSkew).Unix()),
+		ValidBefore:     uint64(issuedAt.Add(ttl).Unix()),
+		Permissions: ssh.Permissions{
+			// Only what git and the gitlab-shell commands need
+			Extensions: map[string]string{"permit-pty": ""},
+		},
+	}
+
+	if err := cert.SignCert(rand.Reader, authority); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
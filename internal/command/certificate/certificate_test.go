@@ -0,0 +1,320 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/authorizedprincipals"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/executable"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
+)
+
+var (
+	issuedAt = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	requests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/discover",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Query().Get("key_id") {
+				case "1":
+					json.NewEncoder(w).Encode(map[string]interface{}{"id": 2, "username": "alex-doe", "name": "Alex Doe"})
+				case "3":
+					json.NewEncoder(w).Encode(map[string]interface{}{"id": 4, "username": "sam doe", "name": "Sam Doe"})
+				default:
+					fmt.Fprint(w, "null")
+				}
+			},
+		},
+	}
+)
+
+func setup(t *testing.T) (*config.Config, ssh.PublicKey, func()) {
+	dir, err := ioutil.TempDir("", "certificate")
+	require.NoError(t, err)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalECPrivateKey(caKey)
+	require.NoError(t, err)
+
+	caKeyFile := filepath.Join(dir, "ca_key")
+	require.NoError(t, ioutil.WriteFile(caKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+
+	caPublicKey, err := ssh.NewPublicKey(&caKey.PublicKey)
+	require.NoError(t, err)
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+
+	cfg := &config.Config{
+		GitlabUrl:       url,
+		SshCertificates: config.SshCertificatesConfig{CaKeyFile: caKeyFile, TtlHours: 24, MaxTtlHours: 24},
+	}
+
+	return cfg, caPublicKey, func() {
+		cleanup()
+		os.RemoveAll(dir)
+	}
+}
+
+func userPublicKey(t *testing.T) ssh.PublicKey {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+
+	return sshKey
+}
+
+func TestExecute(t *testing.T) {
+	cfg, caPublicKey, cleanup := setup(t)
+	defer cleanup()
+
+	defer func(oldNow func() time.Time) { now = oldNow }(now)
+	now = func() time.Time { return issuedAt }
+
+	testCases := []struct {
+		desc        string
+		arguments   []string
+		validBefore time.Time
+	}{
+		{
+			desc:        "With the default validity",
+			arguments:   []string{"cert", "issue"},
+			validBefore: issuedAt.Add(24 * time.Hour),
+		},
+		{
+			desc:        "With a given validity",
+			arguments:   []string{"cert", "issue", "--ttl", "8h"},
+			validBefore: issuedAt.Add(8 * time.Hour),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			publicKey := userPublicKey(t)
+
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     cfg,
+				Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: output, In: bytes.NewReader(ssh.MarshalAuthorizedKey(publicKey))},
+			}
+
+			require.NoError(t, cmd.Execute())
+
+			parsed, _, _, _, err := ssh.ParseAuthorizedKey(output.Bytes())
+			require.NoError(t, err)
+
+			cert, ok := parsed.(*ssh.Certificate)
+			require.True(t, ok)
+
+			require.Equal(t, publicKey.Marshal(), cert.Key.Marshal())
+			require.Equal(t, uint32(ssh.UserCert), cert.CertType)
+			require.Equal(t, []string{"gitlab-shell:alex-doe"}, cert.ValidPrincipals)
+			require.Equal(t, "alex-doe", cert.KeyId)
+			require.Equal(t, uint64(issuedAt.Add(-clockSkew).Unix()), cert.ValidAfter)
+			require.Equal(t, uint64(tc.validBefore.Unix()), cert.ValidBefore)
+			require.Equal(t, caPublicKey.Marshal(), cert.SignatureKey.Marshal())
+
+			checker := &ssh.CertChecker{Clock: func() time.Time { return issuedAt }}
+			require.NoError(t, checker.CheckCert("gitlab-shell:alex-doe", cert))
+		})
+	}
+}
+
+// TestLoginWithCertificate follows an issued certificate the way sshd does:
+// its key ID and principals go to gitlab-shell-authorized-principals-check,
+// whose command line then runs gitlab-shell.
+func TestLoginWithCertificate(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		rules []config.PrincipalRule
+	}{
+		{
+			desc: "Without principal rules",
+		},
+		{
+			desc:  "With principal rules",
+			rules: []config.PrincipalRule{{Match: `\A([a-z0-9-]+)@corp\.example\z`, Replace: "$1"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cfg, _, cleanup := setup(t)
+			defer cleanup()
+			cfg.RootDir = "/tmp"
+			cfg.AuthorizedPrincipals.Rules = tc.rules
+
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     cfg,
+				Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: []string{"cert", "issue"}},
+				ReadWriter: &readwriter.ReadWriter{Out: output, In: bytes.NewReader(ssh.MarshalAuthorizedKey(userPublicKey(t)))},
+			}
+			require.NoError(t, cmd.Execute())
+
+			parsed, _, _, _, err := ssh.ParseAuthorizedKey(output.Bytes())
+			require.NoError(t, err)
+			cert := parsed.(*ssh.Certificate)
+
+			restoreEnv := testhelper.TempEnv(map[string]string{"SSH_CONNECTION": "1", "SSH_ORIGINAL_COMMAND": "cert issue"})
+			defer restoreEnv()
+
+			principalsArgs, err := commandargs.Parse(
+				&executable.Executable{Name: executable.AuthorizedPrincipalsCheck},
+				append([]string{cert.KeyId}, cert.ValidPrincipals...),
+			)
+			require.NoError(t, err)
+
+			lines := &bytes.Buffer{}
+			principalsCmd := &authorizedprincipals.Command{
+				Config:     cfg,
+				Args:       principalsArgs.(*commandargs.AuthorizedPrincipals),
+				ReadWriter: &readwriter.ReadWriter{Out: lines},
+			}
+			require.NoError(t, principalsCmd.Execute())
+
+			// sshd accepts the line for the principal the certificate was issued for
+			line := strings.TrimSuffix(lines.String(), "\n")
+			require.True(t, strings.HasSuffix(line, " gitlab-shell:alex-doe"), line)
+
+			command := regexp.MustCompile(`\Acommand="([^"]*)"`).FindStringSubmatch(line)
+			require.Len(t, command, 2)
+
+			shellArgs, err := commandargs.Parse(&executable.Executable{Name: executable.GitlabShell}, strings.Fields(command[1])[1:])
+			require.NoError(t, err)
+
+			shell := shellArgs.(*commandargs.Shell)
+			require.Equal(t, "alex-doe", shell.GitlabUsername)
+			require.Empty(t, shell.GitlabKeyId)
+
+			// The session can't be used to issue another certificate
+			cmd = &Command{
+				Config:     cfg,
+				Args:       shell,
+				ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, In: bytes.NewReader(ssh.MarshalAuthorizedKey(userPublicKey(t)))},
+			}
+			require.EqualError(t, cmd.Execute(), "Certificates can only be issued to registered SSH keys")
+		})
+	}
+}
+
+func TestFailingExecute(t *testing.T) {
+	cfg, _, cleanup := setup(t)
+	defer cleanup()
+
+	publicKey := ssh.MarshalAuthorizedKey(userPublicKey(t))
+
+	testCases := []struct {
+		desc          string
+		keyId         string
+		username      string
+		arguments     []string
+		input         []byte
+		expectedError string
+	}{
+		{
+			desc:          "Without a subcommand",
+			keyId:         "1",
+			arguments:     []string{"cert"},
+			input:         publicKey,
+			expectedError: usage,
+		},
+		{
+			desc:          "With a validity above the maximum",
+			keyId:         "1",
+			arguments:     []string{"cert", "issue", "--ttl", "25h"},
+			input:         publicKey,
+			expectedError: "The validity must be between 0 and 24h0m0s",
+		},
+		{
+			desc:          "When authenticated with a certificate",
+			username:      "alex-doe",
+			arguments:     []string{"cert", "issue"},
+			input:         publicKey,
+			expectedError: "Certificates can only be issued to registered SSH keys",
+		},
+		{
+			desc:          "Without a public key",
+			keyId:         "1",
+			arguments:     []string{"cert", "issue"},
+			input:         []byte("not a key"),
+			expectedError: "Invalid public key, pass the public key on standard input\n" + usage,
+		},
+		{
+			desc:          "With an unknown key",
+			keyId:         "2",
+			arguments:     []string{"cert", "issue"},
+			input:         publicKey,
+			expectedError: "Certificates can only be issued to GitLab users",
+		},
+		{
+			desc:          "With a username that can't be a principal",
+			keyId:         "3",
+			arguments:     []string{"cert", "issue"},
+			input:         publicKey,
+			expectedError: "Certificates can't be issued to the username sam doe",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     cfg,
+				Args:       &commandargs.Shell{GitlabKeyId: tc.keyId, GitlabUsername: tc.username, SshArgs: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: output, In: bytes.NewReader(tc.input)},
+			}
+
+			require.EqualError(t, cmd.Execute(), tc.expectedError)
+			require.Empty(t, output.String())
+		})
+	}
+}
+
+func TestUnsafeAuthority(t *testing.T) {
+	cfg, _, cleanup := setup(t)
+	defer cleanup()
+
+	require.NoError(t, os.Chmod(cfg.SshCertificates.CaKeyFile, 0644))
+
+	cmd := &Command{
+		Config:     cfg,
+		Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: []string{"cert", "issue"}},
+		ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, In: bytes.NewReader(ssh.MarshalAuthorizedKey(userPublicKey(t)))},
+	}
+
+	require.EqualError(t, cmd.Execute(), "Certificates can't be issued at the moment")
+
+	_, err := loadAuthority(cfg.SshCertificates.CaKeyFile)
+	require.EqualError(t, err, cfg.SshCertificates.CaKeyFile+" must only be accessible by its owner")
+
+	cmd.Config = &config.Config{}
+	require.Equal(t, NotConfiguredError, cmd.Execute())
+}
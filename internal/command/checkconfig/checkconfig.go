@@ -0,0 +1,74 @@
+package checkconfig
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+const (
+	encryptCommand = "encrypt"
+
+	usage = "Usage: check config encrypt < value"
+
+	maxValueSize = 64 * 1024
+)
+
+// Command encrypts values for config.yml with the configured identity. The
+// value is read from standard input, so it doesn't end up in shell history.
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.GenericArgs
+	ReadWriter *readwriter.ReadWriter
+}
+
+func (c *Command) Execute() error {
+	args := c.Args.Arguments[1:]
+	if len(args) != 1 || args[0] != encryptCommand {
+		return errors.New(usage)
+	}
+
+	identity, err := c.Config.LoadIdentity()
+	if err != nil {
+		return err
+	}
+
+	value, err := c.readValue()
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := identity.Encrypt([]byte(value))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(c.ReadWriter.Out, encrypted)
+
+	return err
+}
+
+// readValue drops the line break ending the input, e.g. from echo
+func (c *Command) readValue() (string, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(c.ReadWriter.In, maxValueSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) > maxValueSize {
+		return "", fmt.Errorf("The value must not be longer than %d bytes", maxValueSize)
+	}
+
+	value := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+	if value == "" {
+		return "", errors.New("Pass the value to encrypt on standard input\n" + usage)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,112 @@
+package checkconfig
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+func setup(t *testing.T) (*config.Config, func()) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-identity")
+	require.NoError(t, err)
+
+	identityFile := path.Join(dir, "identity")
+	require.NoError(t, ioutil.WriteFile(identityFile, []byte(base64.StdEncoding.EncodeToString(make([]byte, 32))), 0600))
+
+	return &config.Config{RootDir: dir, IdentityFile: "identity"}, func() { os.RemoveAll(dir) }
+}
+
+func TestExecute(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	for _, input := range []string{"s3cret", "s3cret\n", "s3cret\r\n"} {
+		output := &bytes.Buffer{}
+		cmd := &Command{
+			Config:     cfg,
+			Args:       &commandargs.GenericArgs{Arguments: []string{"config", "encrypt"}},
+			ReadWriter: &readwriter.ReadWriter{In: strings.NewReader(input), Out: output},
+		}
+
+		require.NoError(t, cmd.Execute())
+		require.NotContains(t, output.String(), "s3cret")
+
+		identity, err := cfg.LoadIdentity()
+		require.NoError(t, err)
+
+		plaintext, err := identity.Decrypt(output.String())
+		require.NoError(t, err)
+		require.Equal(t, "s3cret", string(plaintext))
+	}
+}
+
+func TestFailingExecute(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		config        *config.Config
+		arguments     []string
+		input         string
+		expectedError string
+	}{
+		{
+			desc:          "Without a subcommand",
+			config:        cfg,
+			arguments:     []string{"config"},
+			expectedError: usage,
+		},
+		{
+			desc:          "With an unknown subcommand",
+			config:        cfg,
+			arguments:     []string{"config", "decrypt"},
+			expectedError: usage,
+		},
+		{
+			desc:          "Without an identity",
+			config:        &config.Config{},
+			arguments:     []string{"config", "encrypt"},
+			input:         "s3cret",
+			expectedError: "identity_file must be set for encrypted values",
+		},
+		{
+			desc:          "Without a value",
+			config:        cfg,
+			arguments:     []string{"config", "encrypt"},
+			input:         "\n",
+			expectedError: "Pass the value to encrypt on standard input\n" + usage,
+		},
+		{
+			desc:          "With a too long value",
+			config:        cfg,
+			arguments:     []string{"config", "encrypt"},
+			input:         strings.Repeat("a", maxValueSize+1),
+			expectedError: "The value must not be longer than 65536 bytes",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     tc.config,
+				Args:       &commandargs.GenericArgs{Arguments: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{In: strings.NewReader(tc.input), Out: output},
+			}
+
+			require.EqualError(t, cmd.Execute(), tc.expectedError)
+			require.Empty(t, output.String())
+		})
+	}
+}
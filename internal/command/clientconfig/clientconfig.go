@@ -0,0 +1,288 @@
+package clientconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/shared/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/lfsauthenticate"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/hostkeys"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/projectid"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/shellquote"
+)
+
+const (
+	shellFormat     = "shell"
+	gitconfigFormat = "gitconfig"
+	jsonFormat      = "json"
+
+	sshCommand = "ssh -o ServerAliveInterval=60 -o ServerAliveCountMax=5"
+
+	usage = "Usage: client-config [<project>] [--format shell|gitconfig|json] [--by-id]"
+)
+
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.Shell
+	ReadWriter *readwriter.ReadWriter
+}
+
+type setting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// clientConfig holds the recommended settings. Repository settings are only
+// known when a project is given.
+type clientConfig struct {
+	Host               string    `json:"host"`
+	Port               int       `json:"port,omitempty"`
+	Project            string    `json:"project,omitempty"`
+	ProjectId          string    `json:"project_id,omitempty"`
+	CloneUrl           string    `json:"clone_url"`
+	GlobalSettings     []setting `json:"global_settings"`
+	RepositorySettings []setting `json:"repository_settings,omitempty"`
+	KnownHosts         []string  `json:"known_hosts,omitempty"`
+}
+
+// options are the arguments of the command. With byId, the clone URL has the
+// project ID as path, so it keeps working when the project is renamed.
+type options struct {
+	project string
+	format  string
+	byId    bool
+}
+
+func (c *Command) Execute() error {
+	opts, err := parseArgs(c.Args.SshArgs[1:])
+	if err != nil {
+		return err
+	}
+
+	cfg, err := c.build(opts)
+	if err != nil {
+		return err
+	}
+
+	switch opts.format {
+	case gitconfigFormat:
+		c.printGitconfig(cfg)
+	case jsonFormat:
+		return json.NewEncoder(c.ReadWriter.Out).Encode(cfg)
+	default:
+		c.printShell(cfg)
+	}
+
+	return nil
+}
+
+func parseArgs(args []string) (*options, error) {
+	opts := &options{}
+
+	flags := flag.NewFlagSet("client-config", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.StringVar(&opts.format, "format", shellFormat, "")
+	flags.BoolVar(&opts.byId, "by-id", false, "")
+
+	// The project comes first, but is also accepted after the flags
+	var positional []string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, errors.New(err.Error() + "\n" + usage)
+	}
+
+	positional = append(positional, flags.Args()...)
+	if len(positional) > 1 {
+		return nil, errors.New("Wrong number of arguments\n" + usage)
+	}
+
+	switch opts.format {
+	case shellFormat, gitconfigFormat, jsonFormat:
+	default:
+		return nil, fmt.Errorf("Unknown format: %s\n%s", opts.format, usage)
+	}
+
+	if len(positional) == 0 {
+		if opts.byId {
+			return nil, errors.New("A project must be given with --by-id\n" + usage)
+		}
+
+		return opts, nil
+	}
+
+	opts.project = strings.TrimSuffix(strings.Trim(positional[0], "/"), ".git")
+
+	return opts, nil
+}
+
+func (c *Command) build(opts *options) (*clientConfig, error) {
+	cfg := &clientConfig{
+		Host:     c.Config.SshHost(),
+		Port:     c.Config.Sshd.Port,
+		Project:  opts.project,
+		CloneUrl: c.Config.SshUrl(c.Config.SshHost(), "<namespace>/<project>"),
+		GlobalSettings: []setting{
+			{Key: "protocol.version", Value: "2"},
+			{Key: "core.sshCommand", Value: sshCommand},
+		},
+	}
+
+	// Host keys are a convenience, the settings are useful without them
+	if keys, err := hostkeys.Load(c.Config.Sshd.HostKeyFiles); err == nil {
+		for _, key := range keys {
+			cfg.KnownHosts = append(cfg.KnownHosts, key.KnownHostsLine(cfg.Host, cfg.Port))
+		}
+	}
+
+	if opts.project == "" {
+		return cfg, nil
+	}
+
+	response, err := c.checkAccess(opts.project)
+	if err != nil {
+		return nil, err
+	}
+
+	cloneUrlPath := opts.project
+	if ref := projectid.FromGlRepository(response.Repo); ref != nil {
+		cfg.ProjectId = ref.Id
+		if opts.byId {
+			cloneUrlPath = ref.Path()
+		}
+	} else if opts.byId {
+		return nil, fmt.Errorf("The ID of %s isn't known", opts.project)
+	}
+
+	cfg.CloneUrl = c.Config.SshUrl(cfg.Host, cloneUrlPath)
+	cfg.RepositorySettings = []setting{{Key: "remote.origin.url", Value: cfg.CloneUrl}}
+
+	lfsUrl, err := c.lfsUrl(opts.project, response)
+	if err != nil {
+		return nil, err
+	}
+
+	if lfsUrl != "" {
+		cfg.RepositorySettings = append(cfg.RepositorySettings, setting{Key: "lfs.url", Value: lfsUrl})
+	}
+
+	return cfg, nil
+}
+
+// checkAccess asks GitLab whether the project can be read. It's verified like
+// a clone, so probing for projects is blocked and rate limited like clones.
+func (c *Command) checkAccess(project string) (*accessverifier.Response, error) {
+	cmd := accessverifier.Command{Config: c.Config, Args: c.Args, ReadWriter: c.ReadWriter}
+
+	return cmd.Verify(commandargs.UploadPack, project)
+}
+
+// The LFS endpoint is only known to GitLab. The token that comes with it
+// isn't printed, git-lfs fetches its own.
+func (c *Command) lfsUrl(project string, response *accessverifier.Response) (string, error) {
+	client, err := lfsauthenticate.NewClient(c.Config, c.Args)
+	if err != nil {
+		return "", err
+	}
+
+	lfs, err := client.Authenticate("download", project, response.UserId)
+	if err != nil {
+		// The project can still be used without LFS
+		return "", nil
+	}
+
+	return lfs.RepoPath + "/info/lfs", nil
+}
+
+func (c *Command) printShell(cfg *clientConfig) {
+	out := c.ReadWriter.Out
+
+	fmt.Fprintf(out, "# Recommended git settings for %s\n", cfg.Host)
+	for _, s := range cfg.GlobalSettings {
+		fmt.Fprintf(out, "git config --global %s %s\n", s.Key, shellquote.Quote(s.Value))
+	}
+
+	if cfg.Project == "" {
+		fmt.Fprintf(out, "\n# Clone a project\ngit clone %s\n", shellquote.Quote(cfg.CloneUrl))
+	} else {
+		dir := path.Base(cfg.Project)
+
+		fmt.Fprintf(out, "\n# Clone %s\ngit clone %s", cfg.Project, shellquote.Quote(cfg.CloneUrl))
+
+		// A project ID URL would be cloned into a directory named after the ID
+		if strings.TrimSuffix(path.Base(cfg.CloneUrl), ".git") != dir {
+			fmt.Fprintf(out, " %s", shellquote.Quote(dir))
+		}
+		fmt.Fprintln(out)
+		for _, s := range cfg.RepositorySettings {
+			if s.Key == "remote.origin.url" {
+				continue
+			}
+
+			fmt.Fprintf(out, "git -C %s config %s %s\n", shellquote.Quote(dir), s.Key, shellquote.Quote(s.Value))
+		}
+	}
+
+	if len(cfg.KnownHosts) > 0 {
+		fmt.Fprintln(out, "\n# Trust the host keys of the server")
+		fmt.Fprintln(out, "mkdir -p ~/.ssh && cat >> ~/.ssh/known_hosts <<'EOF'")
+		for _, line := range cfg.KnownHosts {
+			fmt.Fprintln(out, line)
+		}
+		fmt.Fprintln(out, "EOF")
+	}
+}
+
+func (c *Command) printGitconfig(cfg *clientConfig) {
+	out := c.ReadWriter.Out
+
+	fmt.Fprintf(out, "# Recommended ~/.gitconfig settings for %s\n", cfg.Host)
+	printSections(out, cfg.GlobalSettings)
+
+	if cfg.Project != "" {
+		fmt.Fprintf(out, "\n# Recommended .git/config settings for %s\n", cfg.Project)
+		printSections(out, cfg.RepositorySettings)
+	}
+
+	if len(cfg.KnownHosts) > 0 {
+		fmt.Fprintln(out, "\n# Lines for ~/.ssh/known_hosts")
+		for _, line := range cfg.KnownHosts {
+			fmt.Fprintf(out, "# %s\n", line)
+		}
+	}
+}
+
+// printSections groups settings by section in their original order, e.g.
+// remote.origin.url is printed as url in [remote "origin"].
+func printSections(out io.Writer, settings []setting) {
+	current := ""
+
+	for _, s := range settings {
+		dot := strings.LastIndex(s.Key, ".")
+		section, name := s.Key[:dot], s.Key[dot+1:]
+
+		if section != current {
+			header := section
+			if i := strings.Index(section, "."); i >= 0 {
+				header = fmt.Sprintf("%s %q", section[:i], section[i+1:])
+			}
+
+			fmt.Fprintf(out, "[%s]\n", header)
+			current = section
+		}
+
+		fmt.Fprintf(out, "\t%s = %s\n", name, s.Value)
+	}
+}
@@ -0,0 +1,323 @@
+package clientconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
+)
+
+const (
+	knownHostsLine = "[gitlab.example.com]:2222 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIYJb/hz8JexXKsDYZ0rNU+K/qZJN5LWE3o4zzsFGkPY"
+)
+
+var (
+	requests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/allowed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				var request *accessverifier.Request
+				json.Unmarshal(b, &request)
+
+				if request.Repo != "group/project" && request.Repo != "group/no-lfs" {
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(map[string]interface{}{"status": false, "message": "The project you were looking for could not be found."})
+					return
+				}
+
+				body := map[string]interface{}{"status": true, "gl_id": "user-1"}
+				if request.Repo == "group/project" {
+					body["gl_repository"] = "project-42"
+				}
+
+				json.NewEncoder(w).Encode(body)
+			},
+		},
+		{
+			Path: "/api/v4/internal/lfs_authenticate",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				if err != nil || !bytes.Contains(b, []byte(`"project":"group/project"`)) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"username":             "john",
+					"lfs_token":            "secret-token",
+					"repository_http_path": "https://gitlab.example.com/group/project.git",
+					"expires_in":           1800,
+				})
+			},
+		},
+	}
+)
+
+func buildConfig(url string, port int) *config.Config {
+	return &config.Config{
+		GitlabUrl: url,
+		Sshd: config.SshdConfig{
+			User:         "git",
+			Host:         "gitlab.example.com",
+			Port:         port,
+			HostKeyFiles: []string{path.Join(testhelper.TestRoot, "hostkeys/ssh_host_ed25519_key.pub")},
+		},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	cleanup, err := testhelper.PrepareTestRootDir()
+	require.NoError(t, err)
+	defer cleanup()
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	testCases := []struct {
+		desc           string
+		port           int
+		arguments      []string
+		expectedOutput string
+	}{
+		{
+			desc:      "Without a project",
+			port:      22,
+			arguments: []string{"client-config"},
+			expectedOutput: "# Recommended git settings for gitlab.example.com\n" +
+				"git config --global protocol.version 2\n" +
+				"git config --global core.sshCommand 'ssh -o ServerAliveInterval=60 -o ServerAliveCountMax=5'\n" +
+				"\n# Clone a project\n" +
+				"git clone 'git@gitlab.example.com:<namespace>/<project>.git'\n" +
+				"\n# Trust the host keys of the server\n" +
+				"mkdir -p ~/.ssh && cat >> ~/.ssh/known_hosts <<'EOF'\n" +
+				"gitlab.example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIYJb/hz8JexXKsDYZ0rNU+K/qZJN5LWE3o4zzsFGkPY\n" +
+				"EOF\n",
+		},
+		{
+			desc:      "With a project",
+			port:      2222,
+			arguments: []string{"client-config", "/group/project.git"},
+			expectedOutput: "# Recommended git settings for gitlab.example.com\n" +
+				"git config --global protocol.version 2\n" +
+				"git config --global core.sshCommand 'ssh -o ServerAliveInterval=60 -o ServerAliveCountMax=5'\n" +
+				"\n# Clone group/project\n" +
+				"git clone ssh://git@gitlab.example.com:2222/group/project.git\n" +
+				"git -C project config lfs.url https://gitlab.example.com/group/project.git/info/lfs\n" +
+				"\n# Trust the host keys of the server\n" +
+				"mkdir -p ~/.ssh && cat >> ~/.ssh/known_hosts <<'EOF'\n" +
+				knownHostsLine + "\n" +
+				"EOF\n",
+		},
+		{
+			desc:      "With a project without LFS",
+			port:      2222,
+			arguments: []string{"client-config", "group/no-lfs", "--format", "gitconfig"},
+			expectedOutput: "# Recommended ~/.gitconfig settings for gitlab.example.com\n" +
+				"[protocol]\n\tversion = 2\n" +
+				"[core]\n\tsshCommand = ssh -o ServerAliveInterval=60 -o ServerAliveCountMax=5\n" +
+				"\n# Recommended .git/config settings for group/no-lfs\n" +
+				"[remote \"origin\"]\n\turl = ssh://git@gitlab.example.com:2222/group/no-lfs.git\n" +
+				"\n# Lines for ~/.ssh/known_hosts\n" +
+				"# " + knownHostsLine + "\n",
+		},
+		{
+			desc:      "With the gitconfig format",
+			port:      2222,
+			arguments: []string{"client-config", "--format=gitconfig", "group/project"},
+			expectedOutput: "# Recommended ~/.gitconfig settings for gitlab.example.com\n" +
+				"[protocol]\n\tversion = 2\n" +
+				"[core]\n\tsshCommand = ssh -o ServerAliveInterval=60 -o ServerAliveCountMax=5\n" +
+				"\n# Recommended .git/config settings for group/project\n" +
+				"[remote \"origin\"]\n\turl = ssh://git@gitlab.example.com:2222/group/project.git\n" +
+				"[lfs]\n\turl = https://gitlab.example.com/group/project.git/info/lfs\n" +
+				"\n# Lines for ~/.ssh/known_hosts\n" +
+				"# " + knownHostsLine + "\n",
+		},
+		{
+			desc:      "With a URL by project ID",
+			port:      2222,
+			arguments: []string{"client-config", "group/project", "--by-id"},
+			expectedOutput: "# Recommended git settings for gitlab.example.com\n" +
+				"git config --global protocol.version 2\n" +
+				"git config --global core.sshCommand 'ssh -o ServerAliveInterval=60 -o ServerAliveCountMax=5'\n" +
+				"\n# Clone group/project\n" +
+				"git clone ssh://git@gitlab.example.com:2222/project-id/42.git project\n" +
+				"git -C project config lfs.url https://gitlab.example.com/group/project.git/info/lfs\n" +
+				"\n# Trust the host keys of the server\n" +
+				"mkdir -p ~/.ssh && cat >> ~/.ssh/known_hosts <<'EOF'\n" +
+				knownHostsLine + "\n" +
+				"EOF\n",
+		},
+		{
+			desc:      "With a URL by project ID in the gitconfig format",
+			port:      22,
+			arguments: []string{"client-config", "--by-id", "--format=gitconfig", "group/project"},
+			expectedOutput: "# Recommended ~/.gitconfig settings for gitlab.example.com\n" +
+				"[protocol]\n\tversion = 2\n" +
+				"[core]\n\tsshCommand = ssh -o ServerAliveInterval=60 -o ServerAliveCountMax=5\n" +
+				"\n# Recommended .git/config settings for group/project\n" +
+				"[remote \"origin\"]\n\turl = git@gitlab.example.com:project-id/42.git\n" +
+				"[lfs]\n\turl = https://gitlab.example.com/group/project.git/info/lfs\n" +
+				"\n# Lines for ~/.ssh/known_hosts\n" +
+				"# gitlab.example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIYJb/hz8JexXKsDYZ0rNU+K/qZJN5LWE3o4zzsFGkPY\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     buildConfig(url, tc.port),
+				Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: output, ErrOut: &bytes.Buffer{}},
+			}
+
+			require.NoError(t, cmd.Execute())
+			require.Equal(t, tc.expectedOutput, output.String())
+			require.NotContains(t, output.String(), "secret-token")
+		})
+	}
+}
+
+func TestExecuteJson(t *testing.T) {
+	cleanup, err := testhelper.PrepareTestRootDir()
+	require.NoError(t, err)
+	defer cleanup()
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	output := &bytes.Buffer{}
+	cmd := &Command{
+		Config:     buildConfig(url, 2222),
+		Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: []string{"client-config", "group/project", "--format", "json"}},
+		ReadWriter: &readwriter.ReadWriter{Out: output, ErrOut: &bytes.Buffer{}},
+	}
+
+	require.NoError(t, cmd.Execute())
+
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(output.Bytes(), &result))
+
+	require.Equal(t, map[string]interface{}{
+		"host":       "gitlab.example.com",
+		"port":       float64(2222),
+		"project":    "group/project",
+		"project_id": "42",
+		"clone_url":  "ssh://git@gitlab.example.com:2222/group/project.git",
+		"global_settings": []interface{}{
+			map[string]interface{}{"key": "protocol.version", "value": "2"},
+			map[string]interface{}{"key": "core.sshCommand", "value": "ssh -o ServerAliveInterval=60 -o ServerAliveCountMax=5"},
+		},
+		"repository_settings": []interface{}{
+			map[string]interface{}{"key": "remote.origin.url", "value": "ssh://git@gitlab.example.com:2222/group/project.git"},
+			map[string]interface{}{"key": "lfs.url", "value": "https://gitlab.example.com/group/project.git/info/lfs"},
+		},
+		"known_hosts": []interface{}{knownHostsLine},
+	}, result)
+}
+
+func TestFailingExecute(t *testing.T) {
+	cleanup, err := testhelper.PrepareTestRootDir()
+	require.NoError(t, err)
+	defer cleanup()
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		arguments     []string
+		expectedError string
+	}{
+		{
+			desc:          "With an unknown format",
+			arguments:     []string{"client-config", "--format", "yaml"},
+			expectedError: "Unknown format: yaml\n" + usage,
+		},
+		{
+			desc:          "With too many arguments",
+			arguments:     []string{"client-config", "group/project", "group/other"},
+			expectedError: "Wrong number of arguments\n" + usage,
+		},
+		{
+			desc:          "With an unknown project",
+			arguments:     []string{"client-config", "group/unknown"},
+			expectedError: "The project you were looking for could not be found.",
+		},
+		{
+			desc:          "With a URL by project ID without a project",
+			arguments:     []string{"client-config", "--by-id"},
+			expectedError: "A project must be given with --by-id\n" + usage,
+		},
+		{
+			desc:          "With a URL by project ID for a project without ID",
+			arguments:     []string{"client-config", "group/no-lfs", "--by-id"},
+			expectedError: "The ID of group/no-lfs isn't known",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     buildConfig(url, 22),
+				Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: output, ErrOut: &bytes.Buffer{}},
+			}
+
+			require.EqualError(t, cmd.Execute(), tc.expectedError)
+			require.Empty(t, output.String())
+		})
+	}
+}
+
+func TestRepeatedDenialsAreBlocked(t *testing.T) {
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	stateDir, err := ioutil.TempDir("", "gitlab-shell-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(stateDir)
+
+	cfg := buildConfig(url, 22)
+	cfg.StateDir = stateDir
+	cfg.DenialBlocking = config.DenialBlockingConfig{Enabled: true, MaxDenials: 2, WindowSeconds: 60, BlockDurationSeconds: 600}
+
+	execute := func(project string) error {
+		cmd := &Command{
+			Config:     cfg,
+			Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: []string{"client-config", project}},
+			ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}},
+		}
+
+		return cmd.Execute()
+	}
+
+	for i := 0; i < 2; i++ {
+		require.EqualError(t, execute("group/unknown"), "The project you were looking for could not be found.")
+	}
+
+	// Existing projects can't be told apart from missing ones anymore
+	err = execute("group/project")
+	require.Error(t, err)
+	require.Regexp(t, `\AToo many of your requests were denied`, err.Error())
+}
@@ -1,19 +1,37 @@
 package command
 
 import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/accessgrant"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/authorizedkeys"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/authorizedprincipals"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/blocks"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/certificate"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/checkconfig"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/clientconfig"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/discover"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/enroll"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/healthcheck"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/hostkeys"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/job"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/lfsauthenticate"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/logpseudonyms"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/plugin"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/principals"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/receivepack"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/shared/disallowedcommand"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/twofactorenable"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/twofactorrecover"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/uploadarchive"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/uploadpack"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/console"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/executable"
 )
 
@@ -21,6 +39,12 @@ type Command interface {
 	Execute() error
 }
 
+// ExitCoder is implemented by errors of commands that need gitlab-shell to
+// exit with a specific status, e.g. the one of a plugin.
+type ExitCoder interface {
+	ExitCode() int
+}
+
 func New(e *executable.Executable, arguments []string, config *config.Config, readWriter *readwriter.ReadWriter) (Command, error) {
 	args, err := commandargs.Parse(e, arguments)
 	if err != nil {
@@ -43,22 +67,87 @@ func buildCommand(e *executable.Executable, args commandargs.CommandArgs, config
 	case executable.AuthorizedPrincipalsCheck:
 		return buildAuthorizedPrincipalsCommand(args.(*commandargs.AuthorizedPrincipals), config, readWriter)
 	case executable.Healthcheck:
-		return buildHealthcheckCommand(config, readWriter)
+		return buildHealthcheckCommand(args.(*commandargs.GenericArgs), config, readWriter)
+	case executable.LogPseudonyms:
+		return &logpseudonyms.Command{Config: config, Args: args.(*commandargs.GenericArgs), ReadWriter: readWriter}
 	}
 
 	return nil
 }
 
 func buildShellCommand(args *commandargs.Shell, config *config.Config, readWriter *readwriter.ReadWriter) Command {
+	if !args.IsCommandAllowed() {
+		reportRestrictedCommand(args, readWriter)
+		return nil
+	}
+
+	if args.IsAnonymous() {
+		return buildAnonymousShellCommand(args, config, readWriter)
+	}
+
 	switch args.CommandType {
 	case commandargs.Discover:
 		return &discover.Command{Config: config, Args: args, ReadWriter: readWriter}
 	case commandargs.TwoFactorRecover:
 		return &twofactorrecover.Command{Config: config, Args: args, ReadWriter: readWriter}
+	case commandargs.TwoFactorEnable:
+		return &twofactorenable.Command{Config: config, Args: args, ReadWriter: readWriter}
 	case commandargs.LfsAuthenticate:
 		return &lfsauthenticate.Command{Config: config, Args: args, ReadWriter: readWriter}
 	case commandargs.ReceivePack:
 		return &receivepack.Command{Config: config, Args: args, ReadWriter: readWriter}
+	case commandargs.UploadPack:
+		return &uploadpack.Command{Config: config, Args: args, ReadWriter: readWriter}
+	case commandargs.UploadArchive:
+		return &uploadarchive.Command{Config: config, Args: args, ReadWriter: readWriter}
+	case commandargs.AccessGrant:
+		return &accessgrant.Command{Config: config, Args: args, ReadWriter: readWriter}
+	case commandargs.ClientConfig:
+		return &clientconfig.Command{Config: config, Args: args, ReadWriter: readWriter}
+	case commandargs.Certificate:
+		return &certificate.Command{Config: config, Args: args, ReadWriter: readWriter}
+	case commandargs.Job:
+		return &job.Command{Config: config, Args: args, ReadWriter: readWriter}
+	}
+
+	if p := plugin.Find(config, args.CommandType); p != nil {
+		return &plugin.Command{Config: config, Args: args, ReadWriter: readWriter, Plugin: p}
+	}
+
+	return nil
+}
+
+func reportRestrictedCommand(args *commandargs.Shell, readWriter *readwriter.ReadWriter) {
+	var allowed []string
+	for _, command := range args.AllowedCommands {
+		allowed = append(allowed, string(command))
+	}
+
+	log.WithFields(log.Fields{
+		"command":          string(args.CommandType),
+		"allowed_commands": allowed,
+		"gl_key_id":        args.GitlabKeyId,
+		"username":         args.GitlabUsername,
+	}).Warn("Command not allowed for SSH key")
+
+	console.DisplayWarningMessages([]string{
+		fmt.Sprintf("This SSH key can only run: %s.", strings.Join(allowed, ", ")),
+		fmt.Sprintf("Use another SSH key to run %s.", args.CommandType),
+	}, readWriter.ErrOut)
+}
+
+// Unknown keys are only allowed to fetch from public projects, and to enroll
+// themselves as deploy keys
+func buildAnonymousShellCommand(args *commandargs.Shell, config *config.Config, readWriter *readwriter.ReadWriter) Command {
+	if args.CommandType == commandargs.Enroll && config.Enrollment.Enabled {
+		return &enroll.Command{Config: config, Args: args, ReadWriter: readWriter}
+	}
+
+	if !config.AnonymousSsh.Enabled {
+		return nil
+	}
+
+	switch args.CommandType {
 	case commandargs.UploadPack:
 		return &uploadpack.Command{Config: config, Args: args, ReadWriter: readWriter}
 	case commandargs.UploadArchive:
@@ -76,6 +165,21 @@ func buildAuthorizedPrincipalsCommand(args *commandargs.AuthorizedPrincipals, co
 	return &authorizedprincipals.Command{Config: config, Args: args, ReadWriter: readWriter}
 }
 
-func buildHealthcheckCommand(config *config.Config, readWriter *readwriter.ReadWriter) Command {
-	return &healthcheck.Command{Config: config, ReadWriter: readWriter}
+func buildHealthcheckCommand(args *commandargs.GenericArgs, config *config.Config, readWriter *readwriter.ReadWriter) Command {
+	if len(args.Arguments) == 0 {
+		return &healthcheck.Command{Config: config, ReadWriter: readWriter}
+	}
+
+	switch commandargs.CommandType(args.Arguments[0]) {
+	case commandargs.CheckHostKeys:
+		return &hostkeys.Command{Config: config, Args: args, ReadWriter: readWriter}
+	case commandargs.CheckPrincipals:
+		return &principals.Command{Config: config, Args: args, ReadWriter: readWriter}
+	case commandargs.CheckBlocks:
+		return &blocks.Command{Config: config, Args: args, ReadWriter: readWriter}
+	case commandargs.CheckConfig:
+		return &checkconfig.Command{Config: config, Args: args, ReadWriter: readWriter}
+	}
+
+	return nil
 }
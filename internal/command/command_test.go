@@ -1,18 +1,32 @@
 package command
 
 import (
+	"bytes"
 	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/accessgrant"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/authorizedkeys"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/authorizedprincipals"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/blocks"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/certificate"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/checkconfig"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/clientconfig"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/discover"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/enroll"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/healthcheck"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/hostkeys"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/job"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/lfsauthenticate"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/logpseudonyms"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/plugin"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/principals"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/receivepack"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/shared/disallowedcommand"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/twofactorenable"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/twofactorrecover"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/uploadarchive"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/uploadpack"
@@ -26,8 +40,11 @@ var (
 	authorizedPrincipalsExec = &executable.Executable{Name: executable.AuthorizedPrincipalsCheck}
 	checkExec                = &executable.Executable{Name: executable.Healthcheck}
 	gitlabShellExec          = &executable.Executable{Name: executable.GitlabShell}
+	logPseudonymsExec        = &executable.Executable{Name: executable.LogPseudonyms}
 
-	basicConfig = &config.Config{GitlabUrl: "http+unix://gitlab.socket"}
+	basicConfig     = &config.Config{GitlabUrl: "http+unix://gitlab.socket"}
+	anonymousConfig = &config.Config{GitlabUrl: "http+unix://gitlab.socket", AnonymousSsh: config.AnonymousSshConfig{Enabled: true}}
+	enrollConfig    = &config.Config{GitlabUrl: "http+unix://gitlab.socket", Enrollment: config.EnrollmentConfig{Enabled: true}}
 )
 
 func buildEnv(command string) map[string]string {
@@ -57,12 +74,31 @@ func TestNew(t *testing.T) {
 			environment:  buildEnv("2fa_recovery_codes"),
 			expectedType: &twofactorrecover.Command{},
 		},
+		{
+			desc:         "it returns a TwoFactorEnable command",
+			executable:   gitlabShellExec,
+			environment:  buildEnv("2fa_enable"),
+			expectedType: &twofactorenable.Command{},
+		},
 		{
 			desc:         "it returns an LfsAuthenticate command",
 			executable:   gitlabShellExec,
 			environment:  buildEnv("git-lfs-authenticate"),
 			expectedType: &lfsauthenticate.Command{},
 		},
+		{
+			desc:         "it returns a ClientConfig command",
+			executable:   gitlabShellExec,
+			environment:  buildEnv("client-config"),
+			expectedType: &clientconfig.Command{},
+		},
+		{
+			desc:         "it returns an LfsAuthenticate command for a key restricted to it",
+			executable:   gitlabShellExec,
+			environment:  buildEnv("git-lfs-authenticate"),
+			arguments:    []string{"key-1", "allowed-commands=git-lfs-authenticate"},
+			expectedType: &lfsauthenticate.Command{},
+		},
 		{
 			desc:         "it returns a ReceivePack command",
 			executable:   gitlabShellExec,
@@ -81,11 +117,59 @@ func TestNew(t *testing.T) {
 			environment:  buildEnv("git-upload-archive"),
 			expectedType: &uploadarchive.Command{},
 		},
+		{
+			desc:         "it returns an AccessGrant command",
+			executable:   gitlabShellExec,
+			environment:  buildEnv("grant list group/repo"),
+			expectedType: &accessgrant.Command{},
+		},
+		{
+			desc:         "it returns a Certificate command",
+			executable:   gitlabShellExec,
+			environment:  buildEnv("cert issue"),
+			expectedType: &certificate.Command{},
+		},
+		{
+			desc:         "it returns a Job command",
+			executable:   gitlabShellExec,
+			environment:  buildEnv("job log group/repo 1"),
+			expectedType: &job.Command{},
+		},
 		{
 			desc:         "it returns a Healthcheck command",
 			executable:   checkExec,
 			expectedType: &healthcheck.Command{},
 		},
+		{
+			desc:         "it returns a HostKeys command",
+			executable:   checkExec,
+			arguments:    []string{"hostkeys"},
+			expectedType: &hostkeys.Command{},
+		},
+		{
+			desc:         "it returns a Principals command",
+			executable:   checkExec,
+			arguments:    []string{"principals", "principal"},
+			expectedType: &principals.Command{},
+		},
+		{
+			desc:         "it returns a Blocks command",
+			executable:   checkExec,
+			arguments:    []string{"blocks", "list"},
+			expectedType: &blocks.Command{},
+		},
+		{
+			desc:         "it returns a CheckConfig command",
+			executable:   checkExec,
+			arguments:    []string{"config", "encrypt"},
+			expectedType: &checkconfig.Command{},
+		},
+		{
+			desc:         "it returns a LogPseudonyms command",
+			executable:   logPseudonymsExec,
+			arguments:    []string{"lookup", "username", "p1-0123456789abcdef"},
+			expectedType: &logpseudonyms.Command{},
+		},
 		{
 			desc:         "it returns a AuthorizedKeys command",
 			executable:   authorizedKeysExec,
@@ -113,24 +197,221 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewPlugin(t *testing.T) {
+	pluginConfig := &config.Config{
+		GitlabUrl: "http+unix://gitlab.socket",
+		Plugins: []config.PluginConfig{
+			{Name: "deploy", Executable: "/opt/plugins/deploy"},
+			{Name: "git-upload-pack", Executable: "/opt/plugins/upload-pack"},
+		},
+	}
+
+	testCases := []struct {
+		desc         string
+		arguments    []string
+		environment  map[string]string
+		expectedType interface{}
+	}{
+		{
+			desc:         "it returns a Plugin command",
+			arguments:    []string{"key-1"},
+			environment:  buildEnv("deploy production"),
+			expectedType: &plugin.Command{},
+		},
+		{
+			desc:         "it doesn't let plugins shadow built-in commands",
+			arguments:    []string{"key-1"},
+			environment:  buildEnv("git-upload-pack"),
+			expectedType: &uploadpack.Command{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			restoreEnv := testhelper.TempEnv(tc.environment)
+			defer restoreEnv()
+
+			command, err := New(gitlabShellExec, tc.arguments, pluginConfig, nil)
+
+			require.NoError(t, err)
+			require.IsType(t, tc.expectedType, command)
+		})
+	}
+
+	restoreEnv := testhelper.TempEnv(buildEnv("deploy production"))
+	defer restoreEnv()
+
+	command, err := New(gitlabShellExec, []string{"anonymous"}, pluginConfig, nil)
+	require.Nil(t, command)
+	require.Equal(t, disallowedcommand.Error, err)
+}
+
+func TestNewAnonymous(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		environment  map[string]string
+		expectedType interface{}
+	}{
+		{
+			desc:         "it returns an UploadPack command",
+			environment:  buildEnv("git-upload-pack"),
+			expectedType: &uploadpack.Command{},
+		},
+		{
+			desc:         "it returns an UploadArchive command",
+			environment:  buildEnv("git-upload-archive"),
+			expectedType: &uploadarchive.Command{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			restoreEnv := testhelper.TempEnv(tc.environment)
+			defer restoreEnv()
+
+			command, err := New(gitlabShellExec, []string{"anonymous"}, anonymousConfig, nil)
+
+			require.NoError(t, err)
+			require.IsType(t, tc.expectedType, command)
+		})
+	}
+}
+
+func TestNewEnroll(t *testing.T) {
+	restoreEnv := testhelper.TempEnv(buildEnv("enroll 1a2b3c"))
+	defer restoreEnv()
+
+	command, err := New(gitlabShellExec, []string{"anonymous", "allowed-commands=enroll"}, enrollConfig, nil)
+
+	require.NoError(t, err)
+	require.IsType(t, &enroll.Command{}, command)
+}
+
+func TestFailingNewAnonymous(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		config      *config.Config
+		environment map[string]string
+	}{
+		{
+			desc:        "Anonymous access is disabled",
+			config:      basicConfig,
+			environment: buildEnv("git-upload-pack"),
+		},
+		{
+			desc:        "Anonymous push",
+			config:      anonymousConfig,
+			environment: buildEnv("git-receive-pack"),
+		},
+		{
+			desc:        "Anonymous LFS authentication",
+			config:      anonymousConfig,
+			environment: buildEnv("git-lfs-authenticate"),
+		},
+		{
+			desc:        "Anonymous discover",
+			config:      anonymousConfig,
+			environment: buildEnv(""),
+		},
+		{
+			desc:        "Anonymous recovery codes",
+			config:      anonymousConfig,
+			environment: buildEnv("2fa_recovery_codes"),
+		},
+		{
+			desc:        "Enrollment is disabled",
+			config:      anonymousConfig,
+			environment: buildEnv("enroll 1a2b3c"),
+		},
+		{
+			desc:        "Anonymous fetch with enrollment only",
+			config:      enrollConfig,
+			environment: buildEnv("git-upload-pack"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			restoreEnv := testhelper.TempEnv(tc.environment)
+			defer restoreEnv()
+
+			command, err := New(gitlabShellExec, []string{"anonymous"}, tc.config, nil)
+			require.Nil(t, command)
+			require.Equal(t, disallowedcommand.Error, err)
+		})
+	}
+}
+
+func TestFailingNewRestricted(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		arguments      []string
+		command        string
+		expectedOutput string
+	}{
+		{
+			desc:           "Push with an LFS-only key",
+			arguments:      []string{"key-1", "allowed-commands=git-lfs-authenticate"},
+			command:        "git-receive-pack",
+			expectedOutput: "This SSH key can only run: git-lfs-authenticate.",
+		},
+		{
+			desc:           "Clone with an archive and LFS key",
+			arguments:      []string{"key-1", "allowed-commands=git-upload-archive,git-lfs-authenticate"},
+			command:        "git-upload-pack",
+			expectedOutput: "This SSH key can only run: git-upload-archive, git-lfs-authenticate.",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			restoreEnv := testhelper.TempEnv(buildEnv(tc.command + " group/repo"))
+			defer restoreEnv()
+
+			hook := testhelper.SetupLogger()
+			errOut := &bytes.Buffer{}
+
+			command, err := New(gitlabShellExec, tc.arguments, basicConfig, &readwriter.ReadWriter{ErrOut: errOut})
+			require.Nil(t, command)
+			require.Equal(t, disallowedcommand.Error, err)
+
+			require.Contains(t, errOut.String(), tc.expectedOutput)
+			require.Contains(t, errOut.String(), "Use another SSH key to run "+tc.command+".")
+
+			require.True(t, testhelper.WaitForLogEvent(hook))
+			require.Contains(t, hook.LastEntry().Message, "Command not allowed for SSH key")
+			require.Contains(t, hook.LastEntry().Message, "gl_key_id=1")
+		})
+	}
+}
+
 func TestFailingNew(t *testing.T) {
 	testCases := []struct {
 		desc          string
 		executable    *executable.Executable
 		environment   map[string]string
+		arguments     []string
 		expectedError error
 	}{
 		{
 			desc:          "Parsing environment failed",
 			executable:    gitlabShellExec,
+			arguments:     []string{},
 			expectedError: errors.New("Only SSH allowed"),
 		},
 		{
 			desc:          "Unknown command given",
 			executable:    gitlabShellExec,
+			arguments:     []string{},
 			environment:   buildEnv("unknown"),
 			expectedError: disallowedcommand.Error,
 		},
+		{
+			desc:          "Unknown check given",
+			executable:    checkExec,
+			arguments:     []string{"unknown"},
+			expectedError: disallowedcommand.Error,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -138,7 +419,7 @@ func TestFailingNew(t *testing.T) {
 			restoreEnv := testhelper.TempEnv(tc.environment)
 			defer restoreEnv()
 
-			command, err := New(tc.executable, []string{}, basicConfig, nil)
+			command, err := New(tc.executable, tc.arguments, basicConfig, nil)
 			require.Nil(t, command)
 			require.Equal(t, tc.expectedError, err)
 		})
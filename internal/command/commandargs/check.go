@@ -0,0 +1,10 @@
+package commandargs
+
+// Subcommands of the check executable. Without a subcommand, check verifies
+// the connection to the internal API.
+const (
+	CheckHostKeys   CommandType = "hostkeys"
+	CheckPrincipals CommandType = "principals"
+	CheckBlocks     CommandType = "blocks"
+	CheckConfig     CommandType = "config"
+)
@@ -47,6 +47,39 @@ func TestParseSuccess(t *testing.T) {
 			},
 			arguments:    []string{"hello", "username-jane-doe"},
 			expectedArgs: &Shell{Arguments: []string{"hello", "username-jane-doe"}, SshArgs: []string{}, CommandType: Discover, GitlabUsername: "jane-doe"},
+		}, {
+			desc:       "It doesn't take a key id out of a username",
+			executable: &executable.Executable{Name: executable.GitlabShell},
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "",
+			},
+			arguments:    []string{"username-jane-key-1"},
+			expectedArgs: &Shell{Arguments: []string{"username-jane-key-1"}, SshArgs: []string{}, CommandType: Discover, GitlabUsername: "jane-key-1"},
+		}, {
+			desc:       "It recognises an anonymous identity in any passed arguments",
+			executable: &executable.Executable{Name: executable.GitlabShell},
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-upload-pack group/repo",
+			},
+			arguments:    []string{"anonymous"},
+			expectedArgs: &Shell{Arguments: []string{"anonymous"}, SshArgs: []string{"git-upload-pack", "group/repo"}, CommandType: UploadPack, Anonymous: true},
+		}, {
+			desc:       "It parses the commands allowed for the key",
+			executable: &executable.Executable{Name: executable.GitlabShell},
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-lfs-authenticate group/repo download",
+			},
+			arguments: []string{"key-123", "allowed-commands=git-lfs-authenticate,git-upload-archive"},
+			expectedArgs: &Shell{
+				Arguments:       []string{"key-123", "allowed-commands=git-lfs-authenticate,git-upload-archive"},
+				SshArgs:         []string{"git-lfs-authenticate", "group/repo", "download"},
+				CommandType:     LfsAuthenticate,
+				GitlabKeyId:     "123",
+				AllowedCommands: []CommandType{LfsAuthenticate, UploadArchive},
+			},
 		}, {
 			desc:       "It parses 2fa_recovery_codes command",
 			executable: &executable.Executable{Name: executable.GitlabShell},
@@ -229,3 +262,43 @@ func TestParseFailure(t *testing.T) {
 		})
 	}
 }
+
+func TestIsCommandAllowed(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		args     *Shell
+		expected bool
+	}{
+		{
+			desc:     "Without restrictions",
+			args:     &Shell{CommandType: ReceivePack},
+			expected: true,
+		},
+		{
+			desc:     "With an allowed command",
+			args:     &Shell{CommandType: UploadArchive, AllowedCommands: []CommandType{LfsAuthenticate, UploadArchive}},
+			expected: true,
+		},
+		{
+			desc:     "With a disallowed command",
+			args:     &Shell{CommandType: ReceivePack, AllowedCommands: []CommandType{LfsAuthenticate}},
+			expected: false,
+		},
+		{
+			desc:     "With no allowed commands",
+			args:     &Shell{CommandType: UploadPack, AllowedCommands: []CommandType{}},
+			expected: false,
+		},
+		{
+			desc:     "With discover",
+			args:     &Shell{CommandType: Discover, AllowedCommands: []CommandType{LfsAuthenticate}},
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.args.IsCommandAllowed())
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"regexp"
+	"strings"
 
 	"github.com/mattn/go-shellwords"
 )
@@ -11,25 +12,44 @@ import (
 const (
 	Discover         CommandType = "discover"
 	TwoFactorRecover CommandType = "2fa_recovery_codes"
+	TwoFactorEnable  CommandType = "2fa_enable"
 	LfsAuthenticate  CommandType = "git-lfs-authenticate"
 	ReceivePack      CommandType = "git-receive-pack"
 	UploadPack       CommandType = "git-upload-pack"
 	UploadArchive    CommandType = "git-upload-archive"
+	AccessGrant      CommandType = "grant"
+	ClientConfig     CommandType = "client-config"
+	Certificate      CommandType = "cert"
+	Enroll           CommandType = "enroll"
+	Job              CommandType = "job"
 
 	GitProtocolEnv = "GIT_PROTOCOL"
 )
 
 var (
 	whoKeyRegex      = regexp.MustCompile(`\bkey-(?P<keyid>\d+)\b`)
-	whoUsernameRegex = regexp.MustCompile(`\busername-(?P<username>\S+)\b`)
+	whoUsernameRegex = regexp.MustCompile(`\Ausername-(?P<username>\S+)\z`)
+	anonymousRegex   = regexp.MustCompile(`\Aanonymous\z`)
+
+	allowedCommandsRegex = regexp.MustCompile(`\Aallowed-commands=(?P<commands>\S+)\z`)
+
+	builtinCommands = []CommandType{
+		Discover, TwoFactorRecover, TwoFactorEnable, LfsAuthenticate, ReceivePack,
+		UploadPack, UploadArchive, AccessGrant, ClientConfig, Certificate, Enroll, Job,
+	}
 )
 
 type Shell struct {
 	Arguments      []string
 	GitlabUsername string
 	GitlabKeyId    string
+	Anonymous      bool
 	SshArgs        []string
 	CommandType    CommandType
+
+	// AllowedCommands restricts the commands the SSH key may run. It's nil
+	// when the key isn't restricted.
+	AllowedCommands []CommandType
 }
 
 func (s *Shell) Parse() error {
@@ -38,6 +58,7 @@ func (s *Shell) Parse() error {
 	}
 
 	s.parseWho()
+	s.parseAllowedCommands()
 	s.defineCommandType()
 
 	return nil
@@ -71,18 +92,40 @@ func (s *Shell) isValidSshCommand() bool {
 
 func (s *Shell) parseWho() {
 	for _, argument := range s.Arguments {
+		// Usernames come first, as they may look like a key: username-jane-key-1
+		if username := tryParseUsername(argument); username != "" {
+			s.GitlabUsername = username
+			break
+		}
+
 		if keyId := tryParseKeyId(argument); keyId != "" {
 			s.GitlabKeyId = keyId
 			break
 		}
 
-		if username := tryParseUsername(argument); username != "" {
-			s.GitlabUsername = username
+		if anonymousRegex.MatchString(argument) {
+			s.Anonymous = true
 			break
 		}
 	}
 }
 
+func (s *Shell) parseAllowedCommands() {
+	for _, argument := range s.Arguments {
+		matchInfo := allowedCommandsRegex.FindStringSubmatch(argument)
+		if len(matchInfo) != 2 {
+			continue
+		}
+
+		s.AllowedCommands = []CommandType{}
+		for _, command := range strings.Split(matchInfo[1], ",") {
+			if command != "" {
+				s.AllowedCommands = append(s.AllowedCommands, CommandType(command))
+			}
+		}
+	}
+}
+
 func tryParseKeyId(argument string) string {
 	matchInfo := whoKeyRegex.FindStringSubmatch(argument)
 	if len(matchInfo) == 2 {
@@ -105,6 +148,41 @@ func tryParseUsername(argument string) string {
 	return ""
 }
 
+// IsAnonymous is true when the SSH key used to connect isn't known to GitLab.
+// Such sessions are only allowed to read public projects.
+func (s *Shell) IsAnonymous() bool {
+	return s.Anonymous && s.GitlabKeyId == "" && s.GitlabUsername == ""
+}
+
+// IsCommandAllowed is false when the SSH key is restricted to commands other
+// than the requested one. Discover only prints who the key belongs to and is
+// always allowed.
+func (s *Shell) IsCommandAllowed() bool {
+	if s.AllowedCommands == nil || s.CommandType == Discover {
+		return true
+	}
+
+	for _, command := range s.AllowedCommands {
+		if command == s.CommandType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsBuiltin is true for the commands implemented by gitlab-shell itself,
+// which can't be replaced by plugins.
+func IsBuiltin(command CommandType) bool {
+	for _, builtin := range builtinCommands {
+		if builtin == command {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (s *Shell) parseCommand(commandString string) error {
 	args, err := shellwords.Parse(commandString)
 	if err != nil {
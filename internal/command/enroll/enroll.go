@@ -0,0 +1,112 @@
+package enroll
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/shared/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/enrollment"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/sshenv"
+)
+
+const (
+	usage = "Usage: enroll <one-time-code>"
+)
+
+var (
+	// Codes are long enough not to be guessed within the rate limits
+	codeRegex = regexp.MustCompile(`\A[A-Za-z0-9_-]{16,128}\z`)
+)
+
+// Command adds the SSH key the user connected with as a deploy key. It's run
+// by keys unknown to GitLab, so the one-time code is all that authorizes it.
+// Attempts are rate limited per address and refused codes count as denials.
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.Shell
+	ReadWriter *readwriter.ReadWriter
+}
+
+func (c *Command) Execute() error {
+	args := c.Args.SshArgs[1:]
+	if len(args) != 1 || !codeRegex.MatchString(args[0]) {
+		return errors.New(usage)
+	}
+
+	verifier := &accessverifier.Command{Config: c.Config, Args: c.Args, ReadWriter: c.ReadWriter}
+	if err := verifier.GuardEnrollment(); err != nil {
+		return err
+	}
+
+	publicKey, err := authenticatedPublicKey()
+	if err != nil {
+		return err
+	}
+
+	client, err := enrollment.NewClient(c.Config)
+	if err != nil {
+		return err
+	}
+
+	// The code is a credential, it's never logged
+	fields := log.Fields{
+		"fingerprint": ssh.FingerprintSHA256(publicKey),
+		"remote_ip":   sshenv.LocalAddr(),
+	}
+
+	response, err := client.Enroll(&enrollment.Request{
+		Code:     args[0],
+		Key:      strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))),
+		RemoteIp: sshenv.LocalAddr(),
+	})
+	if err != nil {
+		log.WithError(err).WithFields(fields).Warn("Failed to enroll deploy key")
+
+		if _, ok := err.(*enrollment.RefusedError); ok || accessverifier.IsDenialError(err) {
+			verifier.RecordDenial()
+		}
+
+		return err
+	}
+
+	fields["project"] = response.Project
+	fields["deploy_key_id"] = response.KeyId
+	log.WithFields(fields).Info("Enrolled deploy key")
+
+	access := "read-only"
+	if response.CanPush {
+		access = "read-write"
+	}
+
+	fmt.Fprintf(c.ReadWriter.Out, "Added %s as %s deploy key %q to %s.\n", ssh.FingerprintSHA256(publicKey), access, response.Title, response.Project)
+
+	return nil
+}
+
+// sshd already verified the user holds the private key, the key can't be
+// passed as an argument where anyone could enroll anybody's public key.
+func authenticatedPublicKey() (ssh.PublicKey, error) {
+	key, err := sshenv.AuthenticatedPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid public key: %v", err)
+	}
+
+	if _, ok := publicKey.(*ssh.Certificate); ok {
+		return nil, errors.New("Certificates can't be enrolled as deploy keys")
+	}
+
+	return publicKey, nil
+}
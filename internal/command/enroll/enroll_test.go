@@ -0,0 +1,227 @@
+package enroll
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/shared/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/enrollment"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
+)
+
+const (
+	publicKey   = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBmhkEhEIE1ovGritMH9yeeCkmVEnE7NDt1wstiTR9+Q"
+	fingerprint = "SHA256:M4GGgv3CRDOu09t9Li5AQQ2Q5hUe7Q4uTbAkYPMvxTU"
+)
+
+var (
+	requests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/enroll_deploy_key",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+
+				var request *enrollment.Request
+				json.Unmarshal(b, &request)
+
+				if request.Code != "1a2b3c4d5e6f7g8h" || request.Key != publicKey {
+					body := map[string]interface{}{"success": false, "message": "The enrollment code is invalid or expired"}
+					json.NewEncoder(w).Encode(body)
+					return
+				}
+
+				body := map[string]interface{}{"success": true, "key_id": 7, "title": "ci-runner-1", "project": "group/project", "can_push": true}
+				json.NewEncoder(w).Encode(body)
+			},
+		},
+	}
+)
+
+func writeAuthInfo(t *testing.T, authInfo string) func() {
+	file, err := ioutil.TempFile("", "auth-info")
+	require.NoError(t, err)
+
+	_, err = file.WriteString(authInfo)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	restoreEnv := testhelper.TempEnv(map[string]string{"SSH_USER_AUTH": file.Name()})
+
+	return func() {
+		restoreEnv()
+		os.Remove(file.Name())
+	}
+}
+
+func TestExecute(t *testing.T) {
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	restoreAuthInfo := writeAuthInfo(t, "publickey "+publicKey+"\n")
+	defer restoreAuthInfo()
+
+	output := &bytes.Buffer{}
+	cmd := &Command{
+		Config:     &config.Config{GitlabUrl: url},
+		Args:       &commandargs.Shell{SshArgs: []string{"enroll", "1a2b3c4d5e6f7g8h"}, Anonymous: true},
+		ReadWriter: &readwriter.ReadWriter{Out: output},
+	}
+
+	require.NoError(t, cmd.Execute())
+	require.Equal(t, "Added "+fingerprint+" as read-write deploy key \"ci-runner-1\" to group/project.\n", output.String())
+}
+
+func buildCertificate(t *testing.T) string {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	require.NoError(t, err)
+
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signer, err := ssh.NewSignerFromKey(caKey)
+	require.NoError(t, err)
+
+	cert := &ssh.Certificate{Key: key, CertType: ssh.UserCert, ValidBefore: ssh.CertTimeInfinity}
+	require.NoError(t, cert.SignCert(rand.Reader, signer))
+
+	return string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(cert)))
+}
+
+func TestFailingExecute(t *testing.T) {
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	certificate := buildCertificate(t)
+
+	testCases := []struct {
+		desc          string
+		arguments     []string
+		authInfo      string
+		expectedError string
+	}{
+		{
+			desc:          "Without a code",
+			arguments:     []string{"enroll"},
+			authInfo:      "publickey " + publicKey,
+			expectedError: usage,
+		},
+		{
+			desc:          "With an invalid code",
+			arguments:     []string{"enroll", "1a2b3c4d5e6f7g8h;"},
+			authInfo:      "publickey " + publicKey,
+			expectedError: usage,
+		},
+		{
+			desc:          "With a short code",
+			arguments:     []string{"enroll", "1a2b3c"},
+			authInfo:      "publickey " + publicKey,
+			expectedError: usage,
+		},
+		{
+			desc:          "With a redeemed code",
+			arguments:     []string{"enroll", "4d5e6f7g8h9i0j1k"},
+			authInfo:      "publickey " + publicKey,
+			expectedError: "The enrollment code is invalid or expired",
+		},
+		{
+			desc:          "With a certificate",
+			arguments:     []string{"enroll", "1a2b3c4d5e6f7g8h"},
+			authInfo:      "publickey " + certificate,
+			expectedError: "Certificates can't be enrolled as deploy keys",
+		},
+		{
+			desc:          "Without a public key",
+			arguments:     []string{"enroll", "1a2b3c4d5e6f7g8h"},
+			authInfo:      "keyboard-interactive",
+			expectedError: "Exactly one public key must have been used to authenticate",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			restoreAuthInfo := writeAuthInfo(t, tc.authInfo)
+			defer restoreAuthInfo()
+
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     &config.Config{GitlabUrl: url},
+				Args:       &commandargs.Shell{SshArgs: tc.arguments, Anonymous: true},
+				ReadWriter: &readwriter.ReadWriter{Out: output},
+			}
+
+			require.EqualError(t, cmd.Execute(), tc.expectedError)
+			require.Empty(t, output.String())
+		})
+	}
+}
+
+func TestGuessingCodes(t *testing.T) {
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	restoreAuthInfo := writeAuthInfo(t, "publickey "+publicKey+"\n")
+	defer restoreAuthInfo()
+
+	restoreEnv := testhelper.TempEnv(map[string]string{"SSH_CONNECTION": "192.0.2.1 1234 127.0.0.1 22"})
+	defer restoreEnv()
+
+	testCases := []struct {
+		desc          string
+		config        config.Config
+		expectedError *regexp.Regexp
+	}{
+		{
+			desc:          "With the enrollment rate limit",
+			config:        config.Config{Enrollment: config.EnrollmentConfig{RateLimit: 1, RateLimitWindowSeconds: 60}},
+			expectedError: regexp.MustCompile(`\A` + regexp.QuoteMeta(accessverifier.EnrollmentRateLimitedError.Error()) + `\z`),
+		},
+		{
+			desc:          "With denial blocking",
+			config:        config.Config{DenialBlocking: config.DenialBlockingConfig{Enabled: true, MaxDenials: 1, WindowSeconds: 60, BlockDurationSeconds: 600}},
+			expectedError: regexp.MustCompile(`\AToo many of your requests were denied`),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			stateDir, err := ioutil.TempDir("", "gitlab-shell-state")
+			require.NoError(t, err)
+			defer os.RemoveAll(stateDir)
+
+			cfg := tc.config
+			cfg.GitlabUrl = url
+			cfg.StateDir = stateDir
+
+			cmd := &Command{
+				Config:     &cfg,
+				Args:       &commandargs.Shell{SshArgs: []string{"enroll", "4d5e6f7g8h9i0j1k"}, Anonymous: true},
+				ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}},
+			}
+			require.EqualError(t, cmd.Execute(), "The enrollment code is invalid or expired")
+
+			// Even a valid code is refused afterwards
+			output := &bytes.Buffer{}
+			cmd.Args = &commandargs.Shell{SshArgs: []string{"enroll", "1a2b3c4d5e6f7g8h"}, Anonymous: true}
+			cmd.ReadWriter = &readwriter.ReadWriter{Out: output}
+
+			err = cmd.Execute()
+			require.Error(t, err)
+			require.Regexp(t, tc.expectedError, err.Error())
+			require.Empty(t, output.String())
+		})
+	}
+}
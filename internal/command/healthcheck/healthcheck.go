@@ -2,15 +2,24 @@ package healthcheck
 
 import (
 	"fmt"
+	"time"
 
+	"gitlab.com/gitlab-org/gitlab-shell/client"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/healthcheck"
 )
 
+const (
+	// Gitaly only accepts authentication tokens whose timestamp is within
+	// 30 seconds of its own clock.
+	gitalyTokenValidity = 30 * time.Second
+)
+
 var (
 	apiMessage   = "Internal API available"
 	redisMessage = "Redis available via internal API"
+	clockMessage = "Clock in sync with internal API"
 )
 
 type Command struct {
@@ -31,6 +40,30 @@ func (c *Command) Execute() error {
 	}
 
 	fmt.Fprintf(c.ReadWriter.Out, "%v: OK\n", redisMessage)
+
+	return c.checkClockDrift(response.ClockDrift)
+}
+
+func (c *Command) checkClockDrift(drift *time.Duration) error {
+	if drift == nil {
+		fmt.Fprintf(c.ReadWriter.Out, "%v: UNKNOWN - the internal API sent no Date header\n", clockMessage)
+		return nil
+	}
+
+	offset, direction := *drift, "ahead of"
+	if offset < 0 {
+		offset, direction = -offset, "behind"
+	}
+
+	switch {
+	case offset > gitalyTokenValidity:
+		return fmt.Errorf("%v: FAILED - local clock is %v %v GitLab, Gitaly rejects tokens more than %v off", clockMessage, offset, direction, gitalyTokenValidity)
+	case offset > client.ClockDriftThreshold:
+		fmt.Fprintf(c.ReadWriter.Out, "%v: WARNING - local clock is %v %v GitLab\n", clockMessage, offset, direction)
+	default:
+		fmt.Fprintf(c.ReadWriter.Out, "%v: OK\n", clockMessage)
+	}
+
 	return nil
 }
 
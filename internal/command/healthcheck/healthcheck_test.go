@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -30,10 +31,15 @@ var (
 )
 
 func buildTestHandlers(code int, rsp *healthcheck.Response) []testserver.TestRequestHandler {
+	return buildSkewedTestHandlers(code, rsp, 0)
+}
+
+func buildSkewedTestHandlers(code int, rsp *healthcheck.Response, skew time.Duration) []testserver.TestRequestHandler {
 	return []testserver.TestRequestHandler{
 		{
 			Path: "/api/v4/internal/check",
 			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Date", time.Now().Add(skew).UTC().Format(http.TimeFormat))
 				w.WriteHeader(code)
 				if rsp != nil {
 					json.NewEncoder(w).Encode(rsp)
@@ -56,6 +62,37 @@ func TestExecute(t *testing.T) {
 	err := cmd.Execute()
 
 	require.NoError(t, err)
+	require.Equal(t, "Internal API available: OK\nRedis available via internal API: OK\nClock in sync with internal API: OK\n", buffer.String())
+}
+
+func TestClockDriftWarningExecute(t *testing.T) {
+	url, cleanup := testserver.StartSocketHttpServer(t, buildSkewedTestHandlers(200, okResponse, -20*time.Second))
+	defer cleanup()
+
+	buffer := &bytes.Buffer{}
+	cmd := &Command{
+		Config:     &config.Config{GitlabUrl: url},
+		ReadWriter: &readwriter.ReadWriter{Out: buffer},
+	}
+
+	err := cmd.Execute()
+
+	require.NoError(t, err)
+	require.Equal(t, "Internal API available: OK\nRedis available via internal API: OK\nClock in sync with internal API: WARNING - local clock is 20s ahead of GitLab\n", buffer.String())
+}
+
+func TestFailingClockDriftExecute(t *testing.T) {
+	url, cleanup := testserver.StartSocketHttpServer(t, buildSkewedTestHandlers(200, okResponse, time.Minute))
+	defer cleanup()
+
+	buffer := &bytes.Buffer{}
+	cmd := &Command{
+		Config:     &config.Config{GitlabUrl: url},
+		ReadWriter: &readwriter.ReadWriter{Out: buffer},
+	}
+
+	err := cmd.Execute()
+	require.EqualError(t, err, "Clock in sync with internal API: FAILED - local clock is 1m0s behind GitLab, Gitaly rejects tokens more than 30s off")
 	require.Equal(t, "Internal API available: OK\nRedis available via internal API: OK\n", buffer.String())
 }
 
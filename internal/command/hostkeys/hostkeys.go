@@ -0,0 +1,151 @@
+package hostkeys
+
+import (
+	"fmt"
+	"sort"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	gitlabnet "gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/hostkeys"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/hostkeys"
+)
+
+const (
+	publishFlag = "--publish"
+)
+
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.GenericArgs
+	ReadWriter *readwriter.ReadWriter
+}
+
+func (c *Command) Execute() error {
+	publish, err := c.parseArgs()
+	if err != nil {
+		return err
+	}
+
+	keys, err := hostkeys.Load(c.Config.Sshd.HostKeyFiles)
+	if err != nil {
+		return err
+	}
+
+	host := c.Config.SshHost()
+	c.printKeys(host, keys)
+
+	client, err := gitlabnet.NewClient(c.Config)
+	if err != nil {
+		return err
+	}
+
+	c.comparePublished(client, keys)
+
+	if !publish {
+		return nil
+	}
+
+	request := &gitlabnet.Request{Host: host, Port: c.Config.Sshd.Port, HostKeys: toPublished(keys)}
+	if _, err := client.Publish(request); err != nil {
+		return fmt.Errorf("Publishing host keys to GitLab: FAILED - %v", err)
+	}
+
+	fmt.Fprintln(c.ReadWriter.Out, "\nPublishing host keys to GitLab: OK")
+
+	return nil
+}
+
+func (c *Command) parseArgs() (bool, error) {
+	publish := false
+
+	for _, arg := range c.Args.Arguments[1:] {
+		if arg != publishFlag {
+			return false, fmt.Errorf("Unknown argument: %s\nUsage: check hostkeys [%s]", arg, publishFlag)
+		}
+
+		publish = true
+	}
+
+	return publish, nil
+}
+
+func (c *Command) printKeys(host string, keys []*hostkeys.HostKey) {
+	out := c.ReadWriter.Out
+
+	fmt.Fprintf(out, "# Host key fingerprints for %s\n", host)
+	for _, key := range keys {
+		fmt.Fprintf(out, "%s %s %s\n", key.Fingerprint(), key.Type(), key.File)
+	}
+
+	fmt.Fprintln(out, "\n# SSHFP records")
+	for _, key := range keys {
+		if record := key.SSHFPRecord(host); record != "" {
+			fmt.Fprintln(out, record)
+		}
+	}
+
+	fmt.Fprintln(out, "\n# known_hosts")
+	for _, key := range keys {
+		fmt.Fprintln(out, key.KnownHostsLine(host, c.Config.Sshd.Port))
+	}
+}
+
+// A host key change is expected after a deliberate rotation, but it's also
+// what users see during a man-in-the-middle attack, so it's only reported.
+func (c *Command) comparePublished(client *gitlabnet.Client, keys []*hostkeys.HostKey) {
+	published, err := client.Published()
+	if err != nil {
+		fmt.Fprintf(c.ReadWriter.ErrOut, "WARNING: Unable to fetch the host keys published by GitLab: %v\n", err)
+		return
+	}
+
+	if len(published.HostKeys) == 0 {
+		return
+	}
+
+	current := fingerprints(toPublished(keys))
+	previous := fingerprints(published.HostKeys)
+
+	for _, fingerprint := range difference(current, previous) {
+		fmt.Fprintf(c.ReadWriter.ErrOut, "WARNING: Host key %s is not published by GitLab\n", fingerprint)
+	}
+
+	for _, fingerprint := range difference(previous, current) {
+		fmt.Fprintf(c.ReadWriter.ErrOut, "WARNING: Host key %s is published by GitLab but not used by sshd\n", fingerprint)
+	}
+}
+
+func toPublished(keys []*hostkeys.HostKey) []gitlabnet.HostKey {
+	var result []gitlabnet.HostKey
+	for _, key := range keys {
+		result = append(result, gitlabnet.HostKey{
+			Type:        key.Type(),
+			Fingerprint: key.Fingerprint(),
+			PublicKey:   key.String(),
+		})
+	}
+
+	return result
+}
+
+func fingerprints(keys []gitlabnet.HostKey) map[string]bool {
+	result := make(map[string]bool)
+	for _, key := range keys {
+		result[key.Fingerprint] = true
+	}
+
+	return result
+}
+
+func difference(a, b map[string]bool) []string {
+	var result []string
+	for fingerprint := range a {
+		if !b[fingerprint] {
+			result = append(result, fingerprint)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
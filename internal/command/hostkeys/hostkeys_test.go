@@ -0,0 +1,181 @@
+package hostkeys
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	gitlabnet "gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/hostkeys"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
+)
+
+const (
+	ed25519Fingerprint = "SHA256:aqF0VxuREXrdcC1ShOcYlg8ytsVJlI28xdFa5OrvjtI"
+	ed25519Key         = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIYJb/hz8JexXKsDYZ0rNU+K/qZJN5LWE3o4zzsFGkPY"
+)
+
+func setup(t *testing.T, published []gitlabnet.HostKey, publishedRequest **gitlabnet.Request) []testserver.TestRequestHandler {
+	return []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/host_keys",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					b, err := ioutil.ReadAll(r.Body)
+					require.NoError(t, err)
+					require.NoError(t, json.Unmarshal(b, publishedRequest))
+				}
+
+				require.NoError(t, json.NewEncoder(w).Encode(&gitlabnet.Response{HostKeys: published}))
+			},
+		},
+	}
+}
+
+func buildConfig(url string) *config.Config {
+	return &config.Config{
+		GitlabUrl: url,
+		Sshd: config.SshdConfig{
+			Host:         "gitlab.example.com",
+			Port:         2222,
+			HostKeyFiles: []string{path.Join(testhelper.TestRoot, "hostkeys/ssh_host_ed25519_key.pub")},
+		},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	cleanup, err := testhelper.PrepareTestRootDir()
+	require.NoError(t, err)
+	defer cleanup()
+
+	var publishedRequest *gitlabnet.Request
+	published := []gitlabnet.HostKey{{Type: "ssh-ed25519", Fingerprint: ed25519Fingerprint, PublicKey: ed25519Key}}
+	url, cleanup := testserver.StartSocketHttpServer(t, setup(t, published, &publishedRequest))
+	defer cleanup()
+
+	testCases := []struct {
+		desc           string
+		arguments      []string
+		expectedOutput string
+		published      bool
+	}{
+		{
+			desc:      "Without publishing",
+			arguments: []string{"hostkeys"},
+		},
+		{
+			desc:           "With publishing",
+			arguments:      []string{"hostkeys", "--publish"},
+			expectedOutput: "\nPublishing host keys to GitLab: OK\n",
+			published:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			publishedRequest = nil
+			output := &bytes.Buffer{}
+			errOutput := &bytes.Buffer{}
+
+			cmd := &Command{
+				Config:     buildConfig(url),
+				Args:       &commandargs.GenericArgs{Arguments: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: output, ErrOut: errOutput},
+			}
+
+			require.NoError(t, cmd.Execute())
+
+			expectedOutput := "# Host key fingerprints for gitlab.example.com\n" +
+				ed25519Fingerprint + " ssh-ed25519 " + path.Join(testhelper.TestRoot, "hostkeys/ssh_host_ed25519_key.pub") + "\n" +
+				"\n# SSHFP records\n" +
+				"gitlab.example.com. IN SSHFP 4 2 6aa174571b91117add702d5284e718960f32b6c549948dbcc5d15ae4eaef8ed2\n" +
+				"\n# known_hosts\n" +
+				"[gitlab.example.com]:2222 " + ed25519Key + "\n" +
+				tc.expectedOutput
+
+			require.Equal(t, expectedOutput, output.String())
+			require.Empty(t, errOutput.String())
+
+			if tc.published {
+				require.Equal(t, &gitlabnet.Request{Host: "gitlab.example.com", Port: 2222, HostKeys: published}, publishedRequest)
+			} else {
+				require.Nil(t, publishedRequest)
+			}
+		})
+	}
+}
+
+func TestPublishedMismatch(t *testing.T) {
+	cleanup, err := testhelper.PrepareTestRootDir()
+	require.NoError(t, err)
+	defer cleanup()
+
+	var publishedRequest *gitlabnet.Request
+	published := []gitlabnet.HostKey{{Type: "ssh-rsa", Fingerprint: "SHA256:old"}}
+	url, cleanup := testserver.StartSocketHttpServer(t, setup(t, published, &publishedRequest))
+	defer cleanup()
+
+	errOutput := &bytes.Buffer{}
+	cmd := &Command{
+		Config:     buildConfig(url),
+		Args:       &commandargs.GenericArgs{Arguments: []string{"hostkeys"}},
+		ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, ErrOut: errOutput},
+	}
+
+	require.NoError(t, cmd.Execute())
+	require.Equal(t, "WARNING: Host key "+ed25519Fingerprint+" is not published by GitLab\n"+
+		"WARNING: Host key SHA256:old is published by GitLab but not used by sshd\n", errOutput.String())
+}
+
+func TestFailingExecute(t *testing.T) {
+	cleanup, err := testhelper.PrepareTestRootDir()
+	require.NoError(t, err)
+	defer cleanup()
+
+	url, cleanup := testserver.StartSocketHttpServer(t, []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/host_keys",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+		},
+	})
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		arguments     []string
+		expectedError string
+	}{
+		{
+			desc:          "With an unknown argument",
+			arguments:     []string{"hostkeys", "--unknown"},
+			expectedError: "Unknown argument: --unknown\nUsage: check hostkeys [--publish]",
+		},
+		{
+			desc:          "When publishing fails",
+			arguments:     []string{"hostkeys", "--publish"},
+			expectedError: "Publishing host keys to GitLab: FAILED - Internal API error (500)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cmd := &Command{
+				Config:     buildConfig(url),
+				Args:       &commandargs.GenericArgs{Arguments: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}},
+			}
+
+			require.EqualError(t, cmd.Execute(), tc.expectedError)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package job
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// Control sequences, e.g. colors or erasing the line, and the markers of
+	// GitLab's collapsible sections, which terminals hide by erasing them
+	ansiRegex = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]|section_(?:start|end):[0-9]+:[^\r\n]*\r`)
+
+	// The start of a control sequence cut off at the end of a part
+	partialAnsiRegex = regexp.MustCompile(`\x1b(?:\[[0-9;?]*)?\z`)
+
+	// The rest of a section marker after its prefix, not yet ended by \r
+	partialSectionRegex = regexp.MustCompile(`\A[0-9]*(?::[^\r\n]*)?\z`)
+
+	sectionPrefixes = []string{"section_start:", "section_end:"}
+)
+
+// ansiStripper removes control sequences from a trace read in parts. A
+// sequence or section marker cut off at the end of a part is kept until the
+// next one.
+type ansiStripper struct {
+	pending string
+}
+
+func (s *ansiStripper) Strip(content string, last bool) string {
+	content = s.pending + content
+	s.pending = ""
+
+	if !last {
+		cut := partialSectionMarker(content)
+		if loc := partialAnsiRegex.FindStringIndex(content); loc != nil && (cut < 0 || loc[0] < cut) {
+			cut = loc[0]
+		}
+
+		if cut >= 0 {
+			s.pending = content[cut:]
+			content = content[:cut]
+		}
+	}
+
+	if !strings.ContainsAny(content, "\x1b\r") {
+		return content
+	}
+
+	return ansiRegex.ReplaceAllString(content, "")
+}
+
+// partialSectionMarker returns where a section marker cut off at the end of
+// content starts, or -1 when there is none
+func partialSectionMarker(content string) int {
+	cut := -1
+
+	for _, prefix := range sectionPrefixes {
+		if i := strings.LastIndex(content, prefix); i >= 0 && partialSectionRegex.MatchString(content[i+len(prefix):]) {
+			if cut < 0 || i < cut {
+				cut = i
+			}
+			continue
+		}
+
+		// The prefix itself may be cut off
+		for n := len(prefix) - 1; n > 0; n-- {
+			if strings.HasSuffix(content, prefix[:n]) {
+				if i := len(content) - n; cut < 0 || i < cut {
+					cut = i
+				}
+				break
+			}
+		}
+	}
+
+	return cut
+}
@@ -0,0 +1,69 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrip(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		parts    []string
+		expected string
+	}{
+		{
+			desc:     "Without control sequences",
+			parts:    []string{"Running tests\n"},
+			expected: "Running tests\n",
+		},
+		{
+			desc:     "With colors",
+			parts:    []string{"\x1b[32;1mJob succeeded\x1b[0;m\n"},
+			expected: "Job succeeded\n",
+		},
+		{
+			desc:     "With sections",
+			parts:    []string{"\x1b[0Ksection_start:1600000000:build\r\x1b[0KBuilding\n\x1b[0Ksection_end:1600000010:build\r\x1b[0K"},
+			expected: "Building\n",
+		},
+		{
+			desc:     "With a sequence split across parts",
+			parts:    []string{"ok \x1b[3", "2mgreen\x1b", "[0m\n"},
+			expected: "ok green\n",
+		},
+		{
+			desc:     "With a section marker split before its \\r",
+			parts:    []string{"\x1b[0Ksection_start:1600000000:bui", "ld\r\x1b[0KBuilding\n"},
+			expected: "Building\n",
+		},
+		{
+			desc:     "With a section marker split within its prefix",
+			parts:    []string{"Built\n\x1b[0Ksecti", "on_end:1600000010:build\r\x1b[0KDone\n"},
+			expected: "Built\nDone\n",
+		},
+		{
+			desc:     "With text resembling a section prefix",
+			parts:    []string{"Running sec", "urity scan\n"},
+			expected: "Running security scan\n",
+		},
+		{
+			desc:     "With an escape at the end of the trace",
+			parts:    []string{"done\x1b"},
+			expected: "done\x1b",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			stripper := &ansiStripper{}
+
+			var output string
+			for i, part := range tc.parts {
+				output += stripper.Strip(part, i == len(tc.parts)-1)
+			}
+
+			require.Equal(t, tc.expected, output)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package job
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/jobtrace"
+)
+
+const (
+	logAction = "log"
+
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+
+	// sshd only sets it when the client got a terminal
+	sshTtyEnv = "SSH_TTY"
+
+	successStatus = "success"
+
+	// The exit status of jobs ending with a status missing from exitCodes
+	otherStatusExitCode = 12
+
+	usage = "Usage: job log <project> <job-id> [--follow] [--color=auto|always|never]\n" +
+		"Exits with 10 when the job failed, 11 when it was canceled and 12 when it ended otherwise, " +
+		"1 means the log couldn't be shown."
+)
+
+var (
+	// pollInterval is overridden in tests
+	pollInterval = 3 * time.Second
+
+	// The statuses of jobs don't collide with 1, which gitlab-shell exits
+	// with on any error
+	exitCodes = map[string]int{
+		successStatus: 0,
+		"failed":      10,
+		"canceled":    11,
+	}
+)
+
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.Shell
+	ReadWriter *readwriter.ReadWriter
+}
+
+// ExitError is returned when the job didn't succeed, gitlab-shell exits with
+// a status depending on the one of the job.
+type ExitError struct {
+	JobId  int64
+	Status string
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("Job %d finished with status %s", e.JobId, e.Status)
+}
+
+func (e *ExitError) ExitCode() int {
+	if code, ok := exitCodes[e.Status]; ok {
+		return code
+	}
+
+	return otherStatusExitCode
+}
+
+type logOptions struct {
+	project string
+	jobId   int64
+	follow  bool
+	color   string
+}
+
+func (c *Command) Execute() error {
+	args := c.Args.SshArgs[1:]
+	if len(args) == 0 || args[0] != logAction {
+		return errors.New(usage)
+	}
+
+	options, err := parseLogOptions(args[1:])
+	if err != nil {
+		return err
+	}
+
+	client, err := jobtrace.NewClient(c.Config)
+	if err != nil {
+		return err
+	}
+
+	c.logJob(options).Info("Streaming job log")
+
+	return c.stream(client, options)
+}
+
+func (c *Command) stream(client *jobtrace.Client, options *logOptions) error {
+	var stripper *ansiStripper
+	if !keepColors(options.color) {
+		stripper = &ansiStripper{}
+	}
+
+	var offset int64
+	for {
+		trace, err := client.Get(c.Args, options.project, options.jobId, offset)
+		if err != nil {
+			return err
+		}
+
+		content := trace.Content
+		if stripper != nil {
+			content = stripper.Strip(content, trace.Complete)
+		}
+
+		if _, err := io.WriteString(c.ReadWriter.Out, content); err != nil {
+			return err
+		}
+
+		if trace.Complete {
+			return c.finish(options.jobId, trace.Status)
+		}
+
+		if !options.follow {
+			fmt.Fprintf(c.ReadWriter.ErrOut, "Job %d is %s, use --follow to stream its log until it finishes.\n", options.jobId, trace.Status)
+			return nil
+		}
+
+		offset = trace.Offset
+		time.Sleep(pollInterval)
+	}
+}
+
+func (c *Command) finish(jobId int64, status string) error {
+	if status == successStatus {
+		return nil
+	}
+
+	err := &ExitError{JobId: jobId, Status: status}
+	fmt.Fprintf(c.ReadWriter.ErrOut, "%v\n", err)
+
+	return err
+}
+
+func (c *Command) logJob(options *logOptions) *log.Entry {
+	fields := log.Fields{
+		"command": string(commandargs.Job),
+		"project": options.project,
+		"job_id":  options.jobId,
+		"follow":  options.follow,
+	}
+
+	if c.Args.GitlabUsername != "" {
+		fields["username"] = c.Args.GitlabUsername
+	} else {
+		fields["gl_key_id"] = c.Args.GitlabKeyId
+	}
+
+	return log.WithFields(fields)
+}
+
+// Colors are kept when the client has a terminal, unless --color says
+// otherwise.
+func keepColors(color string) bool {
+	switch color {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+
+	return os.Getenv(sshTtyEnv) != ""
+}
+
+func parseLogOptions(args []string) (*logOptions, error) {
+	options := &logOptions{}
+
+	flags := flag.NewFlagSet("job log", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.BoolVar(&options.follow, "follow", false, "")
+	flags.StringVar(&options.color, "color", colorAuto, "")
+
+	// Positional arguments come first, but are also accepted after the flags
+	var positional []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, usageError(err.Error())
+	}
+
+	positional = append(positional, flags.Args()...)
+	if len(positional) != 2 {
+		return nil, usageError("Wrong number of arguments")
+	}
+
+	options.project = positional[0]
+
+	jobId, err := strconv.ParseInt(positional[1], 10, 64)
+	if err != nil || jobId <= 0 {
+		return nil, usageError(fmt.Sprintf("Invalid job ID: %s", positional[1]))
+	}
+	options.jobId = jobId
+
+	if options.color != colorAuto && options.color != colorAlways && options.color != colorNever {
+		return nil, usageError(fmt.Sprintf("Invalid --color: %s", options.color))
+	}
+
+	return options, nil
+}
+
+func usageError(message string) error {
+	return errors.New(message + "\n" + usage)
+}
@@ -0,0 +1,200 @@
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
+)
+
+// The trace of job 1 grows while it runs, and the job fails
+var traceParts = []string{"\x1b[32;1mRunning tests\x1b[0;m\n", "1 failure\n", "\x1b[31;1mERROR: Job failed\x1b[0;m\n"}
+
+func setup(t *testing.T) []testserver.TestRequestHandler {
+	return []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/job_trace",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "group/project", r.URL.Query().Get("project"))
+				require.Equal(t, "1", r.URL.Query().Get("key_id"))
+
+				offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+				require.NoError(t, err)
+
+				var body map[string]interface{}
+				switch r.URL.Query().Get("job_id") {
+				case "1":
+					// Each request returns the next part of the trace
+					var length, part int
+					for part = 0; length < offset; part++ {
+						length += len(traceParts[part])
+					}
+					complete := part == len(traceParts)-1
+					status := "running"
+					if complete {
+						status = "failed"
+					}
+
+					body = map[string]interface{}{
+						"success":  true,
+						"content":  traceParts[part],
+						"offset":   offset + len(traceParts[part]),
+						"complete": complete,
+						"status":   status,
+					}
+				case "2":
+					body = map[string]interface{}{"success": true, "content": "Done\n", "offset": 5, "complete": true, "status": "success"}
+				case "3":
+					body = map[string]interface{}{"success": true, "content": "Done\n", "offset": 5, "complete": true, "status": "skipped"}
+				default:
+					body = map[string]interface{}{"success": false, "message": "Job not found"}
+				}
+
+				require.NoError(t, json.NewEncoder(w).Encode(body))
+			},
+		},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	url, cleanup := testserver.StartSocketHttpServer(t, setup(t))
+	defer cleanup()
+
+	defer func(interval time.Duration) { pollInterval = interval }(pollInterval)
+	pollInterval = time.Millisecond
+
+	testCases := []struct {
+		desc             string
+		arguments        []string
+		environment      map[string]string
+		expectedOutput   string
+		expectedErrOut   string
+		expectedExitCode int
+	}{
+		{
+			desc:             "Following a failing job",
+			arguments:        []string{"job", "log", "group/project", "1", "--follow"},
+			expectedOutput:   "Running tests\n1 failure\nERROR: Job failed\n",
+			expectedErrOut:   "Job 1 finished with status failed\n",
+			expectedExitCode: 10,
+		},
+		{
+			desc:             "Following a job with colors",
+			arguments:        []string{"job", "log", "--follow", "--color=always", "group/project", "1"},
+			expectedOutput:   traceParts[0] + traceParts[1] + traceParts[2],
+			expectedErrOut:   "Job 1 finished with status failed\n",
+			expectedExitCode: 10,
+		},
+		{
+			desc:             "Following a job from a terminal",
+			arguments:        []string{"job", "log", "group/project", "1", "--follow"},
+			environment:      map[string]string{"SSH_TTY": "/dev/pts/1"},
+			expectedOutput:   traceParts[0] + traceParts[1] + traceParts[2],
+			expectedErrOut:   "Job 1 finished with status failed\n",
+			expectedExitCode: 10,
+		},
+		{
+			desc:           "A running job without following it",
+			arguments:      []string{"job", "log", "group/project", "1"},
+			expectedOutput: "Running tests\n",
+			expectedErrOut: "Job 1 is running, use --follow to stream its log until it finishes.\n",
+		},
+		{
+			desc:           "A successful job",
+			arguments:      []string{"job", "log", "group/project", "2"},
+			expectedOutput: "Done\n",
+		},
+		{
+			desc:             "A skipped job",
+			arguments:        []string{"job", "log", "group/project", "3"},
+			expectedOutput:   "Done\n",
+			expectedErrOut:   "Job 3 finished with status skipped\n",
+			expectedExitCode: 12,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			restoreEnv := testhelper.TempEnv(tc.environment)
+			defer restoreEnv()
+
+			output := &bytes.Buffer{}
+			errOut := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     &config.Config{GitlabUrl: url},
+				Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: output, ErrOut: errOut},
+			}
+
+			err := cmd.Execute()
+			if tc.expectedExitCode == 0 {
+				require.NoError(t, err)
+			} else {
+				require.IsType(t, &ExitError{}, err)
+				require.Equal(t, tc.expectedExitCode, err.(*ExitError).ExitCode())
+			}
+
+			require.Equal(t, tc.expectedOutput, output.String())
+			require.Equal(t, tc.expectedErrOut, errOut.String())
+		})
+	}
+}
+
+func TestFailingExecute(t *testing.T) {
+	url, cleanup := testserver.StartSocketHttpServer(t, setup(t))
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		arguments     []string
+		expectedError string
+	}{
+		{
+			desc:          "Without action",
+			arguments:     []string{"job"},
+			expectedError: usage,
+		},
+		{
+			desc:          "Without job ID",
+			arguments:     []string{"job", "log", "group/project"},
+			expectedError: "Wrong number of arguments\n" + usage,
+		},
+		{
+			desc:          "With an invalid job ID",
+			arguments:     []string{"job", "log", "group/project", "first"},
+			expectedError: "Invalid job ID: first\n" + usage,
+		},
+		{
+			desc:          "With an invalid color",
+			arguments:     []string{"job", "log", "group/project", "1", "--color=rainbow"},
+			expectedError: "Invalid --color: rainbow\n" + usage,
+		},
+		{
+			desc:          "With an unknown job",
+			arguments:     []string{"job", "log", "group/project", "404"},
+			expectedError: "Job not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cmd := &Command{
+				Config:     &config.Config{GitlabUrl: url},
+				Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}},
+			}
+
+			require.EqualError(t, cmd.Execute(), tc.expectedError)
+		})
+	}
+}
@@ -81,7 +81,7 @@ func actionFromOperation(operation string) (commandargs.CommandType, error) {
 }
 
 func (c *Command) verifyAccess(action commandargs.CommandType, repo string) (*accessverifier.Response, error) {
-	cmd := accessverifier.Command{c.Config, c.Args, c.ReadWriter}
+	cmd := accessverifier.Command{Config: c.Config, Args: c.Args, ReadWriter: c.ReadWriter}
 
 	return cmd.Verify(action, repo)
 }
@@ -0,0 +1,144 @@
+package logpseudonyms
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/pseudonym"
+)
+
+const (
+	lookupCommand    = "lookup"
+	pseudonymCommand = "pseudonym"
+
+	dateFormat = "2006-01-02"
+
+	usage = "Usage: gitlab-shell-log-pseudonyms lookup <field> <pseudonym>... < candidates\n" +
+		"       gitlab-shell-log-pseudonyms pseudonym <field> <value> [<YYYY-MM-DD>]"
+)
+
+var (
+	// now is overridden in tests
+	now = time.Now
+)
+
+// Command maps log pseudonyms back to users during an investigation. It
+// needs the salt, so it only works for the owner of the salt file.
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.GenericArgs
+	ReadWriter *readwriter.ReadWriter
+}
+
+func (c *Command) Execute() error {
+	args := c.Args.Arguments
+	if len(args) < 3 || !pseudonym.IsPseudonymized(args[1]) {
+		return errors.New(usage)
+	}
+
+	pseudonymizer, err := c.loadPseudonymizer()
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"subcommand": args[0],
+		"field":      args[1],
+		"os_user":    os.Getenv("USER"),
+	}).Info("Log pseudonyms looked up")
+
+	switch args[0] {
+	case lookupCommand:
+		return c.lookup(pseudonymizer, args[1], args[2:])
+	case pseudonymCommand:
+		return c.pseudonym(pseudonymizer, args[1], args[2:])
+	}
+
+	return errors.New(usage)
+}
+
+// The salt is never created here, a missing salt means nothing was
+// pseudonymized with it.
+func (c *Command) loadPseudonymizer() (*pseudonym.Pseudonymizer, error) {
+	cfg := c.Config.LogPseudonymization
+
+	info, err := os.Stat(cfg.SaltFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the log salt: %v", err)
+	}
+
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s must only be accessible by its owner", cfg.SaltFile)
+	}
+
+	salt, err := pseudonym.LoadSalt(cfg.SaltFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pseudonym.Pseudonymizer{Salt: salt, Config: cfg}, nil
+}
+
+// Pseudonyms can't be reversed, so candidate values are read from the input,
+// e.g. a list of usernames, and the ones matching a pseudonym are printed.
+func (c *Command) lookup(pseudonymizer *pseudonym.Pseudonymizer, field string, pseudonyms []string) error {
+	found := make(map[string]bool)
+
+	scanner := bufio.NewScanner(c.ReadWriter.In)
+	for scanner.Scan() {
+		value := scanner.Text()
+
+		for _, p := range pseudonyms {
+			match, err := pseudonymizer.Matches(p, field, value)
+			if err != nil {
+				return fmt.Errorf("%v: %s", err, p)
+			}
+
+			if match {
+				fmt.Fprintf(c.ReadWriter.Out, "%s %s\n", p, value)
+				found[p] = true
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range pseudonyms {
+		if !found[p] {
+			fmt.Fprintf(c.ReadWriter.Out, "%s not found\n", p)
+		}
+	}
+
+	return nil
+}
+
+// Printing the pseudonym of a known value allows searching the logs for it.
+func (c *Command) pseudonym(pseudonymizer *pseudonym.Pseudonymizer, field string, args []string) error {
+	if len(args) > 2 {
+		return errors.New(usage)
+	}
+
+	at := now()
+	if len(args) == 2 {
+		date, err := time.Parse(dateFormat, args[1])
+		if err != nil {
+			return fmt.Errorf("Invalid date: %s\n%s", args[1], usage)
+		}
+
+		at = date
+	}
+
+	fmt.Fprintln(c.ReadWriter.Out, pseudonymizer.Pseudonym(field, args[0], at))
+
+	return nil
+}
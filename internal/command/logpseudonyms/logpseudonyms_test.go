@@ -0,0 +1,123 @@
+package logpseudonyms
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/pseudonym"
+)
+
+var (
+	salt = []byte("0123456789abcdef0123456789abcdef")
+	at   = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func setup(t *testing.T, mode os.FileMode) (config.LogPseudonymizationConfig, func()) {
+	dir, err := ioutil.TempDir("", "logpseudonyms")
+	require.NoError(t, err)
+
+	cfg := config.LogPseudonymizationConfig{SaltFile: filepath.Join(dir, "salt"), RotationDays: 30}
+	require.NoError(t, ioutil.WriteFile(cfg.SaltFile, salt, mode))
+	require.NoError(t, os.Chmod(cfg.SaltFile, mode))
+
+	return cfg, func() { os.RemoveAll(dir) }
+}
+
+func TestExecute(t *testing.T) {
+	cfg, cleanup := setup(t, 0600)
+	defer cleanup()
+
+	defer func(oldNow func() time.Time) { now = oldNow }(now)
+	now = func() time.Time { return at }
+
+	pseudonymizer := &pseudonym.Pseudonymizer{Salt: salt, Config: cfg}
+	jane := pseudonymizer.Pseudonym("username", "jane-doe", at)
+	john := pseudonymizer.Pseudonym("username", "john-doe", at.Add(-60*24*time.Hour))
+
+	testCases := []struct {
+		desc           string
+		arguments      []string
+		input          string
+		expectedOutput string
+	}{
+		{
+			desc:           "Looking up pseudonyms",
+			arguments:      []string{"lookup", "username", jane, john, "p1-0123456789abcdef"},
+			input:          "alice\njohn-doe\njane-doe\n",
+			expectedOutput: john + " john-doe\n" + jane + " jane-doe\n" + "p1-0123456789abcdef not found\n",
+		},
+		{
+			desc:           "Printing the current pseudonym",
+			arguments:      []string{"pseudonym", "username", "jane-doe"},
+			expectedOutput: jane + "\n",
+		},
+		{
+			desc:           "Printing a pseudonym at a date",
+			arguments:      []string{"pseudonym", "username", "john-doe", at.Add(-60 * 24 * time.Hour).Format(dateFormat)},
+			expectedOutput: john + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     &config.Config{LogPseudonymization: cfg},
+				Args:       &commandargs.GenericArgs{Arguments: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: output, In: strings.NewReader(tc.input)},
+			}
+
+			require.NoError(t, cmd.Execute())
+			require.Equal(t, tc.expectedOutput, output.String())
+		})
+	}
+}
+
+func TestFailingExecute(t *testing.T) {
+	cfg, cleanup := setup(t, 0644)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		arguments     []string
+		expectedError string
+	}{
+		{
+			desc:          "With an unknown field",
+			arguments:     []string{"lookup", "gl_project_path", "p1-0123456789abcdef"},
+			expectedError: usage,
+		},
+		{
+			desc:          "Without pseudonyms",
+			arguments:     []string{"lookup", "username"},
+			expectedError: usage,
+		},
+		{
+			desc:          "With a salt readable by others",
+			arguments:     []string{"lookup", "username", "p1-0123456789abcdef"},
+			expectedError: cfg.SaltFile + " must only be accessible by its owner",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cmd := &Command{
+				Config:     &config.Config{LogPseudonymization: cfg},
+				Args:       &commandargs.GenericArgs{Arguments: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, In: strings.NewReader("")},
+			}
+
+			require.EqualError(t, cmd.Execute(), tc.expectedError)
+		})
+	}
+}
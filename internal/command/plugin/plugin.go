@@ -0,0 +1,161 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/discover"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/sshenv"
+)
+
+const (
+	// The context is written to the first file descriptor after stdio
+	contextFd    = 3
+	contextFdEnv = "GITLAB_SHELL_CONTEXT_FD"
+
+	contextVersion = 1
+)
+
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.Shell
+	ReadWriter *readwriter.ReadWriter
+	Plugin     *config.PluginConfig
+}
+
+// Context tells the plugin who is running it. The user was resolved by
+// GitLab, so plugins don't need to trust the SSH command.
+type Context struct {
+	Version  int      `json:"version"`
+	Command  string   `json:"command"`
+	Args     []string `json:"args"`
+	UserId   int64    `json:"user_id"`
+	Username string   `json:"username"`
+	Name     string   `json:"name"`
+	KeyId    string   `json:"key_id,omitempty"`
+	RemoteIp string   `json:"remote_ip"`
+}
+
+// ExitError is returned when the plugin exits with a non-zero status, which
+// gitlab-shell exits with too.
+type ExitError struct {
+	Name string
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("%s exited with status %d", e.Name, e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Find returns the plugin serving command. Built-in commands are never
+// served by plugins, whatever the configuration says.
+func Find(cfg *config.Config, command commandargs.CommandType) *config.PluginConfig {
+	if commandargs.IsBuiltin(command) {
+		return nil
+	}
+
+	for i := range cfg.Plugins {
+		plugin := &cfg.Plugins[i]
+		if commandargs.CommandType(plugin.Name) == command && plugin.Executable != "" {
+			return plugin
+		}
+	}
+
+	return nil
+}
+
+func (c *Command) Execute() error {
+	context, err := c.buildContext()
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"command":    context.Command,
+		"executable": c.Plugin.Executable,
+		"user_id":    context.UserId,
+		"username":   context.Username,
+		"gl_key_id":  context.KeyId,
+		"remote_ip":  context.RemoteIp,
+	}).Info("executing plugin")
+
+	return c.run(context)
+}
+
+func (c *Command) buildContext() (*Context, error) {
+	client, err := discover.NewClient(c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := client.GetByCommandArgs(c.Args)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get username: %v", err)
+	}
+
+	if user.IsAnonymous() {
+		return nil, fmt.Errorf("%s is only available to GitLab users", c.Plugin.Name)
+	}
+
+	return &Context{
+		Version:  contextVersion,
+		Command:  c.Plugin.Name,
+		Args:     c.Args.SshArgs[1:],
+		UserId:   user.UserId,
+		Username: user.Username,
+		Name:     user.Name,
+		KeyId:    c.Args.GitlabKeyId,
+		RemoteIp: sshenv.LocalAddr(),
+	}, nil
+}
+
+func (c *Command) run(context *Context) error {
+	payload, err := json.Marshal(context)
+	if err != nil {
+		return err
+	}
+
+	contextReader, contextWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(c.Plugin.Executable, context.Args...)
+	cmd.Stdin = c.ReadWriter.In
+	cmd.Stdout = c.ReadWriter.Out
+	cmd.Stderr = c.ReadWriter.ErrOut
+	cmd.ExtraFiles = []*os.File{contextReader}
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", contextFdEnv, contextFd))
+
+	err = cmd.Start()
+	contextReader.Close()
+	if err != nil {
+		contextWriter.Close()
+		log.WithError(err).WithFields(log.Fields{"executable": c.Plugin.Executable}).Error("Unable to start plugin")
+		return fmt.Errorf("%s is currently unavailable", c.Plugin.Name)
+	}
+
+	// Plugins that don't read the context must not block the write
+	go func() {
+		contextWriter.Write(payload)
+		contextWriter.Close()
+	}()
+
+	err = cmd.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() > 0 {
+		return &ExitError{Name: c.Plugin.Name, Code: exitErr.ExitCode()}
+	}
+
+	return err
+}
@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
+)
+
+// The script prints its context, arguments and input, and exits with the
+// status given as first argument
+const script = `#!/bin/sh
+cat <&3
+echo "args: $*"
+echo "fd: $GITLAB_SHELL_CONTEXT_FD"
+cat
+echo "error output" >&2
+exit $1
+`
+
+var (
+	requests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/discover",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("key_id") == "1" {
+					json.NewEncoder(w).Encode(map[string]interface{}{"id": 2, "username": "alex-doe", "name": "Alex Doe"})
+				} else {
+					fmt.Fprint(w, "null")
+				}
+			},
+		},
+	}
+)
+
+func setup(t *testing.T) (*config.Config, func()) {
+	dir, err := ioutil.TempDir("", "plugin")
+	require.NoError(t, err)
+
+	executable := filepath.Join(dir, "deploy")
+	require.NoError(t, ioutil.WriteFile(executable, []byte(script), 0755))
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+
+	cfg := &config.Config{
+		GitlabUrl: url,
+		Plugins: []config.PluginConfig{
+			{Name: "deploy", Executable: executable},
+			{Name: "missing", Executable: filepath.Join(dir, "missing")},
+		},
+	}
+
+	return cfg, func() {
+		cleanup()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	restoreEnv := testhelper.TempEnv(map[string]string{"SSH_CONNECTION": "127.0.0.1 0"})
+	defer restoreEnv()
+
+	output := &bytes.Buffer{}
+	errOutput := &bytes.Buffer{}
+	cmd := &Command{
+		Config:     cfg,
+		Args:       &commandargs.Shell{GitlabKeyId: "1", SshArgs: []string{"deploy", "0", "production"}},
+		ReadWriter: &readwriter.ReadWriter{Out: output, ErrOut: errOutput, In: strings.NewReader("input\n")},
+		Plugin:     Find(cfg, "deploy"),
+	}
+
+	require.NoError(t, cmd.Execute())
+
+	expectedContext := `{"version":1,"command":"deploy","args":["0","production"],"user_id":2,"username":"alex-doe","name":"Alex Doe","key_id":"1","remote_ip":"127.0.0.1"}`
+	require.Equal(t, expectedContext+"args: 0 production\nfd: 3\ninput\n", output.String())
+	require.Equal(t, "error output\n", errOutput.String())
+}
+
+func TestFailingExecute(t *testing.T) {
+	cfg, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		keyId         string
+		arguments     []string
+		expectedError error
+	}{
+		{
+			desc:          "When the plugin fails",
+			keyId:         "1",
+			arguments:     []string{"deploy", "3"},
+			expectedError: &ExitError{Name: "deploy", Code: 3},
+		},
+		{
+			desc:          "When the plugin can't be started",
+			keyId:         "1",
+			arguments:     []string{"missing"},
+			expectedError: fmt.Errorf("missing is currently unavailable"),
+		},
+		{
+			desc:          "With an unknown user",
+			keyId:         "2",
+			arguments:     []string{"deploy", "0"},
+			expectedError: fmt.Errorf("deploy is only available to GitLab users"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cmd := &Command{
+				Config:     cfg,
+				Args:       &commandargs.Shell{GitlabKeyId: tc.keyId, SshArgs: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}, In: strings.NewReader("")},
+				Plugin:     Find(cfg, commandargs.CommandType(tc.arguments[0])),
+			}
+
+			require.Equal(t, tc.expectedError, cmd.Execute())
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	cfg := &config.Config{
+		Plugins: []config.PluginConfig{
+			{Name: "deploy", Executable: "/opt/plugins/deploy"},
+			{Name: "git-upload-pack", Executable: "/opt/plugins/upload-pack"},
+			{Name: "ticket"},
+		},
+	}
+
+	require.Equal(t, &cfg.Plugins[0], Find(cfg, "deploy"))
+	require.Nil(t, Find(cfg, commandargs.UploadPack))
+	require.Nil(t, Find(cfg, "ticket"))
+	require.Nil(t, Find(cfg, "unknown"))
+}
@@ -0,0 +1,56 @@
+package principals
+
+import (
+	"errors"
+	"fmt"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/keyline"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/principals"
+)
+
+// Command shows how the configured rules map the given principals without
+// touching GitLab, to help writing rules for a certificate authority.
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.GenericArgs
+	ReadWriter *readwriter.ReadWriter
+}
+
+func (c *Command) Execute() error {
+	given := c.Args.Arguments[1:]
+	if len(given) == 0 {
+		return errors.New("Usage: check principals <principal1> [<principal2>...]")
+	}
+
+	rules := c.Config.AuthorizedPrincipals.Rules
+	mapper, err := principals.NewMapper(rules)
+	if err != nil {
+		return err
+	}
+
+	for _, principal := range given {
+		mapping := mapper.Map(principal)
+
+		switch {
+		case mapping.Issued && mapping.Dropped:
+			fmt.Fprintf(c.ReadWriter.Out, "%s: dropped, issued by gitlab-shell without a username\n", principal)
+		case mapping.Issued:
+			fmt.Fprintf(c.ReadWriter.Out, "%s: %s, issued by gitlab-shell\n", principal, mapping.Principal)
+		case mapping.Rule == 0 && mapping.Dropped:
+			fmt.Fprintf(c.ReadWriter.Out, "%s: dropped, no rule matched\n", principal)
+		case mapping.Dropped:
+			fmt.Fprintf(c.ReadWriter.Out, "%s: dropped, rule %d (%s) produced an empty principal\n", principal, mapping.Rule, rules[mapping.Rule-1].Match)
+		case mapping.Rule == 0:
+			fmt.Fprintf(c.ReadWriter.Out, "%s: %s, no rules configured\n", principal, mapping.Principal)
+		case keyline.ValidateId(mapping.Principal) != nil:
+			fmt.Fprintf(c.ReadWriter.Out, "%s: skipped, rule %d (%s) produced the invalid username %s\n", principal, mapping.Rule, rules[mapping.Rule-1].Match, mapping.Principal)
+		default:
+			fmt.Fprintf(c.ReadWriter.Out, "%s: %s, rule %d (%s)\n", principal, mapping.Principal, mapping.Rule, rules[mapping.Rule-1].Match)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package principals
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+func TestExecute(t *testing.T) {
+	configWithRules := &config.Config{
+		AuthorizedPrincipals: config.AuthorizedPrincipalsConfig{
+			Rules: []config.PrincipalRule{
+				{Match: `@corp\.example\z`},
+				{Match: `\Aeng:(.+)\z`, Replace: "$1"},
+				{Match: `\Aops:(.+)\z`, Replace: "$1"},
+			},
+		},
+	}
+
+	testCases := []struct {
+		desc           string
+		config         *config.Config
+		arguments      []string
+		expectedOutput string
+	}{
+		{
+			desc:           "Without rules",
+			config:         &config.Config{},
+			arguments:      []string{"principals", "jdoe@corp.example"},
+			expectedOutput: "jdoe@corp.example: jdoe@corp.example, no rules configured\n",
+		},
+		{
+			desc:      "With rules",
+			config:    configWithRules,
+			arguments: []string{"principals", "jdoe@corp.example", "gitlab-shell:jdoe", "eng:asmith", "ops:j.doe", "root", "@corp.example"},
+			expectedOutput: "jdoe@corp.example: jdoe, rule 1 (@corp\\.example\\z)\n" +
+				"gitlab-shell:jdoe: jdoe, issued by gitlab-shell\n" +
+				"eng:asmith: asmith, rule 2 (\\Aeng:(.+)\\z)\n" +
+				"ops:j.doe: skipped, rule 3 (\\Aops:(.+)\\z) produced the invalid username j.doe\n" +
+				"root: dropped, no rule matched\n" +
+				"@corp.example: dropped, rule 1 (@corp\\.example\\z) produced an empty principal\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     tc.config,
+				Args:       &commandargs.GenericArgs{Arguments: tc.arguments},
+				ReadWriter: &readwriter.ReadWriter{Out: output},
+			}
+
+			require.NoError(t, cmd.Execute())
+			require.Equal(t, tc.expectedOutput, output.String())
+		})
+	}
+}
+
+func TestFailingExecute(t *testing.T) {
+	cmd := &Command{
+		Config:     &config.Config{},
+		Args:       &commandargs.GenericArgs{Arguments: []string{"principals"}},
+		ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}},
+	}
+
+	require.EqualError(t, cmd.Execute(), "Usage: check principals <principal1> [<principal2>...]")
+}
@@ -0,0 +1,445 @@
+package receivepack
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/pktline"
+)
+
+const (
+	reviewRefPrefix = "refs/for/"
+	zeroOid         = "0000000000000000000000000000000000000000"
+
+	sidebandCapability    = "side-band"
+	sideband64kCapability = "side-band-64k"
+	pushOptionsCapability = "push-options"
+
+	sidebandData = 1
+)
+
+var (
+	SignedReviewPushError = errors.New("Signed pushes can't create merge requests, push to refs/for/<branch> without --signed")
+
+	titleOptions       = []string{"title=", "merge_request.title="}
+	descriptionOptions = []string{"description=", "merge_request.description="}
+)
+
+// reviewPush is the update of a refs/for/<target>[/<topic>] ref. The commits
+// are stored under the hidden ref, and GitLab creates or updates a merge
+// request from it. Each user has a single hidden ref per target, updated by
+// every push to it.
+type reviewPush struct {
+	Ref       string
+	HiddenRef string
+	Oid       string
+
+	// Status is ok or ng as reported by git, empty when not reported
+	Status string
+}
+
+func (p *reviewPush) Target() string {
+	return strings.TrimPrefix(p.Ref, reviewRefPrefix)
+}
+
+// agitSession rewrites review pushes between the client and Gitaly. The
+// client asks for refs/for/<target> and gets the status of that ref, Gitaly
+// receives and reports the hidden ref instead.
+type agitSession struct {
+	hiddenRefPrefix string
+
+	mu          sync.Mutex
+	pushes      []*reviewPush
+	sideband    bool
+	title       string
+	description string
+	err         error
+
+	// advertised holds the oids Gitaly advertised for the hidden refs. The
+	// client doesn't know them, it sends the zero oid as old oid.
+	advertised map[string]string
+}
+
+func newAgitSession(hiddenRefPrefix string) *agitSession {
+	return &agitSession{hiddenRefPrefix: hiddenRefPrefix, advertised: make(map[string]string)}
+}
+
+// Pushes returns the review pushes that weren't rejected
+func (s *agitSession) Pushes() []*reviewPush {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pushes []*reviewPush
+	for _, push := range s.pushes {
+		if push.Status != "ng" {
+			pushes = append(pushes, push)
+		}
+	}
+
+	return pushes
+}
+
+// Err returns why the push was refused before reaching Gitaly
+func (s *agitSession) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Options returns the title and description given as push options
+func (s *agitSession) Options() (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.title, s.description
+}
+
+func (s *agitSession) Reader(in io.Reader) io.Reader {
+	return &agitReader{session: s, in: bufio.NewReader(in)}
+}
+
+func (s *agitSession) Writer(out io.Writer) *agitWriter {
+	return &agitWriter{session: s, out: out}
+}
+
+// rewriteCommands reads the commands and push options sent by the client and
+// returns them with review refs replaced. Signed pushes can't be rewritten,
+// the signature covers the ref names.
+func (s *agitSession) rewriteCommands(in *bufio.Reader) ([]byte, error) {
+	var header bytes.Buffer
+	var capabilities []string
+
+	for first := true; ; first = false {
+		pkt, err := pktline.Read(in)
+		if err != nil {
+			return header.Bytes(), err
+		}
+
+		if pktline.IsFlush(pkt) {
+			header.Write(pkt)
+			break
+		}
+
+		payload := pktline.Payload(pkt)
+		if first && bytes.HasPrefix(payload, []byte("push-cert")) {
+			header.Write(pkt)
+			return s.checkSignedCommands(in, &header)
+		}
+
+		command := string(payload)
+		if first {
+			if i := strings.IndexByte(command, 0); i >= 0 {
+				capabilities = strings.Fields(command[i+1:])
+			}
+		}
+
+		header.Write(pktline.Encode([]byte(s.rewriteCommand(command))))
+	}
+
+	s.mu.Lock()
+	s.sideband = hasCapability(capabilities, sidebandCapability) || hasCapability(capabilities, sideband64kCapability)
+	s.mu.Unlock()
+
+	if !hasCapability(capabilities, pushOptionsCapability) {
+		return header.Bytes(), nil
+	}
+
+	for {
+		pkt, err := pktline.Read(in)
+		if err != nil {
+			return header.Bytes(), err
+		}
+
+		header.Write(pkt)
+		if pktline.IsFlush(pkt) {
+			return header.Bytes(), nil
+		}
+
+		s.parseOption(strings.TrimSuffix(string(pktline.Payload(pkt)), "\n"))
+	}
+}
+
+// checkSignedCommands passes on the rest of a signed command list, unless a
+// command updates a review ref. Gitaly is then given no commands, so nothing
+// is stored under refs/for/, and the push is refused.
+func (s *agitSession) checkSignedCommands(in *bufio.Reader, header *bytes.Buffer) ([]byte, error) {
+	for {
+		pkt, err := pktline.Read(in)
+		if err != nil {
+			return header.Bytes(), err
+		}
+
+		header.Write(pkt)
+		if pktline.IsFlush(pkt) {
+			return header.Bytes(), nil
+		}
+
+		fields := strings.Fields(string(pktline.Payload(pkt)))
+		if len(fields) == 3 && strings.HasPrefix(fields[2], reviewRefPrefix) {
+			s.mu.Lock()
+			s.err = SignedReviewPushError
+			s.mu.Unlock()
+
+			return pktline.PktFlush(), io.EOF
+		}
+	}
+}
+
+// recordAdvertisedRef keeps the oid of an "<oid> <ref>[\0<capabilities>]"
+// advertisement line when the ref is a hidden ref.
+func (s *agitSession) recordAdvertisedRef(line []byte) {
+	advertised := string(line)
+	if i := strings.IndexAny(advertised, "\x00\n"); i >= 0 {
+		advertised = advertised[:i]
+	}
+
+	fields := strings.Split(advertised, " ")
+	if len(fields) != 2 || !strings.HasPrefix(fields[1], s.hiddenRefPrefix) {
+		return
+	}
+
+	s.mu.Lock()
+	s.advertised[fields[1]] = fields[0]
+	s.mu.Unlock()
+}
+
+// rewriteCommand replaces the ref of "<old> <new> <ref>[\0<capabilities>]"
+// when it's a review ref, and the old oid with the one of the hidden ref.
+// Deleting review refs makes no sense, those are passed on for Gitaly to
+// reject.
+func (s *agitSession) rewriteCommand(command string) string {
+	line, suffix := command, ""
+	if i := strings.IndexAny(command, "\x00\n"); i >= 0 {
+		line, suffix = command[:i], command[i:]
+	}
+
+	fields := strings.Split(line, " ")
+	if len(fields) != 3 || !strings.HasPrefix(fields[2], reviewRefPrefix) || fields[1] == zeroOid {
+		return command
+	}
+
+	push := &reviewPush{Ref: fields[2], Oid: fields[1]}
+	if push.Target() == "" {
+		return command
+	}
+
+	push.HiddenRef = s.hiddenRefPrefix + push.Target()
+
+	s.mu.Lock()
+	s.pushes = append(s.pushes, push)
+	oldOid, ok := s.advertised[push.HiddenRef]
+	s.mu.Unlock()
+
+	if !ok {
+		oldOid = zeroOid
+	}
+
+	return strings.Join([]string{oldOid, fields[1], push.HiddenRef}, " ") + suffix
+}
+
+func (s *agitSession) parseOption(option string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, prefix := range titleOptions {
+		if strings.HasPrefix(option, prefix) {
+			s.title = strings.TrimPrefix(option, prefix)
+		}
+	}
+
+	for _, prefix := range descriptionOptions {
+		if strings.HasPrefix(option, prefix) {
+			s.description = strings.TrimPrefix(option, prefix)
+		}
+	}
+}
+
+// rewriteStatus replaces the hidden ref of an "ok <ref>" or
+// "ng <ref> <reason>" report line with the ref the client pushed to.
+func (s *agitSession) rewriteStatus(line []byte) []byte {
+	fields := strings.SplitN(strings.TrimSuffix(string(line), "\n"), " ", 3)
+	if len(fields) < 2 || (fields[0] != "ok" && fields[0] != "ng") {
+		return line
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, push := range s.pushes {
+		if push.HiddenRef == fields[1] {
+			push.Status = fields[0]
+			fields[1] = push.Ref
+
+			return []byte(strings.Join(fields, " ") + "\n")
+		}
+	}
+
+	return line
+}
+
+func (s *agitSession) usesSideband() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sideband
+}
+
+func hasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
+}
+
+// agitReader passes the client's input to Gitaly, with the commands
+// rewritten. The packfile following them is passed as is.
+type agitReader struct {
+	session *agitSession
+	in      *bufio.Reader
+	header  *bytes.Reader
+	err     error
+}
+
+func (r *agitReader) Read(p []byte) (int, error) {
+	if r.header == nil {
+		header, err := r.session.rewriteCommands(r.in)
+		r.header = bytes.NewReader(header)
+		r.err = err
+	}
+
+	if r.header.Len() > 0 {
+		return r.header.Read(p)
+	}
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	return r.in.Read(p)
+}
+
+// agitWriter passes Gitaly's output to the client, with the hidden refs in
+// the report replaced. With sideband, the report is sent in band 1 and its
+// lines may be split across sideband packets.
+type agitWriter struct {
+	session *agitSession
+	out     io.Writer
+
+	buffer     []byte
+	report     []byte
+	advertised bool
+	broken     bool
+}
+
+func (w *agitWriter) Write(p []byte) (int, error) {
+	if w.broken {
+		return w.out.Write(p)
+	}
+
+	w.buffer = append(w.buffer, p...)
+
+	for {
+		pkt, err := pktline.Split(w.buffer)
+		if err != nil {
+			// Not git protocol, e.g. an error message, it's passed on
+			w.broken = true
+			if err := w.Flush(); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+
+		if pkt == nil {
+			return len(p), nil
+		}
+
+		w.buffer = w.buffer[len(pkt):]
+		if err := w.writePkt(pkt); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Flush writes the data that doesn't form a complete packet as is
+func (w *agitWriter) Flush() error {
+	if len(w.report) > 0 {
+		if err := w.write(pktline.Encode(append([]byte{sidebandData}, w.report...))); err != nil {
+			return err
+		}
+		w.report = nil
+	}
+
+	if len(w.buffer) > 0 {
+		if err := w.write(w.buffer); err != nil {
+			return err
+		}
+		w.buffer = nil
+	}
+
+	return nil
+}
+
+func (w *agitWriter) writePkt(pkt []byte) error {
+	// The ref advertisement is sent before any command
+	if !w.advertised {
+		w.advertised = pktline.IsFlush(pkt)
+		if !w.advertised {
+			w.session.recordAdvertisedRef(pktline.Payload(pkt))
+		}
+
+		return w.write(pkt)
+	}
+
+	if !w.session.usesSideband() {
+		return w.writeReportPkt(pkt, nil)
+	}
+
+	payload := pktline.Payload(pkt)
+	if len(payload) == 0 || payload[0] != sidebandData {
+		return w.write(pkt)
+	}
+
+	w.report = append(w.report, payload[1:]...)
+	for {
+		reportPkt, err := pktline.Split(w.report)
+		if err != nil {
+			// Not a report, e.g. the data of a custom action
+			return w.Flush()
+		}
+
+		if reportPkt == nil {
+			return nil
+		}
+
+		w.report = w.report[len(reportPkt):]
+		if err := w.writeReportPkt(reportPkt, []byte{sidebandData}); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *agitWriter) writeReportPkt(pkt, band []byte) error {
+	if payload := pktline.Payload(pkt); len(payload) > 0 {
+		pkt = pktline.Encode(w.session.rewriteStatus(payload))
+	}
+
+	if band != nil {
+		pkt = pktline.Encode(append(band, pkt...))
+	}
+
+	return w.write(pkt)
+}
+
+func (w *agitWriter) write(pkt []byte) error {
+	_, err := w.out.Write(pkt)
+
+	return err
+}
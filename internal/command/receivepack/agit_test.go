@@ -0,0 +1,232 @@
+package receivepack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/pktline"
+)
+
+const (
+	oldOid = "1111111111111111111111111111111111111111"
+	newOid = "2222222222222222222222222222222222222222"
+)
+
+func pkts(payloads ...string) string {
+	var b strings.Builder
+	for _, payload := range payloads {
+		if payload == "" {
+			b.WriteString("0000")
+		} else {
+			b.Write(pktline.Encode([]byte(payload)))
+		}
+	}
+
+	return b.String()
+}
+
+func sideband(band byte, data string) string {
+	return string(pktline.Encode(append([]byte{band}, data...)))
+}
+
+func newTestSession() *agitSession {
+	return newAgitSession("refs/agit/1/")
+}
+
+func TestAgitReader(t *testing.T) {
+	testCases := []struct {
+		desc                string
+		input               string
+		expectedOutput      string
+		expectedPushes      []*reviewPush
+		expectedTitle       string
+		expectedDescription string
+		expectedErr         error
+	}{
+		{
+			desc: "With review pushes and push options",
+			input: pkts(
+				zeroOid+" "+newOid+" refs/for/main/topic\x00report-status side-band-64k push-options",
+				oldOid+" "+newOid+" refs/heads/feature",
+				"",
+				"title=Fix the build",
+				"description=It was broken",
+				"",
+			) + "PACK data",
+			expectedOutput: pkts(
+				zeroOid+" "+newOid+" refs/agit/1/main/topic\x00report-status side-band-64k push-options",
+				oldOid+" "+newOid+" refs/heads/feature",
+				"",
+				"title=Fix the build",
+				"description=It was broken",
+				"",
+			) + "PACK data",
+			expectedPushes:      []*reviewPush{{Ref: "refs/for/main/topic", HiddenRef: "refs/agit/1/main/topic", Oid: newOid}},
+			expectedTitle:       "Fix the build",
+			expectedDescription: "It was broken",
+		},
+		{
+			desc:           "With GitLab push options",
+			input:          pkts(zeroOid+" "+newOid+" refs/for/main\x00push-options", "", "merge_request.title=Fix", "") + "PACK",
+			expectedOutput: pkts(zeroOid+" "+newOid+" refs/agit/1/main\x00push-options", "", "merge_request.title=Fix", "") + "PACK",
+			expectedPushes: []*reviewPush{{Ref: "refs/for/main", HiddenRef: "refs/agit/1/main", Oid: newOid}},
+			expectedTitle:  "Fix",
+		},
+		{
+			desc:           "Without review pushes",
+			input:          pkts(oldOid+" "+newOid+" refs/heads/main\x00report-status", "") + "PACK",
+			expectedOutput: pkts(oldOid+" "+newOid+" refs/heads/main\x00report-status", "") + "PACK",
+		},
+		{
+			desc:           "Deleting a review ref",
+			input:          pkts(oldOid+" "+zeroOid+" refs/for/main\x00report-status", ""),
+			expectedOutput: pkts(oldOid+" "+zeroOid+" refs/for/main\x00report-status", ""),
+		},
+		{
+			desc:           "Without a target",
+			input:          pkts(zeroOid+" "+newOid+" refs/for/\x00report-status", "") + "PACK",
+			expectedOutput: pkts(zeroOid+" "+newOid+" refs/for/\x00report-status", "") + "PACK",
+		},
+		{
+			desc:           "With a signed push",
+			input:          pkts("push-cert\x00report-status", "certificate version 0.1\n", "\n", oldOid+" "+newOid+" refs/heads/main\n", "push-cert-end\n", "") + "PACK",
+			expectedOutput: pkts("push-cert\x00report-status", "certificate version 0.1\n", "\n", oldOid+" "+newOid+" refs/heads/main\n", "push-cert-end\n", "") + "PACK",
+		},
+		{
+			desc:           "With a signed review push",
+			input:          pkts("push-cert\x00report-status", "certificate version 0.1\n", "\n", zeroOid+" "+newOid+" refs/for/main\n", "push-cert-end\n", "") + "PACK",
+			expectedOutput: pkts(""),
+			expectedErr:    SignedReviewPushError,
+		},
+		{
+			desc:           "Without commands",
+			input:          pkts(""),
+			expectedOutput: pkts(""),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			session := newTestSession()
+
+			output, err := ioutil.ReadAll(session.Reader(strings.NewReader(tc.input)))
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedOutput, string(output))
+			require.Equal(t, tc.expectedPushes, session.Pushes())
+			require.Equal(t, tc.expectedErr, session.Err())
+
+			title, description := session.Options()
+			require.Equal(t, tc.expectedTitle, title)
+			require.Equal(t, tc.expectedDescription, description)
+		})
+	}
+}
+
+func TestAgitReaderUpdatingHiddenRef(t *testing.T) {
+	session := newTestSession()
+
+	// The hidden ref of an earlier push is advertised before the commands
+	advertisement := pkts(oldOid+" refs/agit/1/main\x00report-status", oldOid+" refs/heads/main", "")
+	_, err := session.Writer(&bytes.Buffer{}).Write([]byte(advertisement))
+	require.NoError(t, err)
+
+	input := pkts(zeroOid+" "+newOid+" refs/for/main\x00report-status", zeroOid+" "+newOid+" refs/for/other", "") + "PACK"
+	output, err := ioutil.ReadAll(session.Reader(strings.NewReader(input)))
+	require.NoError(t, err)
+
+	expectedOutput := pkts(oldOid+" "+newOid+" refs/agit/1/main\x00report-status", zeroOid+" "+newOid+" refs/agit/1/other", "") + "PACK"
+	require.Equal(t, expectedOutput, string(output))
+}
+
+func TestAgitReaderTruncatedInput(t *testing.T) {
+	session := newTestSession()
+
+	_, err := ioutil.ReadAll(session.Reader(strings.NewReader(pkts(zeroOid + " " + newOid + " refs/for/main")[:20])))
+	require.Error(t, err)
+}
+
+func TestAgitWriter(t *testing.T) {
+	advertisement := pkts(oldOid+" refs/heads/main\x00report-status side-band-64k push-options", "")
+
+	testCases := []struct {
+		desc             string
+		capabilities     string
+		chunks           []string
+		expectedOutput   string
+		expectedStatuses []string
+	}{
+		{
+			desc:         "With sideband",
+			capabilities: "report-status side-band-64k",
+			chunks: []string{
+				advertisement[:10],
+				advertisement[10:],
+				sideband(2, "Resolving deltas: 100%\n"),
+				sideband(1, pkts("unpack ok\n")),
+				// Report packets may be split across sideband packets
+				sideband(1, pkts("ok refs/agit/1/main/topic\n", "ng refs/agit/1/other push declined\n")[:20]),
+				sideband(1, pkts("ok refs/agit/1/main/topic\n", "ng refs/agit/1/other push declined\n")[20:]),
+				sideband(1, pkts("ok refs/heads/feature\n", "")),
+				"0000",
+			},
+			expectedOutput: advertisement +
+				sideband(2, "Resolving deltas: 100%\n") +
+				sideband(1, pkts("unpack ok\n")) +
+				sideband(1, pkts("ok refs/for/main/topic\n")) +
+				sideband(1, pkts("ng refs/for/other push declined\n")) +
+				sideband(1, pkts("ok refs/heads/feature\n")) +
+				sideband(1, "0000") +
+				"0000",
+			expectedStatuses: []string{"ok", "ng"},
+		},
+		{
+			desc:         "Without sideband",
+			capabilities: "report-status",
+			chunks: []string{
+				advertisement,
+				pkts("unpack ok\n", "ok refs/agit/1/main/topic\n", "ng refs/agit/1/other push declined\n", ""),
+			},
+			expectedOutput:   advertisement + pkts("unpack ok\n", "ok refs/for/main/topic\n", "ng refs/for/other push declined\n", ""),
+			expectedStatuses: []string{"ok", "ng"},
+		},
+		{
+			desc:         "With an error message",
+			capabilities: "report-status",
+			chunks: []string{
+				"fatal: the remote end hung up",
+			},
+			expectedOutput:   "fatal: the remote end hung up",
+			expectedStatuses: []string{"", ""},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			session := newTestSession()
+			input := pkts(zeroOid+" "+newOid+" refs/for/main/topic\x00"+tc.capabilities, zeroOid+" "+newOid+" refs/for/other", "")
+			_, err := ioutil.ReadAll(session.Reader(strings.NewReader(input)))
+			require.NoError(t, err)
+
+			output := &bytes.Buffer{}
+			writer := session.Writer(output)
+			for _, chunk := range tc.chunks {
+				n, err := writer.Write([]byte(chunk))
+				require.NoError(t, err)
+				require.Equal(t, len(chunk), n)
+			}
+			require.NoError(t, writer.Flush())
+
+			require.Equal(t, tc.expectedOutput, output.String())
+
+			var statuses []string
+			for _, push := range session.pushes {
+				statuses = append(statuses, push.Status)
+			}
+			require.Equal(t, tc.expectedStatuses, statuses)
+		})
+	}
+}
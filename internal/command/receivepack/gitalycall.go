@@ -9,11 +9,12 @@ import (
 	"gitlab.com/gitlab-org/gitaly/client"
 	pb "gitlab.com/gitlab-org/gitaly/proto/go/gitalypb"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/shared/accessverifier"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/handler"
 )
 
-func (c *Command) performGitalyCall(response *accessverifier.Response) error {
+func (c *Command) performGitalyCall(response *accessverifier.Response, rw *readwriter.ReadWriter) (int32, error) {
 	gc := &handler.GitalyCommand{
 		Config:      c.Config,
 		ServiceName: string(commandargs.ReceivePack),
@@ -31,13 +32,38 @@ func (c *Command) performGitalyCall(response *accessverifier.Response) error {
 		GitConfigOptions: response.GitConfigOptions,
 	}
 
-	return gc.RunGitalyCommand(func(ctx context.Context, conn *grpc.ClientConn) (int32, error) {
+	session := c.startAgitSession(response)
+
+	var exitCode int32
+	err := gc.RunGitalyCommand(func(ctx context.Context, conn *grpc.ClientConn) (int32, error) {
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
 		gc.LogExecution(request.Repository, response, request.GitProtocol)
 
-		rw := c.ReadWriter
-		return client.ReceivePack(ctx, conn, rw.In, rw.Out, rw.ErrOut, request)
+		var err error
+		if session == nil {
+			exitCode, err = client.ReceivePack(ctx, conn, rw.In, rw.Out, rw.ErrOut, request)
+
+			return exitCode, err
+		}
+
+		writer := session.Writer(rw.Out)
+		exitCode, err = client.ReceivePack(ctx, conn, session.Reader(rw.In), writer, rw.ErrOut, request)
+		if flushErr := writer.Flush(); err == nil {
+			err = flushErr
+		}
+
+		if err == nil && session.Err() != nil {
+			return exitCode, session.Err()
+		}
+
+		if err == nil && exitCode == 0 {
+			c.createMergeRequests(response, session)
+		}
+
+		return exitCode, err
 	})
+
+	return exitCode, err
 }
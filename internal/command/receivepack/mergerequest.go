@@ -0,0 +1,83 @@
+package receivepack
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/shared/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/agit"
+)
+
+// startAgitSession prepares the rewriting of review pushes when GitLab
+// accepts them for this push, returning nil otherwise.
+func (c *Command) startAgitSession(response *accessverifier.Response) *agitSession {
+	prefix := response.AgitRefPrefix
+	if prefix == "" {
+		return nil
+	}
+
+	if !strings.HasPrefix(prefix, "refs/") || !strings.HasSuffix(prefix, "/") || strings.ContainsAny(prefix, " \x00\n") {
+		log.WithFields(log.Fields{"gl_repository": response.Repo, "ref_prefix": prefix}).Warn("Invalid hidden ref prefix for review pushes")
+		return nil
+	}
+
+	return newAgitSession(prefix)
+}
+
+// createMergeRequests creates or updates the merge requests of the review
+// pushes. The commits are pushed already, so failures are only reported.
+func (c *Command) createMergeRequests(response *accessverifier.Response, session *agitSession) {
+	pushes := session.Pushes()
+	if len(pushes) == 0 {
+		return
+	}
+
+	client, err := agit.NewClient(c.Config)
+	if err != nil {
+		log.WithError(err).Error("Unable to create merge requests")
+		return
+	}
+
+	title, description := session.Options()
+
+	for _, push := range pushes {
+		fields := log.Fields{
+			"gl_repository": response.Repo,
+			"ref":           push.Ref,
+			"hidden_ref":    push.HiddenRef,
+			"user_id":       response.UserId,
+		}
+
+		mr, err := client.MergeRequest(&agit.Request{
+			GlRepository: response.Repo,
+			UserId:       response.UserId,
+			Username:     response.Username,
+			Target:       push.Target(),
+			Ref:          push.HiddenRef,
+			Oid:          push.Oid,
+			Title:        title,
+			Description:  description,
+		})
+		if err != nil {
+			log.WithError(err).WithFields(fields).Warn("Failed to create merge request for review push")
+			console.DisplayWarningMessage(fmt.Sprintf("Unable to create a merge request for %s: %v", push.Ref, err), c.ReadWriter.ErrOut)
+			continue
+		}
+
+		fields["merge_request_iid"] = mr.MergeRequestIid
+		log.WithFields(fields).Info("Merge request updated by review push")
+
+		action := "updated"
+		if mr.Created {
+			action = "created"
+		}
+
+		console.DisplayInfoMessages([]string{
+			fmt.Sprintf("Merge request !%d %s for %s:", mr.MergeRequestIid, action, push.Target()),
+			"  " + mr.MergeRequestUrl,
+		}, c.ReadWriter.ErrOut)
+	}
+}
@@ -0,0 +1,98 @@
+package receivepack
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/shared/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/agit"
+)
+
+func TestCreateMergeRequests(t *testing.T) {
+	var requests []*agit.Request
+	handlers := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/agit_merge_request",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var request *agit.Request
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+				requests = append(requests, request)
+
+				if request.Target == "missing" {
+					body := map[string]interface{}{"success": false, "message": "The target branch doesn't exist"}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+					return
+				}
+
+				body := map[string]interface{}{
+					"success":           true,
+					"created":           true,
+					"merge_request_iid": 7,
+					"merge_request_url": "https://gitlab.example.com/group/project/-/merge_requests/7",
+				}
+				require.NoError(t, json.NewEncoder(w).Encode(body))
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, handlers)
+	defer cleanup()
+
+	session := newTestSession()
+	session.title = "Fix the build"
+	session.pushes = []*reviewPush{
+		{Ref: "refs/for/main/topic", HiddenRef: "refs/agit/1/main/topic", Oid: newOid, Status: "ok"},
+		{Ref: "refs/for/declined", HiddenRef: "refs/agit/1/declined", Oid: newOid, Status: "ng"},
+		{Ref: "refs/for/missing", HiddenRef: "refs/agit/1/missing", Oid: newOid},
+	}
+
+	errOut := &bytes.Buffer{}
+	cmd := &Command{
+		Config:     &config.Config{GitlabUrl: url},
+		ReadWriter: &readwriter.ReadWriter{ErrOut: errOut},
+	}
+
+	response := &accessverifier.Response{Repo: "project-1", UserId: "user-1", Username: "jane"}
+	cmd.createMergeRequests(response, session)
+
+	require.Equal(t, []*agit.Request{
+		{GlRepository: "project-1", UserId: "user-1", Username: "jane", Target: "main/topic", Ref: "refs/agit/1/main/topic", Oid: newOid, Title: "Fix the build"},
+		{GlRepository: "project-1", UserId: "user-1", Username: "jane", Target: "missing", Ref: "refs/agit/1/missing", Oid: newOid, Title: "Fix the build"},
+	}, requests)
+
+	require.Contains(t, errOut.String(), "remote: Merge request !7 created for main/topic:\nremote:   https://gitlab.example.com/group/project/-/merge_requests/7\n")
+	require.Contains(t, errOut.String(), "remote: Unable to create a merge request for refs/for/missing: The target branch doesn't exist\n")
+}
+
+func TestStartAgitSession(t *testing.T) {
+	cmd := &Command{Config: &config.Config{}}
+
+	testCases := []struct {
+		prefix   string
+		expected bool
+	}{
+		{prefix: "", expected: false},
+		{prefix: "refs/agit/1/", expected: true},
+		{prefix: "refs/agit/1", expected: false},
+		{prefix: "heads/agit/1/", expected: false},
+		{prefix: "refs/agit 1/", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.prefix, func(t *testing.T) {
+			session := cmd.startAgitSession(&accessverifier.Response{AgitRefPrefix: tc.prefix})
+			require.Equal(t, tc.expected, session != nil)
+
+			if session != nil {
+				require.Equal(t, tc.prefix, session.hiddenRefPrefix)
+			}
+		})
+	}
+}
@@ -2,16 +2,35 @@ package accessverifier
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/background"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/denials"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/accessverifier"
+	keylocationnet "gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/keylocation"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/keylocation"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/projectid"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/ratelimit"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/sshenv"
 )
 
 type Response = accessverifier.Response
 
+var (
+	AnonymousRateLimitedError  = errors.New("Too many anonymous requests from your address, please try again later or use a registered SSH key")
+	EnrollmentRateLimitedError = errors.New("Too many enrollment attempts from your address, please try again later")
+)
+
 type Command struct {
 	Config     *config.Config
 	Args       *commandargs.Shell
@@ -19,6 +38,12 @@ type Command struct {
 }
 
 func (c *Command) Verify(action commandargs.CommandType, repo string) (*Response, error) {
+	start := time.Now()
+
+	if err := c.Guard(); err != nil {
+		return nil, err
+	}
+
 	client, err := accessverifier.NewClient(c.Config)
 	if err != nil {
 		return nil, err
@@ -26,18 +51,281 @@ func (c *Command) Verify(action commandargs.CommandType, repo string) (*Response
 
 	response, err := client.Verify(c.Args, action, repo)
 	if err != nil {
+		if IsDenialError(err) {
+			c.RecordDenial()
+
+			if c.hidesDenial(action) {
+				return nil, c.uniformDenial(action, repo, err.Error(), start)
+			}
+		}
+
 		return nil, err
 	}
 
+	if !response.Success {
+		c.RecordDenial()
+
+		// Console messages may explain the denial too
+		if c.hidesDenial(action) {
+			return nil, c.uniformDenial(action, repo, response.Message, start)
+		}
+	}
+
 	c.displayConsoleMessages(response.ConsoleMessages)
 
 	if !response.Success {
 		return nil, errors.New(response.Message)
 	}
 
+	if err := c.checkRegion(response, repo); err != nil {
+		return nil, err
+	}
+
+	if projectid.Parse(repo) != nil {
+		c.logProjectIdPath(action, repo, response)
+	}
+
+	if c.Config.KeyLocationAlerts.Enabled && c.Args.GitlabKeyId != "" {
+		keyId, remoteIp := c.Args.GitlabKeyId, sshenv.LocalAddr()
+		background.Go(func() { c.checkKeyLocation(keyId, remoteIp) })
+	}
+
 	return response, nil
 }
 
+// hidesDenial tells whether the reason a read was denied is hidden. Pushes
+// happen after a clone, their denials don't reveal anything new.
+func (c *Command) hidesDenial(action commandargs.CommandType) bool {
+	return c.Config.UniformDenials.Enabled && (action == commandargs.UploadPack || action == commandargs.UploadArchive)
+}
+
+// Guard refuses requests before GitLab is asked: identities denied too often
+// and anonymous requests over the rate limit. Commands that don't verify
+// access with Verify call it directly.
+func (c *Command) Guard() error {
+	if c.Config.DenialBlocking.Enabled {
+		if err := c.checkBlocked(); err != nil {
+			return err
+		}
+	}
+
+	// Anonymous requests are limited per source IP independently of the limits
+	// GitLab applies to authenticated users.
+	if c.Args.IsAnonymous() {
+		settings := c.Config.AnonymousSsh
+		if err := c.checkRateLimit("anonymous", settings.RateLimit, settings.RateLimitWindowSeconds, AnonymousRateLimitedError); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GuardEnrollment refuses enrollment attempts of identities denied too often
+// and over the enrollment rate limit, which is separate from the anonymous
+// one so it applies without anonymous SSH access.
+func (c *Command) GuardEnrollment() error {
+	if c.Config.DenialBlocking.Enabled {
+		if err := c.checkBlocked(); err != nil {
+			return err
+		}
+	}
+
+	settings := c.Config.Enrollment
+
+	return c.checkRateLimit("enrollment", settings.RateLimit, settings.RateLimitWindowSeconds, EnrollmentRateLimitedError)
+}
+
+// IsDenialError tells whether GitLab denied the request. Only the statuses
+// GitLab denies access with are denials, other errors don't depend on the
+// project. Forbidden projects are reported as 401.
+func IsDenialError(err error) bool {
+	apiErr, ok := err.(*client.ApiError)
+
+	if !ok {
+		return false
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return true
+	default:
+		return false
+	}
+}
+
+// uniformDenial logs why access was denied and returns the same error for
+// any reason, no sooner than the minimum latency after start.
+func (c *Command) uniformDenial(action commandargs.CommandType, repo, reason string, start time.Time) error {
+	log.WithFields(log.Fields{
+		"command":         string(action),
+		"gl_project_path": repo,
+		"reason":          reason,
+	}).Info("Read access denied")
+
+	minLatency := time.Duration(c.Config.UniformDenials.MinLatencyMs) * time.Millisecond
+	if elapsed := time.Since(start); elapsed < minLatency {
+		time.Sleep(minLatency - elapsed)
+	}
+
+	return errors.New(c.Config.UniformDenials.Message)
+}
+
+// logProjectIdPath tells which project a project-id/<id> path resolved to,
+// the other logs only show either of them.
+func (c *Command) logProjectIdPath(action commandargs.CommandType, repo string, response *Response) {
+	log.WithFields(log.Fields{
+		"command":         string(action),
+		"project_id_path": repo,
+		"gl_project_path": response.Gitaly.Repo.GlProjectPath,
+		"gl_repository":   response.Repo,
+	}).Info("Resolved project ID path")
+}
+
 func (c *Command) displayConsoleMessages(messages []string) {
 	console.DisplayInfoMessages(messages, c.ReadWriter.ErrOut)
 }
+
+// Projects are only served from the nodes of the region they are stored in,
+// which is checked before any connection to Gitaly is made.
+func (c *Command) checkRegion(response *Response, repo string) error {
+	region := response.ProjectRegion
+	if c.Config.Region == "" || region == "" || region == c.Config.Region {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"gl_project_path":   repo,
+		"gl_project_region": region,
+		"region":            c.Config.Region,
+	}).Warn("Project requested from another region")
+
+	if response.RegionSshHost != "" {
+		project := strings.TrimSuffix(strings.Trim(repo, "/"), ".git")
+
+		console.DisplayWarningMessages([]string{
+			fmt.Sprintf("This project is served by %s. Update your remote with:", response.RegionSshHost),
+			"",
+			"  git remote set-url origin " + c.Config.SshUrl(response.RegionSshHost, project),
+		}, c.ReadWriter.ErrOut)
+	}
+
+	return fmt.Errorf("This project is stored in the %s region and can't be accessed from the %s region", region, c.Config.Region)
+}
+
+// denialIdentities are the identities denials are counted for: the SSH key or
+// user, and the address the request comes from.
+func (c *Command) denialIdentities() []string {
+	var identities []string
+
+	if c.Args.GitlabKeyId != "" {
+		identities = append(identities, "key-"+c.Args.GitlabKeyId)
+	} else if c.Args.GitlabUsername != "" {
+		identities = append(identities, "username-"+c.Args.GitlabUsername)
+	}
+
+	if remoteIp := sshenv.LocalAddr(); remoteIp != "" {
+		identities = append(identities, "ip-"+remoteIp)
+	}
+
+	return identities
+}
+
+func (c *Command) denialTracker() *denials.Tracker {
+	return &denials.Tracker{Dir: c.Config.StateDir, Config: c.Config.DenialBlocking}
+}
+
+// Identities denied too often are refused without asking GitLab, scanning
+// project paths would otherwise cost an /allowed call per attempt.
+func (c *Command) checkBlocked() error {
+	block, err := c.denialTracker().Blocked(c.denialIdentities()...)
+	if err != nil {
+		// Failing to read the blocks shouldn't make GitLab unavailable
+		log.WithError(err).Error("Unable to check denial blocks")
+		return nil
+	}
+
+	if block == nil {
+		return nil
+	}
+
+	log.WithFields(log.Fields{"identity": block.Identity, "blocked_until": block.Until}).Info("Request refused, too many denied requests")
+
+	return fmt.Errorf("Too many of your requests were denied. Try again after %s.", block.Until.UTC().Format("2006-01-02 15:04 MST"))
+}
+
+// RecordDenial counts a request GitLab denied against its identities
+func (c *Command) RecordDenial() {
+	if !c.Config.DenialBlocking.Enabled {
+		return
+	}
+
+	blocked, expired, err := c.denialTracker().RecordDenial(c.denialIdentities()...)
+	if err != nil {
+		log.WithError(err).Error("Unable to record the denied request")
+		return
+	}
+
+	for _, identity := range expired {
+		log.WithFields(log.Fields{"identity": identity}).Info("Denial block expired")
+	}
+
+	for _, block := range blocked {
+		log.WithFields(log.Fields{"identity": block.Identity, "blocked_until": block.Until}).Warn("Blocked after too many denied requests")
+	}
+}
+
+// checkRateLimit counts the request of the address under name and refuses it
+// with rateLimitedErr over the limit.
+func (c *Command) checkRateLimit(name string, limit int, windowSeconds uint64, rateLimitedErr error) error {
+	limiter := &ratelimit.Limiter{
+		Name:   name,
+		Dir:    c.Config.StateDir,
+		Limit:  limit,
+		Window: time.Duration(windowSeconds) * time.Second,
+	}
+
+	remoteIp := sshenv.LocalAddr()
+	allowed, err := limiter.Allow(remoteIp)
+	if err != nil {
+		// Failing to persist the counters shouldn't make the command unavailable
+		log.WithError(err).WithFields(log.Fields{"rate_limit": name}).Error("Unable to apply rate limit")
+		return nil
+	}
+
+	if !allowed {
+		log.WithFields(log.Fields{"remote_ip": remoteIp, "rate_limit": name}).Info("Request rate limited")
+		return rateLimitedErr
+	}
+
+	return nil
+}
+
+// A key used from a new network may have been stolen. GitLab is notified so
+// it can alert the owner, the transfer itself isn't delayed.
+func (c *Command) checkKeyLocation(keyId, remoteIp string) {
+	tracker := &keylocation.Tracker{Dir: c.Config.StateDir, Config: c.Config.KeyLocationAlerts}
+	prefix, isNew, err := tracker.Record(keyId, remoteIp)
+	if err != nil {
+		log.WithError(err).Error("Unable to record the location of the SSH key")
+		return
+	}
+
+	if !isNew {
+		return
+	}
+
+	fields := log.Fields{"gl_key_id": keyId, "ip_prefix": prefix, "remote_ip": remoteIp}
+
+	client, err := keylocationnet.NewClient(c.Config)
+	if err == nil {
+		err = client.Notify(&keylocationnet.Request{KeyId: keyId, IpPrefix: prefix, RemoteIp: remoteIp})
+	}
+
+	if err != nil {
+		log.WithError(err).WithFields(fields).Error("Unable to send the new SSH key location alert")
+		return
+	}
+
+	log.WithFields(fields).Info("SSH key used from a new location")
+}
@@ -5,15 +5,20 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/background"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/keylocation"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
 )
 
 var (
@@ -33,7 +38,21 @@ func setup(t *testing.T) (*Command, *bytes.Buffer, *bytes.Buffer, func()) {
 				err = json.Unmarshal(b, &requestBody)
 				require.NoError(t, err)
 
-				if requestBody.KeyId == "1" {
+				if requestBody.KeyId == "" && requestBody.Username == "" {
+					body := map[string]interface{}{
+						"status":  true,
+						"message": "anonymous",
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+				} else if requestBody.KeyId == "3" {
+					w.WriteHeader(http.StatusForbidden)
+					require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"message": "You are not allowed to push code to this project."}))
+				} else if requestBody.KeyId == "4" {
+					w.WriteHeader(http.StatusUnauthorized)
+					require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"message": "Unauthorized"}))
+				} else if requestBody.KeyId == "5" {
+					w.WriteHeader(http.StatusInternalServerError)
+				} else if requestBody.KeyId == "1" {
 					body := map[string]interface{}{
 						"gl_console_messages": []string{"console", "message"},
 					}
@@ -80,3 +99,355 @@ func TestConsoleMessages(t *testing.T) {
 	require.Equal(t, "remote: \nremote: console\nremote: message\nremote: \n", errBuf.String())
 	require.Empty(t, outBuf.String())
 }
+
+func TestAnonymousRateLimit(t *testing.T) {
+	cmd, _, _, cleanup := setup(t)
+	defer cleanup()
+
+	stateDir, err := ioutil.TempDir("", "gitlab-shell-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(stateDir)
+
+	restoreEnv := testhelper.TempEnv(map[string]string{"SSH_CONNECTION": "127.0.0.1 0"})
+	defer restoreEnv()
+
+	cmd.Config.StateDir = stateDir
+	cmd.Config.AnonymousSsh = config.AnonymousSshConfig{Enabled: true, RateLimit: 1, RateLimitWindowSeconds: 60}
+	cmd.Args = &commandargs.Shell{Anonymous: true}
+
+	response, err := cmd.Verify(commandargs.UploadPack, repo)
+	require.NoError(t, err)
+	require.Equal(t, "anonymous", response.Message)
+
+	_, err = cmd.Verify(commandargs.UploadPack, repo)
+	require.Equal(t, AnonymousRateLimitedError, err)
+}
+
+func TestKeyLocationAlerts(t *testing.T) {
+	var alerts []string
+
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/allowed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"status": true}))
+			},
+		},
+		{
+			Path: "/api/v4/internal/key_location_alerts",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var request *keylocation.Request
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+				alerts = append(alerts, request.KeyId+" "+request.IpPrefix+" "+request.RemoteIp)
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	stateDir, err := ioutil.TempDir("", "gitlab-shell-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(stateDir)
+
+	cfg := &config.Config{GitlabUrl: url, StateDir: stateDir}
+	cfg.KeyLocationAlerts = config.KeyLocationAlertsConfig{Enabled: true, IPv4PrefixLength: 24, IPv6PrefixLength: 48, MaxPrefixesPerKey: 10, MaxKeys: 10}
+
+	cmd := &Command{
+		Config:     cfg,
+		Args:       &commandargs.Shell{GitlabKeyId: "1"},
+		ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}},
+	}
+
+	for _, remoteIp := range []string{"192.0.2.10", "192.0.2.11", "198.51.100.1", "198.51.100.2"} {
+		restoreEnv := testhelper.TempEnv(map[string]string{"SSH_CONNECTION": remoteIp + " 1234 127.0.0.1 22"})
+
+		_, err := cmd.Verify(commandargs.UploadPack, repo)
+		require.NoError(t, err)
+		require.True(t, background.Wait(time.Second))
+
+		restoreEnv()
+	}
+
+	require.Equal(t, []string{"1 198.51.100.0/24 198.51.100.1"}, alerts)
+}
+
+func TestRegion(t *testing.T) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/allowed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var request *accessverifier.Request
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+				body := map[string]interface{}{"status": true, "gl_project_region": "eu"}
+				if request.Repo != "group/no-host.git" {
+					body["gl_region_ssh_host"] = "eu.gitlab.example.com"
+				}
+
+				require.NoError(t, json.NewEncoder(w).Encode(body))
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		region        string
+		repo          string
+		expectedError string
+		expectedOut   string
+	}{
+		{
+			desc: "Without a configured region",
+			repo: "group/repo.git",
+		},
+		{
+			desc:   "In the same region",
+			region: "eu",
+			repo:   "group/repo.git",
+		},
+		{
+			desc:          "In another region",
+			region:        "us",
+			repo:          "/group/repo.git",
+			expectedError: "This project is stored in the eu region and can't be accessed from the us region",
+			expectedOut:   "remote: This project is served by eu.gitlab.example.com. Update your remote with:\nremote: \nremote:   git remote set-url origin git@eu.gitlab.example.com:group/repo.git\n",
+		},
+		{
+			desc:          "In another region without a host",
+			region:        "us",
+			repo:          "group/no-host.git",
+			expectedError: "This project is stored in the eu region and can't be accessed from the us region",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			errBuf := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     &config.Config{GitlabUrl: url, Region: tc.region, Sshd: config.SshdConfig{User: "git"}},
+				Args:       &commandargs.Shell{GitlabKeyId: "1"},
+				ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, ErrOut: errBuf},
+			}
+
+			_, err := cmd.Verify(commandargs.UploadPack, tc.repo)
+			if tc.expectedError == "" {
+				require.NoError(t, err)
+				require.Empty(t, errBuf.String())
+				return
+			}
+
+			require.EqualError(t, err, tc.expectedError)
+			require.Contains(t, errBuf.String(), tc.expectedOut)
+		})
+	}
+}
+
+func TestDenialBlocking(t *testing.T) {
+	cmd, _, _, cleanup := setup(t)
+	defer cleanup()
+
+	stateDir, err := ioutil.TempDir("", "gitlab-shell-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(stateDir)
+
+	restoreEnv := testhelper.TempEnv(map[string]string{"SSH_CONNECTION": "192.0.2.1 1234 127.0.0.1 22"})
+	defer restoreEnv()
+
+	cmd.Config.StateDir = stateDir
+	cmd.Config.DenialBlocking = config.DenialBlockingConfig{Enabled: true, MaxDenials: 3, WindowSeconds: 60, BlockDurationSeconds: 600}
+
+	// GitLab errors that aren't denials aren't counted
+	cmd.Args = &commandargs.Shell{GitlabKeyId: "5"}
+	for i := 0; i < 3; i++ {
+		_, err = cmd.Verify(action, repo)
+		require.EqualError(t, err, "Internal API error (500)")
+	}
+
+	// GitLab denies access with an error status or a false status
+	cmd.Args = &commandargs.Shell{GitlabKeyId: "3"}
+	_, err = cmd.Verify(action, repo)
+	require.EqualError(t, err, "You are not allowed to push code to this project.")
+
+	cmd.Args = &commandargs.Shell{GitlabKeyId: "4"}
+	_, err = cmd.Verify(action, repo)
+	require.EqualError(t, err, "Unauthorized")
+
+	cmd.Args = &commandargs.Shell{GitlabKeyId: "2"}
+	_, err = cmd.Verify(action, repo)
+	require.EqualError(t, err, "missing user")
+
+	_, err = cmd.Verify(action, repo)
+	require.Regexp(t, `\AToo many of your requests were denied\. Try again after \d{4}-\d\d-\d\d \d\d:\d\d UTC\.\z`, err.Error())
+
+	// The address is blocked too
+	cmd.Args = &commandargs.Shell{GitlabKeyId: "1"}
+	_, err = cmd.Verify(action, repo)
+	require.Regexp(t, `\AToo many of your requests were denied`, err.Error())
+}
+
+func TestUniformDenials(t *testing.T) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/allowed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var request *accessverifier.Request
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+				var body map[string]interface{}
+				switch request.KeyId {
+				case "1":
+					body = map[string]interface{}{"status": true}
+				case "2":
+					w.WriteHeader(http.StatusNotFound)
+					body = map[string]interface{}{"message": "The project you were looking for could not be found."}
+				case "3":
+					body = map[string]interface{}{
+						"status":              false,
+						"message":             "You are not allowed to download code from this project.",
+						"gl_console_messages": []string{"Ask a maintainer for access"},
+					}
+				case "5":
+					w.WriteHeader(http.StatusUnauthorized)
+					body = map[string]interface{}{"message": "You are not allowed to download code from this project."}
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+
+				if body != nil {
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+				}
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	minLatency := 50 * time.Millisecond
+	message := "Not found or not allowed"
+
+	testCases := []struct {
+		desc          string
+		keyId         string
+		action        commandargs.CommandType
+		expectedError string
+		expectedLog   string
+	}{
+		{
+			desc:   "An allowed fetch",
+			keyId:  "1",
+			action: commandargs.UploadPack,
+		},
+		{
+			desc:          "A fetch from a missing project",
+			keyId:         "2",
+			action:        commandargs.UploadPack,
+			expectedError: message,
+			expectedLog:   `reason="The project you were looking for could not be found."`,
+		},
+		{
+			desc:          "A forbidden archive",
+			keyId:         "3",
+			action:        commandargs.UploadArchive,
+			expectedError: message,
+			expectedLog:   `reason="You are not allowed to download code from this project."`,
+		},
+		{
+			desc:          "A fetch from a forbidden project",
+			keyId:         "5",
+			action:        commandargs.UploadPack,
+			expectedError: message,
+			expectedLog:   `reason="You are not allowed to download code from this project."`,
+		},
+		{
+			desc:          "A forbidden push",
+			keyId:         "3",
+			action:        commandargs.ReceivePack,
+			expectedError: "You are not allowed to download code from this project.",
+		},
+		{
+			desc:          "A failing API",
+			keyId:         "4",
+			action:        commandargs.UploadPack,
+			expectedError: "Internal API error (500)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			errBuf := &bytes.Buffer{}
+			cmd := &Command{
+				Config: &config.Config{
+					GitlabUrl:      url,
+					UniformDenials: config.UniformDenialsConfig{Enabled: true, Message: message, MinLatencyMs: int(minLatency / time.Millisecond)},
+				},
+				Args:       &commandargs.Shell{GitlabKeyId: tc.keyId},
+				ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, ErrOut: errBuf},
+			}
+
+			hook := testhelper.SetupLogger()
+			start := time.Now()
+
+			_, err := cmd.Verify(tc.action, repo)
+			if tc.expectedError == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.EqualError(t, err, tc.expectedError)
+
+			if tc.expectedLog == "" {
+				return
+			}
+
+			require.True(t, time.Since(start) >= minLatency)
+			require.Empty(t, errBuf.String())
+
+			require.True(t, testhelper.WaitForLogEvent(hook))
+			entry := hook.LastEntry()
+			require.Contains(t, entry.Message, "Read access denied")
+			require.Contains(t, entry.Message, tc.expectedLog)
+		})
+	}
+}
+
+func TestProjectIdPath(t *testing.T) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/allowed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				body := map[string]interface{}{
+					"status":        true,
+					"gl_repository": "project-1234",
+					"gitaly": map[string]interface{}{
+						"repository": map[string]interface{}{"gl_project_path": "group/renamed"},
+					},
+				}
+				require.NoError(t, json.NewEncoder(w).Encode(body))
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	readWriter := &readwriter.ReadWriter{Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}}
+	cmd := &Command{Config: &config.Config{GitlabUrl: url}, Args: &commandargs.Shell{GitlabKeyId: "1"}, ReadWriter: readWriter}
+
+	hook := testhelper.SetupLogger()
+
+	response, err := cmd.Verify(commandargs.UploadPack, "project-id/1234.git")
+	require.NoError(t, err)
+	require.Equal(t, "group/renamed", response.Gitaly.Repo.GlProjectPath)
+
+	require.True(t, testhelper.WaitForLogEvent(hook))
+	entry := hook.LastEntry()
+	require.Contains(t, entry.Message, "Resolved project ID path")
+	require.Contains(t, entry.Message, "project_id_path=project-id/1234.git")
+	require.Contains(t, entry.Message, "gl_project_path=group/renamed")
+}
@@ -3,6 +3,8 @@ package customaction
 import (
 	"bytes"
 	"errors"
+	"net/url"
+	"strings"
 
 	"gitlab.com/gitlab-org/gitlab-shell/client"
 
@@ -17,6 +19,10 @@ import (
 	"gitlab.com/gitlab-org/gitlab-shell/internal/pktline"
 )
 
+var (
+	InvalidEndpointError = errors.New("Custom action error: Invalid API endpoint")
+)
+
 type Request struct {
 	SecretToken []byte                           `json:"secret_token"`
 	Data        accessverifier.CustomPayloadData `json:"data"`
@@ -42,9 +48,75 @@ func (c *Command) Execute(response *accessverifier.Response) error {
 		return errors.New("Custom action error: Empty API endpoints")
 	}
 
+	if err := c.validateApiEndpoints(data); err != nil {
+		return err
+	}
+
 	return c.processApiEndpoints(response)
 }
 
+// The endpoints come from the /allowed response and receive the shared
+// secret and the user's data, so they are all checked before any is used.
+func (c *Command) validateApiEndpoints(data accessverifier.CustomPayloadData) error {
+	settings := c.Config.CustomActions
+
+	if settings.MaxEndpoints > 0 && len(data.ApiEndpoints) > settings.MaxEndpoints {
+		log.WithFields(log.Fields{
+			"primary_repo":  data.PrimaryRepo,
+			"endpoints":     len(data.ApiEndpoints),
+			"max_endpoints": settings.MaxEndpoints,
+		}).Warn("Custom action rejected: too many API endpoints")
+
+		return InvalidEndpointError
+	}
+
+	for _, endpoint := range data.ApiEndpoints {
+		if err := validateApiEndpoint(endpoint, settings.AllowedEndpointPrefixes); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"primary_repo": data.PrimaryRepo,
+				"endpoint":     endpoint,
+			}).Warn("Custom action rejected: invalid API endpoint")
+
+			return InvalidEndpointError
+		}
+	}
+
+	return nil
+}
+
+func validateApiEndpoint(endpoint string, allowedPrefixes []string) error {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
+	if parsed.Scheme != "" || parsed.Host != "" || parsed.Opaque != "" || !strings.HasPrefix(endpoint, "/") || strings.HasPrefix(endpoint, "//") {
+		return errors.New("not a path on the GitLab server")
+	}
+
+	if strings.Contains(endpoint, "\\") {
+		return errors.New("backslash in path")
+	}
+
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment == "." || segment == ".." {
+			return errors.New("path traversal")
+		}
+	}
+
+	if len(allowedPrefixes) == 0 {
+		return nil
+	}
+
+	for _, prefix := range allowedPrefixes {
+		if strings.HasPrefix(parsed.Path, prefix) {
+			return nil
+		}
+	}
+
+	return errors.New("path outside of the allowed prefixes")
+}
+
 func (c *Command) processApiEndpoints(response *accessverifier.Response) error {
 	client, err := gitlabnet.GetClient(c.Config)
 
@@ -13,6 +13,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
 )
 
 func TestExecuteEOFSent(t *testing.T) {
@@ -154,3 +155,95 @@ func TestExecuteNoEOFSent(t *testing.T) {
 	// and "output" string from the second request
 	require.Equal(t, "customoutput", outBuf.String())
 }
+
+func TestExecuteInvalidEndpoints(t *testing.T) {
+	requested := false
+
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				requested = true
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	testCases := []struct {
+		desc            string
+		endpoints       []string
+		allowedPrefixes []string
+		expectedLog     string
+	}{
+		{
+			desc:        "With an absolute URL",
+			endpoints:   []string{"/geo/proxy/info_refs", "https://attacker.example.com/receive_pack"},
+			expectedLog: "not a path on the GitLab server",
+		},
+		{
+			desc:        "With a protocol-relative URL",
+			endpoints:   []string{"//attacker.example.com/receive_pack"},
+			expectedLog: "not a path on the GitLab server",
+		},
+		{
+			desc:        "With a relative path",
+			endpoints:   []string{"geo/proxy/info_refs"},
+			expectedLog: "not a path on the GitLab server",
+		},
+		{
+			desc:        "With path traversal",
+			endpoints:   []string{"/geo/proxy/../../admin"},
+			expectedLog: "path traversal",
+		},
+		{
+			desc:        "With encoded path traversal",
+			endpoints:   []string{"/geo/proxy/%2e%2e/admin"},
+			expectedLog: "path traversal",
+		},
+		{
+			desc:            "Outside of the allowed prefixes",
+			endpoints:       []string{"/api/v4/geo/proxy_git_ssh/info_refs", "/api/v4/internal/allowed"},
+			allowedPrefixes: []string{"/api/v4/geo/"},
+			expectedLog:     "path outside of the allowed prefixes",
+		},
+		{
+			desc:        "With too many endpoints",
+			endpoints:   []string{"/1", "/2", "/3"},
+			expectedLog: "too many API endpoints",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			hook := testhelper.SetupLogger()
+
+			response := &accessverifier.Response{
+				Who: "key-1",
+				Payload: accessverifier.CustomPayload{
+					Action: "geo_proxy_to_primary",
+					Data:   accessverifier.CustomPayloadData{ApiEndpoints: tc.endpoints},
+				},
+			}
+
+			cfg := &config.Config{
+				GitlabUrl:     url,
+				CustomActions: config.CustomActionsConfig{AllowedEndpointPrefixes: tc.allowedPrefixes, MaxEndpoints: 2},
+			}
+
+			cmd := &Command{
+				Config:     cfg,
+				ReadWriter: &readwriter.ReadWriter{ErrOut: &bytes.Buffer{}, Out: &bytes.Buffer{}, In: &bytes.Buffer{}},
+			}
+
+			require.Equal(t, InvalidEndpointError, cmd.Execute(response))
+			require.False(t, requested)
+
+			require.True(t, testhelper.WaitForLogEvent(hook))
+			entries := hook.AllEntries()
+			require.Contains(t, entries[len(entries)-1].Message, "level=warning")
+			require.Contains(t, entries[len(entries)-1].Message, tc.expectedLog)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package transferreport
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/background"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/transferreport"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/logger"
+)
+
+// Report measures a git transfer and tells GitLab how it ended. GitLab only
+// hears about transfers through /allowed otherwise, before any data moves.
+type Report struct {
+	config   *config.Config
+	request  *transferreport.Request
+	in       *countingReader
+	out      *countingWriter
+	start    time.Time
+	disabled bool
+}
+
+type countingReader struct {
+	io.Reader
+	count int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	atomic.AddInt64(&r.count, int64(n))
+
+	return n, err
+}
+
+type countingWriter struct {
+	io.Writer
+	count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	atomic.AddInt64(&w.count, int64(n))
+
+	return n, err
+}
+
+// Start begins measuring a transfer. The returned ReadWriter counts the bytes
+// going through it and must be used for the transfer.
+func Start(cfg *config.Config, response *accessverifier.Response, action, protocol string, rw *readwriter.ReadWriter) (*Report, *readwriter.ReadWriter) {
+	if !cfg.TransferReports.Enabled {
+		return &Report{disabled: true}, rw
+	}
+
+	report := &Report{
+		config: cfg,
+		request: &transferreport.Request{
+			Action:       action,
+			GlRepository: response.Repo,
+			ProjectPath:  response.Gitaly.Repo.GlProjectPath,
+			UserId:       response.UserId,
+			Username:     response.Username,
+			KeyId:        response.KeyId,
+			GitProtocol:  protocol,
+		},
+		in:    &countingReader{Reader: rw.In},
+		out:   &countingWriter{Writer: rw.Out},
+		start: time.Now(),
+	}
+
+	return report, &readwriter.ReadWriter{In: report.in, Out: report.out, ErrOut: rw.ErrOut}
+}
+
+// Finish sends the report in the background, the exit isn't delayed beyond
+// the background budget.
+func (r *Report) Finish(exitCode int32, err error) {
+	if r.disabled {
+		return
+	}
+
+	request := r.request
+	request.ExitCode = exitCode
+	request.BytesIn = atomic.LoadInt64(&r.in.count)
+	request.BytesOut = atomic.LoadInt64(&r.out.count)
+	request.DurationMs = logger.ElapsedTimeMs(r.start, time.Now())
+	if err != nil {
+		request.Error = err.Error()
+	}
+
+	timeout := time.Duration(r.config.TransferReports.TimeoutMs) * time.Millisecond
+	background.Go(func() { send(r.config, timeout, request) })
+}
+
+// send gives up waiting for GitLab after timeout, the request is abandoned
+// along with the process.
+func send(cfg *config.Config, timeout time.Duration, request *transferreport.Request) {
+	done := make(chan error, 1)
+	go func() {
+		client, err := transferreport.NewClient(cfg)
+		if err == nil {
+			err = client.Send(request)
+		}
+		done <- err
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		err = fmt.Errorf("No response after %v", timeout)
+	}
+
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"command":       request.Action,
+			"gl_repository": request.GlRepository,
+		}).Error("Unable to send the transfer report")
+	}
+}
@@ -0,0 +1,140 @@
+package transferreport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	pb "gitlab.com/gitlab-org/gitaly/proto/go/gitalypb"
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/background"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/transferreport"
+)
+
+var (
+	response = &accessverifier.Response{
+		Repo:     "project-1",
+		UserId:   "user-1",
+		Username: "alex-doe",
+		KeyId:    42,
+		Gitaly:   accessverifier.Gitaly{Repo: pb.Repository{GlProjectPath: "group/project"}},
+	}
+)
+
+func TestReport(t *testing.T) {
+	var reports []*transferreport.Request
+
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/git_transfer_completed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var request *transferreport.Request
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+				reports = append(reports, request)
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	testCases := []struct {
+		desc      string
+		exitCode  int32
+		err       error
+		errorText string
+	}{
+		{
+			desc: "A successful transfer",
+		},
+		{
+			desc:      "An aborted transfer",
+			exitCode:  128,
+			err:       errors.New("context canceled"),
+			errorText: "context canceled",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			reports = nil
+
+			cfg := &config.Config{GitlabUrl: url, TransferReports: config.TransferReportsConfig{Enabled: true, TimeoutMs: 1000}}
+			rw := &readwriter.ReadWriter{In: strings.NewReader("0009want\n"), Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}}
+
+			report, counted := Start(cfg, response, "git-upload-pack", "version=2", rw)
+			_, err := ioutil.ReadAll(counted.In)
+			require.NoError(t, err)
+			_, err = counted.Out.Write([]byte("0008NAK\n0000"))
+			require.NoError(t, err)
+
+			report.Finish(tc.exitCode, tc.err)
+			require.True(t, background.Wait(time.Second))
+
+			require.Len(t, reports, 1)
+			require.InDelta(t, 0, reports[0].DurationMs, 1000)
+			reports[0].DurationMs = 0
+
+			require.Equal(t, &transferreport.Request{
+				Action:       "git-upload-pack",
+				GlRepository: "project-1",
+				ProjectPath:  "group/project",
+				UserId:       "user-1",
+				Username:     "alex-doe",
+				KeyId:        42,
+				GitProtocol:  "version=2",
+				ExitCode:     tc.exitCode,
+				Error:        tc.errorText,
+				BytesIn:      9,
+				BytesOut:     12,
+			}, reports[0])
+		})
+	}
+}
+
+func TestDisabledReport(t *testing.T) {
+	rw := &readwriter.ReadWriter{In: strings.NewReader(""), Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}}
+
+	report, counted := Start(&config.Config{}, response, "git-upload-pack", "", rw)
+	require.Equal(t, rw, counted)
+
+	report.Finish(0, nil)
+	require.True(t, background.Wait(time.Second))
+}
+
+func TestSlowReport(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/git_transfer_completed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	cfg := &config.Config{GitlabUrl: url, TransferReports: config.TransferReportsConfig{Enabled: true, TimeoutMs: 10}}
+	rw := &readwriter.ReadWriter{In: strings.NewReader(""), Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}}
+
+	report, _ := Start(cfg, response, "git-upload-pack", "", rw)
+	report.Finish(0, nil)
+
+	// The report is given up on, the process doesn't wait for GitLab
+	require.True(t, background.Wait(time.Second))
+}
@@ -0,0 +1,136 @@
+package twofactorenable
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/twofactorenable"
+)
+
+const (
+	maxAttempts = 3
+)
+
+var (
+	otpRegex = regexp.MustCompile(`\A\d{6}\z`)
+
+	// inputTimeout is overridden in tests
+	inputTimeout = 2 * time.Minute
+
+	notEnabledMessage = "Two-factor authentication has *not* been enabled."
+)
+
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.Shell
+	ReadWriter *readwriter.ReadWriter
+}
+
+func (c *Command) Execute() error {
+	client, err := twofactorenable.NewClient(c.Config)
+	if err != nil {
+		return err
+	}
+
+	provision, err := client.Provision(c.Args)
+	if err != nil {
+		return fmt.Errorf("An error occurred while trying to set up two-factor authentication.\n%v", err)
+	}
+
+	c.displayProvision(provision)
+
+	lines := readLines(c.ReadWriter)
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		fmt.Fprint(c.ReadWriter.Out, "\nEnter the 6-digit code from your authenticator app: ")
+
+		otp, err := readOTP(lines)
+		if err != nil {
+			return fmt.Errorf("%v\n%s", err, notEnabledMessage)
+		}
+
+		if !otpRegex.MatchString(otp) {
+			fmt.Fprintln(c.ReadWriter.Out, "The code must be 6 digits.")
+			continue
+		}
+
+		activation, err := client.Activate(c.Args, otp)
+		if err != nil {
+			fmt.Fprintf(c.ReadWriter.Out, "The code could not be verified: %v\n", err)
+			continue
+		}
+
+		c.displayRecoveryCodes(activation.RecoveryCodes)
+
+		return nil
+	}
+
+	return fmt.Errorf("Too many invalid codes.\n%s", notEnabledMessage)
+}
+
+func (c *Command) displayProvision(provision *twofactorenable.Response) {
+	out := c.ReadWriter.Out
+
+	fmt.Fprintln(out, "Scan this QR code with your authenticator app:")
+	fmt.Fprintln(out)
+
+	// The code is only a convenience, the secret below is enough to set up
+	// an app by hand.
+	if code, err := qrcode.New(provision.ProvisionUri, qrcode.Medium); err == nil {
+		fmt.Fprint(out, code.ToSmallString(false))
+	}
+
+	fmt.Fprintf(out, "\nOr enter this secret manually: %s\n", provision.Secret)
+	fmt.Fprintf(out, "Provisioning URI: %s\n", provision.ProvisionUri)
+}
+
+func (c *Command) displayRecoveryCodes(codes []string) {
+	message :=
+		"\nTwo-factor authentication has been enabled.\n" +
+			"\nYour two-factor authentication recovery codes are:\n\n" +
+			strings.Join(codes, "\n") +
+			"\n\nSave these codes in a safe place. During sign in, use one of them\n" +
+			"when you don't have access to your authenticator app.\n"
+
+	fmt.Fprint(c.ReadWriter.Out, message)
+}
+
+// readLines reads the input in the background, so that waiting for it can
+// time out. The channel is closed at the end of the input.
+func readLines(rw *readwriter.ReadWriter) <-chan string {
+	lines := make(chan string)
+
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(rw.In)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	return lines
+}
+
+func readOTP(lines <-chan string) (string, error) {
+	select {
+	case line, ok := <-lines:
+		if !ok {
+			return "", errors.New("No confirmation code was entered.")
+		}
+
+		// Authenticator apps often display codes as "123 456"
+		return strings.Replace(strings.TrimSpace(line), " ", "", -1), nil
+	case <-time.After(inputTimeout):
+		return "", errors.New("Timed out waiting for a confirmation code.")
+	}
+}
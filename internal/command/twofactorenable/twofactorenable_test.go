@@ -0,0 +1,170 @@
+package twofactorenable
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/twofactorenable"
+)
+
+const (
+	provisionUri = "otpauth://totp/GitLab:jane-doe?secret=JBSWY3DPEHPK3PXP&issuer=GitLab"
+	prompt       = "\nEnter the 6-digit code from your authenticator app: "
+)
+
+func setup(t *testing.T) (string, func()) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/two_factor_otp_provision",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				requestBody := readRequestBody(t, r)
+
+				switch requestBody.KeyId {
+				case "1":
+					json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "secret": "JBSWY3DPEHPK3PXP", "provisioning_uri": provisionUri})
+				case "enabled":
+					json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "Two-factor authentication is already enabled"})
+				}
+			},
+		},
+		{
+			Path: "/api/v4/internal/two_factor_otp_activate",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				if readRequestBody(t, r).OTP != "123456" {
+					json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "Invalid code"})
+					return
+				}
+
+				json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "recovery_codes": []string{"recovery", "codes"}})
+			},
+		},
+	}
+
+	return testserver.StartSocketHttpServer(t, requests)
+}
+
+func readRequestBody(t *testing.T, r *http.Request) *twofactorenable.RequestBody {
+	b, err := ioutil.ReadAll(r.Body)
+	require.NoError(t, err)
+
+	var requestBody *twofactorenable.RequestBody
+	require.NoError(t, json.Unmarshal(b, &requestBody))
+
+	return requestBody
+}
+
+func TestExecute(t *testing.T) {
+	url, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc           string
+		input          string
+		expectedOutput string
+	}{
+		{
+			desc:  "With a valid code",
+			input: "123456\n",
+			expectedOutput: prompt +
+				"\nTwo-factor authentication has been enabled.\n" +
+				"\nYour two-factor authentication recovery codes are:\n\nrecovery\ncodes\n",
+		},
+		{
+			desc:  "With a code entered with spaces",
+			input: " 123 456 \n",
+			expectedOutput: prompt +
+				"\nTwo-factor authentication has been enabled.\n",
+		},
+		{
+			desc:  "With invalid codes first",
+			input: "12345\n654321\n123456\n",
+			expectedOutput: prompt + "The code must be 6 digits.\n" +
+				prompt + "The code could not be verified: Invalid code\n" +
+				prompt + "\nTwo-factor authentication has been enabled.\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cmd := &Command{
+				Config:     &config.Config{GitlabUrl: url},
+				Args:       &commandargs.Shell{GitlabKeyId: "1"},
+				ReadWriter: &readwriter.ReadWriter{Out: output, In: strings.NewReader(tc.input)},
+			}
+
+			require.NoError(t, cmd.Execute())
+
+			require.Contains(t, output.String(), "Scan this QR code with your authenticator app:\n\n")
+			require.Contains(t, output.String(), "\nOr enter this secret manually: JBSWY3DPEHPK3PXP\nProvisioning URI: "+provisionUri+"\n")
+			require.Contains(t, output.String(), tc.expectedOutput)
+		})
+	}
+}
+
+func TestFailingExecute(t *testing.T) {
+	url, cleanup := setup(t)
+	defer cleanup()
+
+	defer func(timeout time.Duration) { inputTimeout = timeout }(inputTimeout)
+	inputTimeout = 50 * time.Millisecond
+
+	// Nothing is ever written to the pipe
+	idleInput, _ := io.Pipe()
+
+	testCases := []struct {
+		desc          string
+		keyId         string
+		input         io.Reader
+		expectedError string
+	}{
+		{
+			desc:          "When 2FA is already enabled",
+			keyId:         "enabled",
+			input:         strings.NewReader(""),
+			expectedError: "An error occurred while trying to set up two-factor authentication.\nTwo-factor authentication is already enabled",
+		},
+		{
+			desc:          "When the input ends",
+			keyId:         "1",
+			input:         strings.NewReader(""),
+			expectedError: "No confirmation code was entered.\nTwo-factor authentication has *not* been enabled.",
+		},
+		{
+			desc:          "When no code is entered in time",
+			keyId:         "1",
+			input:         idleInput,
+			expectedError: "Timed out waiting for a confirmation code.\nTwo-factor authentication has *not* been enabled.",
+		},
+		{
+			desc:          "With too many invalid codes",
+			keyId:         "1",
+			input:         strings.NewReader("111111\n222222\n333333\n123456\n"),
+			expectedError: "Too many invalid codes.\nTwo-factor authentication has *not* been enabled.",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cmd := &Command{
+				Config:     &config.Config{GitlabUrl: url},
+				Args:       &commandargs.Shell{GitlabKeyId: tc.keyId},
+				ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, In: tc.input},
+			}
+
+			require.EqualError(t, cmd.Execute(), tc.expectedError)
+		})
+	}
+}
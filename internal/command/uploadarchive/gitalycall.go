@@ -8,11 +8,12 @@ import (
 	"gitlab.com/gitlab-org/gitaly/client"
 	pb "gitlab.com/gitlab-org/gitaly/proto/go/gitalypb"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/accessverifier"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/handler"
 )
 
-func (c *Command) performGitalyCall(response *accessverifier.Response) error {
+func (c *Command) performGitalyCall(response *accessverifier.Response, rw *readwriter.ReadWriter) (int32, error) {
 	gc := &handler.GitalyCommand{
 		Config:      c.Config,
 		ServiceName: string(commandargs.UploadArchive),
@@ -23,13 +24,18 @@ func (c *Command) performGitalyCall(response *accessverifier.Response) error {
 
 	request := &pb.SSHUploadArchiveRequest{Repository: &response.Gitaly.Repo}
 
-	return gc.RunGitalyCommand(func(ctx context.Context, conn *grpc.ClientConn) (int32, error) {
+	var exitCode int32
+	err := gc.RunGitalyCommand(func(ctx context.Context, conn *grpc.ClientConn) (int32, error) {
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
 		gc.LogExecution(request.Repository, response, "")
 
-		rw := c.ReadWriter
-		return client.UploadArchive(ctx, conn, rw.In, rw.Out, rw.ErrOut, request)
+		var err error
+		exitCode, err = client.UploadArchive(ctx, conn, rw.In, rw.Out, rw.ErrOut, request)
+
+		return exitCode, err
 	})
+
+	return exitCode, err
 }
@@ -2,16 +2,21 @@ package uploadarchive
 
 import (
 	"bytes"
+	"encoding/json"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/background"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/transferreport"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper/requesthandlers"
 )
@@ -52,3 +57,32 @@ func TestUploadPack(t *testing.T) {
 	require.Contains(t, entries[1].Message, "gl_key_type=key")
 	require.Contains(t, entries[1].Message, "gl_key_id=123")
 }
+
+func TestReportFailedConnection(t *testing.T) {
+	var reports []*transferreport.Request
+
+	requests := append(requesthandlers.BuildAllowedWithGitalyHandlers(t, ""), testserver.TestRequestHandler{
+		Path: "/api/v4/internal/git_transfer_completed",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			var report *transferreport.Request
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&report))
+			reports = append(reports, report)
+		},
+	})
+	url, cleanup := testserver.StartHttpServer(t, requests)
+	defer cleanup()
+
+	cmd := &Command{
+		Config:     &config.Config{GitlabUrl: url, TransferReports: config.TransferReportsConfig{Enabled: true, TimeoutMs: 1000}},
+		Args:       &commandargs.Shell{GitlabKeyId: "1", CommandType: commandargs.UploadArchive, SshArgs: []string{"git-upload-archive", "group/repo"}},
+		ReadWriter: &readwriter.ReadWriter{ErrOut: &bytes.Buffer{}, Out: &bytes.Buffer{}, In: &bytes.Buffer{}},
+	}
+
+	require.EqualError(t, cmd.Execute(), "no gitaly_address given")
+	require.True(t, background.Wait(time.Second))
+
+	require.Len(t, reports, 1)
+	require.Equal(t, "git-upload-archive", reports[0].Action)
+	require.Equal(t, "no gitaly_address given", reports[0].Error)
+	require.Zero(t, reports[0].BytesOut)
+}
@@ -5,6 +5,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/shared/accessverifier"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/shared/disallowedcommand"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/shared/transferreport"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
 )
 
@@ -26,11 +27,16 @@ func (c *Command) Execute() error {
 		return err
 	}
 
-	return c.performGitalyCall(response)
+	// Transfers failing before Gitaly sends anything are reported too
+	report, rw := transferreport.Start(c.Config, response, string(commandargs.UploadArchive), "", c.ReadWriter)
+	exitCode, err := c.performGitalyCall(response, rw)
+	report.Finish(exitCode, err)
+
+	return err
 }
 
 func (c *Command) verifyAccess(repo string) (*accessverifier.Response, error) {
-	cmd := accessverifier.Command{c.Config, c.Args, c.ReadWriter}
+	cmd := accessverifier.Command{Config: c.Config, Args: c.Args, ReadWriter: c.ReadWriter}
 
 	return cmd.Verify(c.Args.CommandType, repo)
 }
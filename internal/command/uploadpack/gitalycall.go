@@ -3,17 +3,19 @@ package uploadpack
 import (
 	"context"
 	"os"
+	"time"
 
 	"google.golang.org/grpc"
 
 	"gitlab.com/gitlab-org/gitaly/client"
 	pb "gitlab.com/gitlab-org/gitaly/proto/go/gitalypb"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/accessverifier"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/handler"
 )
 
-func (c *Command) performGitalyCall(response *accessverifier.Response) error {
+func (c *Command) performGitalyCall(response *accessverifier.Response, rw *readwriter.ReadWriter) (int32, error) {
 	gc := &handler.GitalyCommand{
 		Config:      c.Config,
 		ServiceName: string(commandargs.UploadPack),
@@ -28,13 +30,27 @@ func (c *Command) performGitalyCall(response *accessverifier.Response) error {
 		GitConfigOptions: response.GitConfigOptions,
 	}
 
-	return gc.RunGitalyCommand(func(ctx context.Context, conn *grpc.ClientConn) (int32, error) {
+	var exitCode int32
+	err := gc.RunGitalyCommand(func(ctx context.Context, conn *grpc.ClientConn) (int32, error) {
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
 		gc.LogExecution(request.Repository, response, request.GitProtocol)
 
-		rw := c.ReadWriter
-		return client.UploadPack(ctx, conn, rw.In, rw.Out, rw.ErrOut, request)
+		rw := rw
+		if seconds := c.Config.UploadPack.KeepaliveSeconds; seconds > 0 {
+			keepalive := newKeepalive(time.Duration(seconds)*time.Second, request.GitProtocol, rw.Out)
+			keepalive.Start()
+			defer keepalive.Stop()
+
+			rw = &readwriter.ReadWriter{In: keepalive.Reader(rw.In), Out: keepalive, ErrOut: rw.ErrOut}
+		}
+
+		var err error
+		exitCode, err = client.UploadPack(ctx, conn, rw.In, rw.Out, rw.ErrOut, request)
+
+		return exitCode, err
 	})
+
+	return exitCode, err
 }
@@ -58,3 +58,26 @@ func TestUploadPack(t *testing.T) {
 	}
 	assert.Empty(t, testServer.ReceivedMD["some-other-ff"])
 }
+
+func TestUploadPackWithKeepalive(t *testing.T) {
+	gitalyAddress, _, cleanup := testserver.StartGitalyServer(t)
+	defer cleanup()
+
+	requests := requesthandlers.BuildAllowedWithGitalyHandlers(t, gitalyAddress)
+	url, cleanup := testserver.StartHttpServer(t, requests)
+	defer cleanup()
+
+	output := &bytes.Buffer{}
+	repo := "group/repo"
+
+	cmd := &Command{
+		Config:     &config.Config{GitlabUrl: url, UploadPack: config.UploadPackConfig{KeepaliveSeconds: 1}},
+		Args:       &commandargs.Shell{GitlabKeyId: "1", CommandType: commandargs.UploadPack, SshArgs: []string{"git-upload-pack", repo}},
+		ReadWriter: &readwriter.ReadWriter{ErrOut: output, Out: output, In: &bytes.Buffer{}},
+	}
+
+	err := cmd.Execute()
+	require.NoError(t, err)
+
+	require.Equal(t, "UploadPack: "+repo, output.String())
+}
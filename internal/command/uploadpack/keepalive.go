@@ -0,0 +1,258 @@
+package uploadpack
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/pktline"
+)
+
+const (
+	sidebandCapability    = "side-band"
+	sideband64kCapability = "side-band-64k"
+
+	protocolV2 = "version=2"
+)
+
+var (
+	// Like git, the keepalive is an empty packet on the data band, which
+	// clients skip
+	keepalivePkt = []byte("0005\x01")
+
+	nakPayload      = []byte("NAK\n")
+	packfilePayload = []byte("packfile\n")
+)
+
+// pktParser splits a stream into packets while it's passed on. It gives up on
+// data that isn't made of packets.
+type pktParser struct {
+	buffer []byte
+	broken bool
+}
+
+func (p *pktParser) feed(data []byte, handle func(pkt []byte)) {
+	if p.broken {
+		return
+	}
+
+	p.buffer = append(p.buffer, data...)
+	for {
+		pkt, err := pktline.Split(p.buffer)
+		if err != nil {
+			p.broken = true
+			p.buffer = nil
+			return
+		}
+
+		if pkt == nil {
+			return
+		}
+
+		p.buffer = p.buffer[len(pkt):]
+		handle(pkt)
+	}
+}
+
+// atBoundary tells whether everything fed so far were whole packets
+func (p *pktParser) atBoundary() bool {
+	return !p.broken && len(p.buffer) == 0
+}
+
+// keepalive sends keepalives to the client while Gitaly generates the pack,
+// when nothing was sent for the interval, like git's uploadpack.keepAlive.
+// They're only possible once the client and Gitaly agreed on the pack being
+// sent with sideband, and between packets.
+//
+// With protocol v2 the pack follows the packfile section header. Otherwise
+// it follows Gitaly's answer to the client's done: a NAK or an ACK without
+// status. Gitaly answers each round of haves with a NAK too, those are
+// counted to tell the last NAK apart.
+type keepalive struct {
+	interval time.Duration
+	v2       bool
+	out      io.Writer
+	stop     chan struct{}
+
+	mu        sync.Mutex
+	lastWrite time.Time
+	inPack    bool
+	stopped   bool
+	err       error
+
+	// The client's side of the negotiation
+	client     pktParser
+	sideband   bool
+	wantsSent  bool
+	haveRounds int
+	done       bool
+
+	// Gitaly's side of the negotiation
+	gitaly  pktParser
+	naks    int
+	bareAck bool
+}
+
+func newKeepalive(interval time.Duration, gitProtocol string, out io.Writer) *keepalive {
+	return &keepalive{
+		interval:  interval,
+		v2:        strings.Contains(gitProtocol, protocolV2),
+		out:       out,
+		lastWrite: time.Now(),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start sends keepalives until Stop is called
+func (k *keepalive) Start() {
+	go func() {
+		timer := time.NewTimer(k.interval)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-k.stop:
+				return
+			case <-timer.C:
+				timer.Reset(k.send())
+			}
+		}
+	}()
+}
+
+func (k *keepalive) Stop() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if !k.stopped {
+		k.stopped = true
+		close(k.stop)
+	}
+}
+
+// Reader watches the client's input for the capabilities and the end of the
+// negotiation
+func (k *keepalive) Reader(in io.Reader) io.Reader {
+	return &keepaliveReader{keepalive: k, in: in}
+}
+
+type keepaliveReader struct {
+	keepalive *keepalive
+	in        io.Reader
+}
+
+func (r *keepaliveReader) Read(p []byte) (int, error) {
+	n, err := r.in.Read(p)
+	if n > 0 {
+		r.keepalive.readFromClient(p[:n])
+	}
+
+	return n, err
+}
+
+func (k *keepalive) readFromClient(data []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.v2 {
+		return
+	}
+
+	k.client.feed(data, func(pkt []byte) {
+		payload := pktline.Payload(pkt)
+
+		switch {
+		case pktline.IsFlush(pkt) && !k.wantsSent:
+			k.wantsSent = true
+		case pktline.IsFlush(pkt) && !k.done:
+			k.haveRounds++
+		case pktline.IsDone(pkt):
+			k.done = true
+			k.updateInPack()
+		case !k.wantsSent && bytes.HasPrefix(payload, []byte("want ")):
+			// The capabilities follow the object id of the first want
+			for _, capability := range strings.Fields(string(payload))[2:] {
+				if capability == sidebandCapability || capability == sideband64kCapability {
+					k.sideband = true
+				}
+			}
+		}
+	})
+}
+
+// Write passes Gitaly's output on, noting when the pack starts and ends
+func (k *keepalive) Write(p []byte) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.err != nil {
+		return 0, k.err
+	}
+
+	n, err := k.out.Write(p)
+	k.lastWrite = time.Now()
+	k.gitaly.feed(p[:n], k.writtenByGitaly)
+
+	return n, err
+}
+
+func (k *keepalive) writtenByGitaly(pkt []byte) {
+	payload := pktline.Payload(pkt)
+
+	if k.inPack {
+		// The pack ends with a flush, a v2 client may send another command
+		if pktline.IsFlush(pkt) {
+			k.inPack = false
+		}
+		return
+	}
+
+	if k.v2 {
+		k.inPack = bytes.Equal(payload, packfilePayload)
+		return
+	}
+
+	fields := strings.Fields(string(payload))
+	switch {
+	case bytes.Equal(payload, nakPayload):
+		k.naks++
+	case len(fields) == 2 && fields[0] == "ACK":
+		k.bareAck = true
+	}
+
+	k.updateInPack()
+}
+
+// updateInPack notes the start of the pack in protocol v0 and v1
+func (k *keepalive) updateInPack() {
+	if !k.done || !k.sideband {
+		return
+	}
+
+	k.inPack = k.bareAck || k.naks > k.haveRounds
+}
+
+// send writes a keepalive when nothing was written for the interval, and
+// returns when to check again
+func (k *keepalive) send() time.Duration {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	idle := time.Since(k.lastWrite)
+	if idle < k.interval {
+		return k.interval - idle
+	}
+
+	if k.stopped || k.err != nil || !k.inPack || !k.gitaly.atBoundary() {
+		return k.interval
+	}
+
+	if _, err := k.out.Write(keepalivePkt); err != nil {
+		k.err = err
+	}
+	k.lastWrite = time.Now()
+
+	return k.interval
+}
@@ -0,0 +1,196 @@
+package uploadpack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/pktline"
+)
+
+const (
+	testInterval = 10 * time.Millisecond
+	testIdle     = 50 * time.Millisecond
+
+	wantOid = "1111111111111111111111111111111111111111"
+	haveOid = "2222222222222222222222222222222222222222"
+)
+
+type syncBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buffer.String()
+}
+
+func pkts(payloads ...string) string {
+	var b strings.Builder
+	for _, payload := range payloads {
+		if payload == "" {
+			b.WriteString("0000")
+		} else {
+			b.Write(pktline.Encode([]byte(payload)))
+		}
+	}
+
+	return b.String()
+}
+
+func sideband(data string) string {
+	return pkts("\x01" + data)
+}
+
+type keepaliveStep struct {
+	client string
+	gitaly string
+	// expectKeepalive tells whether keepalives are expected while idle after
+	// the step
+	expectKeepalive bool
+}
+
+func TestKeepalive(t *testing.T) {
+	advertisement := pkts(wantOid+" HEAD\x00multi_ack_detailed side-band-64k", wantOid+" refs/heads/main", "")
+
+	testCases := []struct {
+		desc     string
+		protocol string
+		steps    []keepaliveStep
+	}{
+		{
+			desc: "Clone with sideband",
+			steps: []keepaliveStep{
+				{gitaly: advertisement},
+				{client: pkts("want "+wantOid+" multi_ack_detailed side-band-64k ofs-delta\n", "")},
+				{client: pkts("done\n")},
+				{gitaly: pkts("NAK\n"), expectKeepalive: true},
+				{gitaly: sideband("PACK"), expectKeepalive: true},
+				{gitaly: pkts(""), expectKeepalive: false},
+			},
+		},
+		{
+			desc: "Fetch with rounds of haves",
+			steps: []keepaliveStep{
+				{gitaly: advertisement},
+				{client: pkts("want "+wantOid+" multi_ack_detailed side-band\n", "", "have "+haveOid+"\n", "")},
+				{client: pkts("have " + haveOid + "\n")},
+				{client: pkts("", "done\n")},
+				{gitaly: pkts("NAK\n")},
+				{gitaly: pkts("NAK\n")},
+				{gitaly: pkts("NAK\n"), expectKeepalive: true},
+			},
+		},
+		{
+			desc: "Fetch with common commits",
+			steps: []keepaliveStep{
+				{gitaly: advertisement},
+				{client: pkts("want "+wantOid+" multi_ack_detailed side-band-64k\n", "", "have "+haveOid+"\n", "")},
+				{gitaly: pkts("ACK " + haveOid + " common\n")},
+				{client: pkts("done\n")},
+				{gitaly: pkts("NAK\n")},
+				{gitaly: pkts("ACK " + haveOid + "\n"), expectKeepalive: true},
+			},
+		},
+		{
+			desc: "Without sideband",
+			steps: []keepaliveStep{
+				{gitaly: advertisement},
+				{client: pkts("want "+wantOid+" multi_ack_detailed ofs-delta\n", "", "done\n")},
+				{gitaly: pkts("NAK\n")},
+				{gitaly: "PACK"},
+			},
+		},
+		{
+			desc: "With a partially written packet",
+			steps: []keepaliveStep{
+				{gitaly: advertisement},
+				{client: pkts("want "+wantOid+" side-band-64k\n", "", "done\n")},
+				{gitaly: pkts("NAK\n"), expectKeepalive: true},
+				{gitaly: sideband("PACK data")[:8]},
+				{gitaly: sideband("PACK data")[8:], expectKeepalive: true},
+			},
+		},
+		{
+			desc:     "With protocol v2",
+			protocol: "version=2",
+			steps: []keepaliveStep{
+				{gitaly: pkts("version 2\n", "fetch=shallow\n", "")},
+				{client: pkts("command=fetch\n", "want "+wantOid+"\n", "done\n", "")},
+				{gitaly: pkts("packfile\n"), expectKeepalive: true},
+				{gitaly: sideband("PACK"), expectKeepalive: true},
+				{gitaly: pkts("")},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			output := &syncBuffer{}
+			keepalive := newKeepalive(testInterval, tc.protocol, output)
+			keepalive.Start()
+			defer keepalive.Stop()
+
+			expectedOutput := ""
+			for _, step := range tc.steps {
+				if step.client != "" {
+					data, err := ioutil.ReadAll(keepalive.Reader(strings.NewReader(step.client)))
+					require.NoError(t, err)
+					require.Equal(t, step.client, string(data))
+				}
+
+				if step.gitaly != "" {
+					n, err := keepalive.Write([]byte(step.gitaly))
+					require.NoError(t, err)
+					require.Equal(t, len(step.gitaly), n)
+					expectedOutput += step.gitaly
+				}
+
+				time.Sleep(testIdle)
+
+				// Keepalives are whole packets following the step's output
+				require.True(t, strings.HasPrefix(output.String(), expectedOutput))
+				keepalives := strings.TrimPrefix(output.String(), expectedOutput)
+				require.Equal(t, strings.Repeat(string(keepalivePkt), len(keepalives)/len(keepalivePkt)), keepalives)
+
+				if step.expectKeepalive {
+					require.NotEmpty(t, keepalives)
+				} else {
+					require.Empty(t, keepalives)
+				}
+
+				expectedOutput = output.String()
+			}
+		})
+	}
+}
+
+func TestKeepaliveStop(t *testing.T) {
+	output := &syncBuffer{}
+	keepalive := newKeepalive(testInterval, "version=2", output)
+	keepalive.Start()
+
+	_, err := keepalive.Write([]byte(pkts("packfile\n")))
+	require.NoError(t, err)
+
+	keepalive.Stop()
+	keepalive.Stop()
+	time.Sleep(testIdle)
+
+	require.Equal(t, pkts("packfile\n"), output.String())
+}
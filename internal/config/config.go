@@ -1,20 +1,69 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"gitlab.com/gitlab-org/gitlab-shell/client"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/secrets"
 	yaml "gopkg.in/yaml.v2"
 )
 
 const (
 	configFile            = "config.yml"
 	logFile               = "gitlab-shell.log"
+	stateDir              = "state"
 	defaultSecretFileName = ".gitlab_shell_secret"
+	defaultSshUser        = "git"
+	defaultSshPort        = 22
+
+	defaultAnonymousRateLimitWindowSeconds = 60
+
+	defaultEnrollmentRateLimit              = 10
+	defaultEnrollmentRateLimitWindowSeconds = 60
+
+	defaultKeyLocationIPv4PrefixLength  = 24
+	defaultKeyLocationIPv6PrefixLength  = 48
+	defaultKeyLocationMaxPrefixesPerKey = 20
+	defaultKeyLocationMaxKeys           = 10000
+
+	defaultBackgroundBudgetMs      = 2000
+	defaultTransferReportTimeoutMs = 1000
+
+	defaultDenialMaxDenials           = 10
+	defaultDenialWindowSeconds        = 60
+	defaultDenialBlockDurationSeconds = 600
+
+	defaultCustomActionMaxEndpoints = 5
+
+	defaultUniformDenialMessage      = "The project you were looking for could not be found or you don't have permission to view it."
+	defaultUniformDenialMinLatencyMs = 500
+
+	defaultCertificateTtlHours    = 24
+	defaultCertificateMaxTtlHours = 24
+
+	defaultLogPseudonymSaltFile         = ".gitlab_shell_log_salt"
+	defaultLogPseudonymRotationDays     = 30
+	defaultLogPseudonymIPv4PrefixLength = 24
+	defaultLogPseudonymIPv6PrefixLength = 48
+
+	keyLineRootDirPlaceholder = "{root_dir}"
+)
+
+var (
+	// KeyLineEnvVars are the variables that may be set in the command of
+	// authorized_keys lines, gitlab-shell doesn't use others.
+	KeyLineEnvVars = []string{"GITLAB_SHELL_DIR", "SSL_CERT_DIR", "SSL_CERT_FILE"}
+
+	keyLinePlaceholderRegex = regexp.MustCompile(`\{[^}]*\}`)
 )
 
 type HttpSettingsConfig struct {
@@ -26,17 +75,207 @@ type HttpSettingsConfig struct {
 	SelfSignedCert     bool   `yaml:"self_signed_cert"`
 }
 
+type AnonymousSshConfig struct {
+	Enabled                bool   `yaml:"enabled"`
+	RateLimit              int    `yaml:"rate_limit"`
+	RateLimitWindowSeconds uint64 `yaml:"rate_limit_window"`
+}
+
+type SshdConfig struct {
+	User         string   `yaml:"user"`
+	Host         string   `yaml:"host"`
+	Port         int      `yaml:"port"`
+	HostKeyFiles []string `yaml:"host_key_files"`
+}
+
+// DenialBlockingConfig blocks SSH keys and addresses locally once GitLab
+// denied MaxDenials of their requests within the window.
+type DenialBlockingConfig struct {
+	Enabled              bool   `yaml:"enabled"`
+	MaxDenials           int    `yaml:"max_denials"`
+	WindowSeconds        uint64 `yaml:"window"`
+	BlockDurationSeconds uint64 `yaml:"block_duration"`
+}
+
+// KeyLocationAlertsConfig controls notifications about SSH keys used from
+// networks they weren't used from before. Networks are compared by prefix.
+type KeyLocationAlertsConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	IPv4PrefixLength  int  `yaml:"ipv4_prefix_length"`
+	IPv6PrefixLength  int  `yaml:"ipv6_prefix_length"`
+	MaxPrefixesPerKey int  `yaml:"max_prefixes_per_key"`
+	MaxKeys           int  `yaml:"max_keys"`
+}
+
+// LogPseudonymizationConfig replaces user identifiers in the logs with keyed
+// hashes. The key is derived from the salt and changes every rotation period.
+type LogPseudonymizationConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	SaltFile         string `yaml:"salt_file"`
+	RotationDays     int    `yaml:"rotation_days"`
+	IPv4PrefixLength int    `yaml:"ipv4_prefix_length"`
+	IPv6PrefixLength int    `yaml:"ipv6_prefix_length"`
+}
+
+// TransferReportsConfig controls the reports sent to GitLab when a git
+// command ends, so it knows how transfers went.
+type TransferReportsConfig struct {
+	Enabled   bool `yaml:"enabled"`
+	TimeoutMs int  `yaml:"timeout_ms"`
+}
+
+// SshCertificatesConfig enables `cert issue`, which signs users' public keys
+// with the certificate authority in CaKeyFile.
+type SshCertificatesConfig struct {
+	CaKeyFile   string `yaml:"ca_key_file"`
+	TtlHours    int    `yaml:"ttl_hours"`
+	MaxTtlHours int    `yaml:"max_ttl_hours"`
+}
+
+// UniformDenialsConfig hides why reads were denied, so denials don't tell
+// whether a private project exists. Every denied read gets Message and takes
+// at least MinLatencyMs.
+type UniformDenialsConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Message      string `yaml:"message"`
+	MinLatencyMs int    `yaml:"min_latency_ms"`
+}
+
+// CustomActionsConfig restricts the endpoints custom actions, e.g. proxying
+// pushes to a Geo primary, may post to. Any path is allowed when no prefixes
+// are configured.
+type CustomActionsConfig struct {
+	AllowedEndpointPrefixes []string `yaml:"allowed_endpoint_prefixes"`
+	MaxEndpoints            int      `yaml:"max_endpoints"`
+}
+
+// EnrollmentConfig lets unknown SSH keys run `enroll <code>`, which adds them
+// as deploy keys with a one-time code generated in GitLab. Attempts are rate
+// limited per address, the limit can't be disabled.
+type EnrollmentConfig struct {
+	Enabled                bool   `yaml:"enabled"`
+	RateLimit              int    `yaml:"rate_limit"`
+	RateLimitWindowSeconds uint64 `yaml:"rate_limit_window_seconds"`
+}
+
+// AgitConfig enables pushes to refs/for/<branch>[/<topic>], which create or
+// update a merge request instead of updating the branch.
+type AgitConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// UploadPackConfig tunes git-upload-pack. With KeepaliveSeconds, clients are
+// sent keepalives while the pack is being generated, so connections aren't
+// dropped for being idle. It works like git's uploadpack.keepAlive.
+type UploadPackConfig struct {
+	KeepaliveSeconds int `yaml:"keepalive_seconds"`
+}
+
+// KeyLinesConfig customizes the command of the lines written by
+// gitlab-shell-authorized-keys-check and -principals-check, for when sshd
+// sees gitlab-shell at another path than RootDir, e.g. in containers.
+// {root_dir} in CommandPath is replaced by RootDir.
+type KeyLinesConfig struct {
+	CommandPath string            `yaml:"command_path"`
+	Env         map[string]string `yaml:"env"`
+}
+
+// PluginConfig serves an extra SSH command with an external executable.
+type PluginConfig struct {
+	Name       string `yaml:"name"`
+	Executable string `yaml:"executable"`
+}
+
+// PrincipalRule rewrites SSH certificate principals matching Match. Replace
+// may refer to capture groups, e.g. $1.
+type PrincipalRule struct {
+	Match   string `yaml:"match"`
+	Replace string `yaml:"replace"`
+}
+
+type AuthorizedPrincipalsConfig struct {
+	Rules []PrincipalRule `yaml:"rules"`
+}
+
 type Config struct {
-	RootDir        string
-	LogFile        string             `yaml:"log_file"`
-	LogFormat      string             `yaml:"log_format"`
-	GitlabUrl      string             `yaml:"gitlab_url"`
-	GitlabTracing  string             `yaml:"gitlab_tracing"`
-	SecretFilePath string             `yaml:"secret_file"`
-	Secret         string             `yaml:"secret"`
-	SslCertDir     string             `yaml:"ssl_cert_dir"`
-	HttpSettings   HttpSettingsConfig `yaml:"http_settings"`
-	HttpClient     *client.HttpClient
+	RootDir              string
+	LogFile              string                     `yaml:"log_file"`
+	LogFormat            string                     `yaml:"log_format"`
+	LogPseudonymization  LogPseudonymizationConfig  `yaml:"log_pseudonymization"`
+	GitlabUrl            string                     `yaml:"gitlab_url"`
+	GitlabTracing        string                     `yaml:"gitlab_tracing"`
+	SecretFilePath       string                     `yaml:"secret_file"`
+	Secret               string                     `yaml:"secret"`
+	IdentityFile         string                     `yaml:"identity_file"`
+	SslCertDir           string                     `yaml:"ssl_cert_dir"`
+	StateDir             string                     `yaml:"state_dir"`
+	Region               string                     `yaml:"region"`
+	HttpSettings         HttpSettingsConfig         `yaml:"http_settings"`
+	AnonymousSsh         AnonymousSshConfig         `yaml:"anonymous_ssh"`
+	Sshd                 SshdConfig                 `yaml:"sshd"`
+	AuthorizedPrincipals AuthorizedPrincipalsConfig `yaml:"authorized_principals"`
+	KeyLocationAlerts    KeyLocationAlertsConfig    `yaml:"key_location_alerts"`
+	DenialBlocking       DenialBlockingConfig       `yaml:"denial_blocking"`
+	UniformDenials       UniformDenialsConfig       `yaml:"uniform_denials"`
+	SshCertificates      SshCertificatesConfig      `yaml:"ssh_certificates"`
+	CustomActions        CustomActionsConfig        `yaml:"custom_actions"`
+	Enrollment           EnrollmentConfig           `yaml:"enrollment"`
+	Agit                 AgitConfig                 `yaml:"agit"`
+	KeyLines             KeyLinesConfig             `yaml:"key_lines"`
+	UploadPack           UploadPackConfig           `yaml:"upload_pack"`
+	Plugins              []PluginConfig             `yaml:"plugins"`
+	TransferReports      TransferReportsConfig      `yaml:"transfer_reports"`
+	BackgroundBudgetMs   int                        `yaml:"background_budget_ms"`
+	HttpClient           *client.HttpClient
+}
+
+// SshHost is the host name users connect to over SSH. It defaults to the
+// host name of the machine gitlab-shell runs on.
+func (c *Config) SshHost() string {
+	if c.Sshd.Host != "" {
+		return c.Sshd.Host
+	}
+
+	host, _ := os.Hostname()
+
+	return host
+}
+
+// SshUser is the user in SSH URLs. It defaults to the user gitlab-shell runs
+// as.
+func (c *Config) SshUser() string {
+	if c.Sshd.User != "" {
+		return c.Sshd.User
+	}
+
+	if user := os.Getenv("USER"); user != "" {
+		return user
+	}
+
+	return defaultSshUser
+}
+
+// SshUrl is the URL of a project on the given SSH host. The scp-like syntax
+// is used unless a custom port is configured.
+func (c *Config) SshUrl(host, project string) string {
+	user := c.SshUser()
+	port := c.Sshd.Port
+
+	if port == 0 || port == defaultSshPort {
+		return fmt.Sprintf("%s@%s:%s.git", user, host, project)
+	}
+
+	return fmt.Sprintf("ssh://%s@%s:%d/%s.git", user, host, port, project)
+}
+
+// BackgroundBudget is how long gitlab-shell waits for background work, such
+// as notifications and reports, before exiting.
+func (c *Config) BackgroundBudget() time.Duration {
+	if c.BackgroundBudgetMs <= 0 {
+		return defaultBackgroundBudgetMs * time.Millisecond
+	}
+
+	return time.Duration(c.BackgroundBudgetMs) * time.Millisecond
 }
 
 func (c *Config) GetHttpClient() *client.HttpClient {
@@ -102,6 +341,56 @@ func parseConfig(configBytes []byte, cfg *Config) error {
 		cfg.LogFormat = "text"
 	}
 
+	if cfg.StateDir == "" {
+		cfg.StateDir = stateDir
+	}
+
+	if cfg.StateDir[0] != '/' {
+		cfg.StateDir = path.Join(cfg.RootDir, cfg.StateDir)
+	}
+
+	if cfg.AnonymousSsh.RateLimitWindowSeconds == 0 {
+		cfg.AnonymousSsh.RateLimitWindowSeconds = defaultAnonymousRateLimitWindowSeconds
+	}
+
+	if cfg.Enrollment.RateLimit <= 0 {
+		cfg.Enrollment.RateLimit = defaultEnrollmentRateLimit
+	}
+
+	if cfg.Enrollment.RateLimitWindowSeconds == 0 {
+		cfg.Enrollment.RateLimitWindowSeconds = defaultEnrollmentRateLimitWindowSeconds
+	}
+
+	parseKeyLocationAlerts(&cfg.KeyLocationAlerts)
+	parseDenialBlocking(&cfg.DenialBlocking)
+	parseLogPseudonymization(cfg.RootDir, &cfg.LogPseudonymization)
+	parseSshCertificates(cfg.RootDir, &cfg.SshCertificates)
+	parsePlugins(cfg.RootDir, cfg.Plugins)
+
+	if err := parseKeyLines(cfg.RootDir, cfg.SslCertDir, &cfg.KeyLines); err != nil {
+		return err
+	}
+
+	if cfg.CustomActions.MaxEndpoints <= 0 {
+		cfg.CustomActions.MaxEndpoints = defaultCustomActionMaxEndpoints
+	}
+
+	if cfg.UniformDenials.Message == "" {
+		cfg.UniformDenials.Message = defaultUniformDenialMessage
+	}
+
+	if cfg.UniformDenials.MinLatencyMs <= 0 {
+		cfg.UniformDenials.MinLatencyMs = defaultUniformDenialMinLatencyMs
+	}
+
+	if cfg.TransferReports.TimeoutMs <= 0 {
+		cfg.TransferReports.TimeoutMs = defaultTransferReportTimeoutMs
+	}
+
+	if cfg.BackgroundBudgetMs <= 0 {
+		cfg.BackgroundBudgetMs = defaultBackgroundBudgetMs
+	}
+
 	if cfg.GitlabUrl != "" {
 		unescapedUrl, err := url.PathUnescape(cfg.GitlabUrl)
 		if err != nil {
@@ -115,9 +404,206 @@ func parseConfig(configBytes []byte, cfg *Config) error {
 		return err
 	}
 
+	if err := decryptValues(cfg); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+func parseKeyLocationAlerts(cfg *KeyLocationAlertsConfig) {
+	if cfg.IPv4PrefixLength <= 0 || cfg.IPv4PrefixLength > 32 {
+		cfg.IPv4PrefixLength = defaultKeyLocationIPv4PrefixLength
+	}
+
+	if cfg.IPv6PrefixLength <= 0 || cfg.IPv6PrefixLength > 128 {
+		cfg.IPv6PrefixLength = defaultKeyLocationIPv6PrefixLength
+	}
+
+	if cfg.MaxPrefixesPerKey <= 0 {
+		cfg.MaxPrefixesPerKey = defaultKeyLocationMaxPrefixesPerKey
+	}
+
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = defaultKeyLocationMaxKeys
+	}
+}
+
+func parseDenialBlocking(cfg *DenialBlockingConfig) {
+	if cfg.MaxDenials <= 0 {
+		cfg.MaxDenials = defaultDenialMaxDenials
+	}
+
+	if cfg.WindowSeconds == 0 {
+		cfg.WindowSeconds = defaultDenialWindowSeconds
+	}
+
+	if cfg.BlockDurationSeconds == 0 {
+		cfg.BlockDurationSeconds = defaultDenialBlockDurationSeconds
+	}
+}
+
+func parseLogPseudonymization(rootDir string, cfg *LogPseudonymizationConfig) {
+	if cfg.SaltFile == "" {
+		cfg.SaltFile = defaultLogPseudonymSaltFile
+	}
+
+	if !filepath.IsAbs(cfg.SaltFile) {
+		cfg.SaltFile = path.Join(rootDir, cfg.SaltFile)
+	}
+
+	if cfg.RotationDays <= 0 {
+		cfg.RotationDays = defaultLogPseudonymRotationDays
+	}
+
+	if cfg.IPv4PrefixLength <= 0 || cfg.IPv4PrefixLength > 32 {
+		cfg.IPv4PrefixLength = defaultLogPseudonymIPv4PrefixLength
+	}
+
+	if cfg.IPv6PrefixLength <= 0 || cfg.IPv6PrefixLength > 128 {
+		cfg.IPv6PrefixLength = defaultLogPseudonymIPv6PrefixLength
+	}
+}
+
+func parseSshCertificates(rootDir string, cfg *SshCertificatesConfig) {
+	if cfg.CaKeyFile != "" && !filepath.IsAbs(cfg.CaKeyFile) {
+		cfg.CaKeyFile = path.Join(rootDir, cfg.CaKeyFile)
+	}
+
+	if cfg.MaxTtlHours <= 0 {
+		cfg.MaxTtlHours = defaultCertificateMaxTtlHours
+	}
+
+	if cfg.TtlHours <= 0 {
+		cfg.TtlHours = defaultCertificateTtlHours
+	}
+
+	if cfg.TtlHours > cfg.MaxTtlHours {
+		cfg.TtlHours = cfg.MaxTtlHours
+	}
+}
+
+func parsePlugins(rootDir string, plugins []PluginConfig) {
+	for i := range plugins {
+		if plugins[i].Executable != "" && !filepath.IsAbs(plugins[i].Executable) {
+			plugins[i].Executable = path.Join(rootDir, plugins[i].Executable)
+		}
+	}
+}
+
+// parseKeyLines expands the command path and validates it along with the
+// environment. The values are quoted when written, but control characters
+// can't be represented in authorized_keys.
+func parseKeyLines(rootDir, sslCertDir string, cfg *KeyLinesConfig) error {
+	if cfg.CommandPath != "" {
+		commandPath := strings.Replace(cfg.CommandPath, keyLineRootDirPlaceholder, rootDir, -1)
+
+		if placeholder := keyLinePlaceholderRegex.FindString(commandPath); placeholder != "" {
+			return fmt.Errorf("key_lines: unknown placeholder %s in command_path", placeholder)
+		}
+
+		if !filepath.IsAbs(commandPath) {
+			return errors.New("key_lines: command_path must be absolute")
+		}
+
+		if hasControlCharacters(commandPath) {
+			return errors.New("key_lines: command_path must not contain control characters")
+		}
+
+		cfg.CommandPath = commandPath
+	}
+
+	for name, value := range cfg.Env {
+		if !isKeyLineEnvVar(name) {
+			return fmt.Errorf("key_lines: %s can't be set, allowed variables are %s", name, strings.Join(KeyLineEnvVars, ", "))
+		}
+
+		if hasControlCharacters(value) {
+			return fmt.Errorf("key_lines: the value of %s must not contain control characters", name)
+		}
+	}
+
+	if _, ok := cfg.Env["SSL_CERT_DIR"]; ok && sslCertDir != "" {
+		return errors.New("key_lines: SSL_CERT_DIR can't be set along with ssl_cert_dir")
+	}
+
+	return nil
+}
+
+func isKeyLineEnvVar(name string) bool {
+	for _, allowed := range KeyLineEnvVars {
+		if name == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasControlCharacters(value string) bool {
+	for _, r := range value {
+		if r < 0x20 || r == 0x7f {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decryptValues replaces the encrypted values with their plaintext. The
+// identity is only needed when there are encrypted values.
+func decryptValues(cfg *Config) error {
+	values := []struct {
+		name  string
+		value *string
+	}{
+		{name: "secret", value: &cfg.Secret},
+		{name: "http_settings.password", value: &cfg.HttpSettings.Password},
+	}
+
+	var identity *secrets.Identity
+	for _, v := range values {
+		if !secrets.IsEncrypted(*v.value) {
+			continue
+		}
+
+		if identity == nil {
+			var err error
+			if identity, err = cfg.LoadIdentity(); err != nil {
+				return err
+			}
+		}
+
+		plaintext, err := identity.Decrypt(*v.value)
+		if err != nil {
+			return fmt.Errorf("Unable to decrypt %s: %v", v.name, err)
+		}
+
+		*v.value = string(plaintext)
+	}
+
+	return nil
+}
+
+// LoadIdentity returns the identity values in the config are encrypted to
+func (c *Config) LoadIdentity() (*secrets.Identity, error) {
+	if c.IdentityFile == "" {
+		return nil, errors.New("identity_file must be set for encrypted values")
+	}
+
+	filename := c.IdentityFile
+	if !filepath.IsAbs(filename) {
+		filename = path.Join(c.RootDir, filename)
+	}
+
+	identity, err := secrets.LoadIdentity(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load the identity: %v", err)
+	}
+
+	return identity, nil
+}
+
 func parseSecret(cfg *Config) error {
 	// The secret was parsed from yaml no need to read another file
 	if cfg.Secret != "" {
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -119,3 +123,467 @@ func TestParseConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestParseStateDir(t *testing.T) {
+	testCases := []struct {
+		yaml     string
+		stateDir string
+	}{
+		{
+			stateDir: path.Join(testRoot, "state"),
+		},
+		{
+			yaml:     "state_dir: my-state",
+			stateDir: path.Join(testRoot, "my-state"),
+		},
+		{
+			yaml:     "state_dir: /var/opt/gitlab-shell",
+			stateDir: "/var/opt/gitlab-shell",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.stateDir, cfg.StateDir)
+		})
+	}
+}
+
+func TestParseAnonymousSsh(t *testing.T) {
+	testCases := []struct {
+		yaml         string
+		anonymousSsh AnonymousSshConfig
+	}{
+		{
+			anonymousSsh: AnonymousSshConfig{RateLimitWindowSeconds: 60},
+		},
+		{
+			yaml:         "anonymous_ssh:\n  enabled: true\n  rate_limit: 30\n  rate_limit_window: 120",
+			anonymousSsh: AnonymousSshConfig{Enabled: true, RateLimit: 30, RateLimitWindowSeconds: 120},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.anonymousSsh, cfg.AnonymousSsh)
+		})
+	}
+}
+
+func TestParseEnrollment(t *testing.T) {
+	testCases := []struct {
+		yaml       string
+		enrollment EnrollmentConfig
+	}{
+		{
+			enrollment: EnrollmentConfig{RateLimit: 10, RateLimitWindowSeconds: 60},
+		},
+		{
+			yaml:       "enrollment:\n  enabled: true",
+			enrollment: EnrollmentConfig{Enabled: true, RateLimit: 10, RateLimitWindowSeconds: 60},
+		},
+		{
+			yaml:       "enrollment:\n  enabled: true\n  rate_limit: 0",
+			enrollment: EnrollmentConfig{Enabled: true, RateLimit: 10, RateLimitWindowSeconds: 60},
+		},
+		{
+			yaml:       "enrollment:\n  enabled: true\n  rate_limit: 3\n  rate_limit_window_seconds: 600",
+			enrollment: EnrollmentConfig{Enabled: true, RateLimit: 3, RateLimitWindowSeconds: 600},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.enrollment, cfg.Enrollment)
+		})
+	}
+}
+
+func TestParseAuthorizedPrincipals(t *testing.T) {
+	yaml := "authorized_principals:\n  rules:\n    - match: '\\A(.+)@corp\\.example\\z'\n      replace: '$1'\n    - match: '\\Aeng:'\n"
+	cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+	err := parseConfig([]byte(yaml), &cfg)
+	require.NoError(t, err)
+
+	expected := []PrincipalRule{
+		{Match: `\A(.+)@corp\.example\z`, Replace: "$1"},
+		{Match: `\Aeng:`},
+	}
+	assert.Equal(t, expected, cfg.AuthorizedPrincipals.Rules)
+}
+
+func TestSshUser(t *testing.T) {
+	restoreEnv := testhelper.TempEnv(map[string]string{"USER": "gitlab"})
+	defer restoreEnv()
+
+	require.Equal(t, "git", (&Config{Sshd: SshdConfig{User: "git"}}).SshUser())
+	require.Equal(t, "gitlab", (&Config{}).SshUser())
+}
+
+func TestParseKeyLocationAlerts(t *testing.T) {
+	testCases := []struct {
+		yaml              string
+		keyLocationAlerts KeyLocationAlertsConfig
+	}{
+		{
+			keyLocationAlerts: KeyLocationAlertsConfig{IPv4PrefixLength: 24, IPv6PrefixLength: 48, MaxPrefixesPerKey: 20, MaxKeys: 10000},
+		},
+		{
+			yaml:              "key_location_alerts:\n  enabled: true\n  ipv4_prefix_length: 16\n  ipv6_prefix_length: 64\n  max_prefixes_per_key: 5\n  max_keys: 100",
+			keyLocationAlerts: KeyLocationAlertsConfig{Enabled: true, IPv4PrefixLength: 16, IPv6PrefixLength: 64, MaxPrefixesPerKey: 5, MaxKeys: 100},
+		},
+		{
+			yaml:              "key_location_alerts:\n  ipv4_prefix_length: 33\n  ipv6_prefix_length: 129",
+			keyLocationAlerts: KeyLocationAlertsConfig{IPv4PrefixLength: 24, IPv6PrefixLength: 48, MaxPrefixesPerKey: 20, MaxKeys: 10000},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.keyLocationAlerts, cfg.KeyLocationAlerts)
+		})
+	}
+}
+
+func TestSshUrl(t *testing.T) {
+	cfg := &Config{Sshd: SshdConfig{User: "git"}}
+	require.Equal(t, "git@gitlab.example.com:group/project.git", cfg.SshUrl("gitlab.example.com", "group/project"))
+
+	cfg.Sshd.Port = 2222
+	require.Equal(t, "ssh://git@gitlab.example.com:2222/group/project.git", cfg.SshUrl("gitlab.example.com", "group/project"))
+}
+
+func TestParseLogPseudonymization(t *testing.T) {
+	testCases := []struct {
+		yaml                string
+		logPseudonymization LogPseudonymizationConfig
+	}{
+		{
+			logPseudonymization: LogPseudonymizationConfig{SaltFile: path.Join(testRoot, ".gitlab_shell_log_salt"), RotationDays: 30, IPv4PrefixLength: 24, IPv6PrefixLength: 48},
+		},
+		{
+			yaml:                "log_pseudonymization:\n  enabled: true\n  salt_file: /etc/gitlab-shell/log_salt\n  rotation_days: 7\n  ipv4_prefix_length: 16\n  ipv6_prefix_length: 32",
+			logPseudonymization: LogPseudonymizationConfig{Enabled: true, SaltFile: "/etc/gitlab-shell/log_salt", RotationDays: 7, IPv4PrefixLength: 16, IPv6PrefixLength: 32},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.logPseudonymization, cfg.LogPseudonymization)
+		})
+	}
+}
+
+func TestParsePlugins(t *testing.T) {
+	yaml := "plugins:\n  - name: deploy\n    executable: /opt/plugins/deploy\n  - name: ticket\n    executable: plugins/ticket\n"
+	cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+	err := parseConfig([]byte(yaml), &cfg)
+	require.NoError(t, err)
+
+	expected := []PluginConfig{
+		{Name: "deploy", Executable: "/opt/plugins/deploy"},
+		{Name: "ticket", Executable: path.Join(testRoot, "plugins/ticket")},
+	}
+	assert.Equal(t, expected, cfg.Plugins)
+}
+
+func TestParseTransferReports(t *testing.T) {
+	testCases := []struct {
+		yaml               string
+		transferReports    TransferReportsConfig
+		backgroundBudgetMs int
+	}{
+		{
+			transferReports:    TransferReportsConfig{TimeoutMs: 1000},
+			backgroundBudgetMs: 2000,
+		},
+		{
+			yaml:               "transfer_reports:\n  enabled: true\n  timeout_ms: 500\nbackground_budget_ms: 800",
+			transferReports:    TransferReportsConfig{Enabled: true, TimeoutMs: 500},
+			backgroundBudgetMs: 800,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.transferReports, cfg.TransferReports)
+			assert.Equal(t, time.Duration(tc.backgroundBudgetMs)*time.Millisecond, cfg.BackgroundBudget())
+		})
+	}
+}
+
+func TestParseSshCertificates(t *testing.T) {
+	testCases := []struct {
+		yaml            string
+		sshCertificates SshCertificatesConfig
+	}{
+		{
+			sshCertificates: SshCertificatesConfig{TtlHours: 24, MaxTtlHours: 24},
+		},
+		{
+			yaml:            "ssh_certificates:\n  ca_key_file: ssh_ca_key\n  ttl_hours: 8\n  max_ttl_hours: 12",
+			sshCertificates: SshCertificatesConfig{CaKeyFile: path.Join(testRoot, "ssh_ca_key"), TtlHours: 8, MaxTtlHours: 12},
+		},
+		{
+			yaml:            "ssh_certificates:\n  ca_key_file: /etc/gitlab-shell/ssh_ca_key\n  ttl_hours: 48",
+			sshCertificates: SshCertificatesConfig{CaKeyFile: "/etc/gitlab-shell/ssh_ca_key", TtlHours: 24, MaxTtlHours: 24},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.sshCertificates, cfg.SshCertificates)
+		})
+	}
+}
+
+func TestParseDenialBlocking(t *testing.T) {
+	testCases := []struct {
+		yaml           string
+		denialBlocking DenialBlockingConfig
+	}{
+		{
+			denialBlocking: DenialBlockingConfig{MaxDenials: 10, WindowSeconds: 60, BlockDurationSeconds: 600},
+		},
+		{
+			yaml:           "denial_blocking:\n  enabled: true\n  max_denials: 5\n  window: 30\n  block_duration: 3600",
+			denialBlocking: DenialBlockingConfig{Enabled: true, MaxDenials: 5, WindowSeconds: 30, BlockDurationSeconds: 3600},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.denialBlocking, cfg.DenialBlocking)
+		})
+	}
+}
+
+func TestParseCustomActions(t *testing.T) {
+	testCases := []struct {
+		yaml          string
+		customActions CustomActionsConfig
+	}{
+		{
+			customActions: CustomActionsConfig{MaxEndpoints: 5},
+		},
+		{
+			yaml:          "custom_actions:\n  allowed_endpoint_prefixes:\n    - /api/v4/geo/\n  max_endpoints: 2",
+			customActions: CustomActionsConfig{AllowedEndpointPrefixes: []string{"/api/v4/geo/"}, MaxEndpoints: 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.customActions, cfg.CustomActions)
+		})
+	}
+}
+
+func TestParseUniformDenials(t *testing.T) {
+	testCases := []struct {
+		yaml           string
+		uniformDenials UniformDenialsConfig
+	}{
+		{
+			uniformDenials: UniformDenialsConfig{Message: defaultUniformDenialMessage, MinLatencyMs: 500},
+		},
+		{
+			yaml:           "uniform_denials:\n  enabled: true\n  message: Not found\n  min_latency_ms: 800",
+			uniformDenials: UniformDenialsConfig{Enabled: true, Message: "Not found", MinLatencyMs: 800},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.uniformDenials, cfg.UniformDenials)
+		})
+	}
+}
+
+func TestParseKeyLines(t *testing.T) {
+	testCases := []struct {
+		yaml          string
+		keyLines      KeyLinesConfig
+		expectedError string
+	}{
+		{},
+		{
+			yaml: "key_lines:\n  command_path: \"{root_dir}/../shell/bin/gitlab-shell\"\n  env:\n    GITLAB_SHELL_DIR: /opt/gitlab shell",
+			keyLines: KeyLinesConfig{
+				CommandPath: testRoot + "/../shell/bin/gitlab-shell",
+				Env:         map[string]string{"GITLAB_SHELL_DIR": "/opt/gitlab shell"},
+			},
+		},
+		{
+			yaml:          "key_lines:\n  command_path: \"{bin_dir}/gitlab-shell\"",
+			expectedError: "key_lines: unknown placeholder {bin_dir} in command_path",
+		},
+		{
+			yaml:          "key_lines:\n  command_path: bin/gitlab-shell",
+			expectedError: "key_lines: command_path must be absolute",
+		},
+		{
+			yaml:          "key_lines:\n  command_path: \"/bin/gitlab-shell\\n\"",
+			expectedError: "key_lines: command_path must not contain control characters",
+		},
+		{
+			yaml:          "key_lines:\n  env:\n    LD_PRELOAD: /tmp/evil.so",
+			expectedError: "key_lines: LD_PRELOAD can't be set, allowed variables are GITLAB_SHELL_DIR, SSL_CERT_DIR, SSL_CERT_FILE",
+		},
+		{
+			yaml:          "key_lines:\n  env:\n    SSL_CERT_FILE: \"/etc/ssl\\rcert.pem\"",
+			expectedError: "key_lines: the value of SSL_CERT_FILE must not contain control characters",
+		},
+		{
+			yaml:          "ssl_cert_dir: /etc/ssl\nkey_lines:\n  env:\n    SSL_CERT_DIR: /etc/ssl",
+			expectedError: "key_lines: SSL_CERT_DIR can't be set along with ssl_cert_dir",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.keyLines, cfg.KeyLines)
+		})
+	}
+}
+
+func TestParseEncryptedValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	identityFile := path.Join(dir, "identity")
+	require.NoError(t, ioutil.WriteFile(identityFile, []byte(base64.StdEncoding.EncodeToString(make([]byte, 32))), 0600))
+
+	otherKey := make([]byte, 32)
+	otherKey[5] = 1
+	otherIdentityFile := path.Join(dir, "other")
+	require.NoError(t, ioutil.WriteFile(otherIdentityFile, []byte(base64.StdEncoding.EncodeToString(otherKey)), 0600))
+
+	identity, err := (&Config{IdentityFile: identityFile}).LoadIdentity()
+	require.NoError(t, err)
+
+	encryptedSecret, err := identity.Encrypt([]byte("plain-secret"))
+	require.NoError(t, err)
+	encryptedPassword, err := identity.Encrypt([]byte("plain-password"))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc             string
+		yaml             string
+		expectedSecret   string
+		expectedPassword string
+		expectedError    string
+	}{
+		{
+			desc:             "With encrypted values",
+			yaml:             fmt.Sprintf("identity_file: %s\nsecret: %s\nhttp_settings:\n  password: %s", identityFile, encryptedSecret, encryptedPassword),
+			expectedSecret:   "plain-secret",
+			expectedPassword: "plain-password",
+		},
+		{
+			desc:             "With plaintext values",
+			yaml:             "secret: plain-secret\nhttp_settings:\n  password: plain-password",
+			expectedSecret:   "plain-secret",
+			expectedPassword: "plain-password",
+		},
+		{
+			desc:          "Without an identity",
+			yaml:          fmt.Sprintf("secret: %s", encryptedSecret),
+			expectedError: "identity_file must be set for encrypted values",
+		},
+		{
+			desc:          "With another identity",
+			yaml:          fmt.Sprintf("identity_file: %s\nsecret: plain-secret\nhttp_settings:\n  password: %s", otherIdentityFile, encryptedPassword),
+			expectedError: "Unable to decrypt http_settings.password: the encrypted value can't be decrypted with the identity",
+		},
+		{
+			desc:          "With a malformed value",
+			yaml:          fmt.Sprintf("identity_file: %s\nsecret: %s", identityFile, encryptedSecret[:40]),
+			expectedError: "Unable to decrypt secret: the encrypted value is malformed",
+		},
+		{
+			desc:          "With a missing identity file",
+			yaml:          fmt.Sprintf("identity_file: missing\nsecret: %s", encryptedSecret),
+			expectedError: fmt.Sprintf("Unable to load the identity: lstat %s: no such file or directory", path.Join(testRoot, "missing")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cfg := Config{RootDir: testRoot}
+
+			err := parseConfig([]byte(tc.yaml), &cfg)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				require.NotContains(t, err.Error(), "enc:")
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedSecret, cfg.Secret)
+			require.Equal(t, tc.expectedPassword, cfg.HttpSettings.Password)
+		})
+	}
+}
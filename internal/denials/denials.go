@@ -0,0 +1,174 @@
+package denials
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/statefile"
+)
+
+const (
+	stateFile = "denials.json"
+)
+
+var (
+	// now is overridden in tests
+	now = time.Now
+)
+
+// Tracker counts denied requests per identity, e.g. key-1 or ip-192.0.2.1,
+// and blocks identities denied too often within the window. The counters are
+// shared by all gitlab-shell processes through a state file.
+type Tracker struct {
+	Dir    string
+	Config config.DenialBlockingConfig
+}
+
+type Block struct {
+	Identity string    `json:"identity"`
+	Until    time.Time `json:"until"`
+}
+
+type entry struct {
+	Denials      []time.Time `json:"denials,omitempty"`
+	BlockedUntil time.Time   `json:"blocked_until,omitempty"`
+}
+
+// Blocked returns the first of identities that is currently blocked, or nil.
+func (t *Tracker) Blocked(identities ...string) (*Block, error) {
+	entries := map[string]*entry{}
+	if err := statefile.Read(t.filename(), &entries); err != nil {
+		return nil, err
+	}
+
+	current := now()
+	for _, identity := range identities {
+		if e, ok := entries[identity]; ok && e.BlockedUntil.After(current) {
+			return &Block{Identity: identity, Until: e.BlockedUntil}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// RecordDenial counts a denied request for each of identities. It returns the
+// identities that got blocked by it, and the ones whose block expired since
+// the last update.
+func (t *Tracker) RecordDenial(identities ...string) ([]*Block, []string, error) {
+	var blocked []*Block
+	var expired []string
+
+	entries := map[string]*entry{}
+	err := statefile.Update(t.filename(), &entries, func() error {
+		current := now()
+		expired = t.prune(entries, current)
+
+		for _, identity := range identities {
+			e, ok := entries[identity]
+			if !ok {
+				e = &entry{}
+				entries[identity] = e
+			}
+
+			if e.BlockedUntil.After(current) {
+				continue
+			}
+
+			e.Denials = append(e.Denials, current)
+			if len(e.Denials) >= t.Config.MaxDenials {
+				e.Denials = nil
+				e.BlockedUntil = current.Add(time.Duration(t.Config.BlockDurationSeconds) * time.Second)
+				blocked = append(blocked, &Block{Identity: identity, Until: e.BlockedUntil})
+			}
+		}
+
+		return nil
+	})
+
+	return blocked, expired, err
+}
+
+// List returns the active blocks ordered by identity.
+func (t *Tracker) List() ([]*Block, error) {
+	entries := map[string]*entry{}
+	if err := statefile.Read(t.filename(), &entries); err != nil {
+		return nil, err
+	}
+
+	current := now()
+	blocks := []*Block{}
+	for identity, e := range entries {
+		if e.BlockedUntil.After(current) {
+			blocks = append(blocks, &Block{Identity: identity, Until: e.BlockedUntil})
+		}
+	}
+
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Identity < blocks[j].Identity })
+
+	return blocks, nil
+}
+
+// Clear lifts the block of identity, or all blocks when identity is empty,
+// and forgets the denials counted so far. It returns the lifted blocks.
+func (t *Tracker) Clear(identity string) ([]*Block, error) {
+	var cleared []*Block
+
+	entries := map[string]*entry{}
+	err := statefile.Update(t.filename(), &entries, func() error {
+		current := now()
+
+		for id, e := range entries {
+			if identity != "" && id != identity {
+				continue
+			}
+
+			if e.BlockedUntil.After(current) {
+				cleared = append(cleared, &Block{Identity: id, Until: e.BlockedUntil})
+			}
+
+			delete(entries, id)
+		}
+
+		return nil
+	})
+
+	sort.Slice(cleared, func(i, j int) bool { return cleared[i].Identity < cleared[j].Identity })
+
+	return cleared, err
+}
+
+// prune forgets denials outside the window and expired blocks, returning the
+// identities whose block expired.
+func (t *Tracker) prune(entries map[string]*entry, current time.Time) []string {
+	var expired []string
+	window := time.Duration(t.Config.WindowSeconds) * time.Second
+
+	for identity, e := range entries {
+		var recent []time.Time
+		for _, denial := range e.Denials {
+			if current.Sub(denial) < window {
+				recent = append(recent, denial)
+			}
+		}
+		e.Denials = recent
+
+		if !e.BlockedUntil.IsZero() && !e.BlockedUntil.After(current) {
+			expired = append(expired, identity)
+			e.BlockedUntil = time.Time{}
+		}
+
+		if len(e.Denials) == 0 && e.BlockedUntil.IsZero() {
+			delete(entries, identity)
+		}
+	}
+
+	sort.Strings(expired)
+
+	return expired
+}
+
+func (t *Tracker) filename() string {
+	return filepath.Join(t.Dir, stateFile)
+}
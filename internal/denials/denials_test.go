@@ -0,0 +1,99 @@
+package denials
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+func TestRecordDenial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-denials")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	current := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	tracker := &Tracker{Dir: dir, Config: config.DenialBlockingConfig{MaxDenials: 3, WindowSeconds: 60, BlockDurationSeconds: 600}}
+
+	for i := 0; i < 2; i++ {
+		blocked, _, err := tracker.RecordDenial("key-1", "ip-192.0.2.1")
+		require.NoError(t, err)
+		require.Empty(t, blocked)
+	}
+
+	current = current.Add(time.Minute)
+
+	blocked, _, err := tracker.RecordDenial("key-1", "ip-192.0.2.1")
+	require.NoError(t, err)
+	require.Empty(t, blocked, "denials outside the window aren't counted")
+
+	blocked, _, err = tracker.RecordDenial("key-1", "ip-192.0.2.2")
+	require.NoError(t, err)
+	require.Empty(t, blocked)
+
+	blocked, _, err = tracker.RecordDenial("key-1", "ip-192.0.2.1")
+	require.NoError(t, err)
+	require.Equal(t, []*Block{{Identity: "key-1", Until: current.Add(10 * time.Minute)}}, blocked)
+
+	block, err := tracker.Blocked("key-2", "ip-192.0.2.1")
+	require.NoError(t, err)
+	require.Nil(t, block)
+
+	block, err = tracker.Blocked("key-1", "ip-192.0.2.1")
+	require.NoError(t, err)
+	require.Equal(t, &Block{Identity: "key-1", Until: current.Add(10 * time.Minute)}, block)
+
+	current = current.Add(10 * time.Minute)
+
+	block, err = tracker.Blocked("key-1")
+	require.NoError(t, err)
+	require.Nil(t, block, "blocks expire")
+
+	_, expired, err := tracker.RecordDenial("key-2")
+	require.NoError(t, err)
+	require.Equal(t, []string{"key-1"}, expired)
+}
+
+func TestListAndClear(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-denials")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	current := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	tracker := &Tracker{Dir: dir, Config: config.DenialBlockingConfig{MaxDenials: 1, WindowSeconds: 60, BlockDurationSeconds: 600}}
+
+	blocks, err := tracker.List()
+	require.NoError(t, err)
+	require.Empty(t, blocks)
+
+	_, _, err = tracker.RecordDenial("key-2", "key-1", "ip-192.0.2.1")
+	require.NoError(t, err)
+
+	until := current.Add(10 * time.Minute)
+
+	blocks, err = tracker.List()
+	require.NoError(t, err)
+	require.Equal(t, []*Block{{"ip-192.0.2.1", until}, {"key-1", until}, {"key-2", until}}, blocks)
+
+	cleared, err := tracker.Clear("key-1")
+	require.NoError(t, err)
+	require.Equal(t, []*Block{{"key-1", until}}, cleared)
+
+	cleared, err = tracker.Clear("")
+	require.NoError(t, err)
+	require.Equal(t, []*Block{{"ip-192.0.2.1", until}, {"key-2", until}}, cleared)
+
+	blocks, err = tracker.List()
+	require.NoError(t, err)
+	require.Empty(t, blocks)
+}
@@ -11,6 +11,7 @@ const (
 	GitlabShell               = "gitlab-shell"
 	AuthorizedKeysCheck       = "gitlab-shell-authorized-keys-check"
 	AuthorizedPrincipalsCheck = "gitlab-shell-authorized-principals-check"
+	LogPseudonyms             = "gitlab-shell-log-pseudonyms"
 )
 
 type Executable struct {
@@ -0,0 +1,143 @@
+package accessgrant
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet"
+)
+
+const (
+	accessGrantsPath = "/access_grants"
+	revokePath       = "/access_grants/revoke"
+)
+
+type Client struct {
+	config *config.Config
+	client *client.GitlabNetClient
+}
+
+// Request identifies the user asking for the change with the same key_id or
+// username the other internal API calls use. Rails only accepts the request
+// when that user is a maintainer of the project.
+type Request struct {
+	KeyId     string `json:"key_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Project   string `json:"project"`
+	Grantee   string `json:"grantee,omitempty"`
+	Role      string `json:"role,omitempty"`
+	ExpiresIn int64  `json:"expires_in,omitempty"`
+}
+
+type Grant struct {
+	Username  string    `json:"username"`
+	Project   string    `json:"project"`
+	Role      string    `json:"role"`
+	GrantedBy string    `json:"granted_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type Response struct {
+	Success bool    `json:"success"`
+	Message string  `json:"message"`
+	Grant   Grant   `json:"grant"`
+	Grants  []Grant `json:"grants"`
+}
+
+func NewClient(config *config.Config) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{config: config, client: client}, nil
+}
+
+func (c *Client) Create(args *commandargs.Shell, grantee, project, role string, ttl time.Duration) (*Grant, error) {
+	request := newRequest(args, project)
+	request.Grantee = grantee
+	request.Role = role
+	request.ExpiresIn = int64(ttl / time.Second)
+
+	response, err := c.post(accessGrantsPath, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response.Grant, nil
+}
+
+func (c *Client) Revoke(args *commandargs.Shell, grantee, project string) (*Grant, error) {
+	request := newRequest(args, project)
+	request.Grantee = grantee
+
+	response, err := c.post(revokePath, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response.Grant, nil
+}
+
+func (c *Client) List(args *commandargs.Shell, project string) ([]Grant, error) {
+	params := url.Values{}
+	params.Add("project", project)
+	if args.GitlabUsername != "" {
+		params.Add("username", args.GitlabUsername)
+	} else {
+		params.Add("key_id", args.GitlabKeyId)
+	}
+
+	response, err := c.client.Get(accessGrantsPath + "?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	parsedResponse, err := parse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsedResponse.Grants, nil
+}
+
+func (c *Client) post(path string, request *Request) (*Response, error) {
+	response, err := c.client.Post(path, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return parse(response)
+}
+
+func newRequest(args *commandargs.Shell, project string) *Request {
+	request := &Request{Project: project}
+	if args.GitlabUsername != "" {
+		request.Username = args.GitlabUsername
+	} else {
+		request.KeyId = args.GitlabKeyId
+	}
+
+	return request
+}
+
+func parse(hr *http.Response) (*Response, error) {
+	response := &Response{}
+	if err := gitlabnet.ParseJSON(hr, response); err != nil {
+		return nil, err
+	}
+
+	if !response.Success {
+		return nil, errors.New(response.Message)
+	}
+
+	return response, nil
+}
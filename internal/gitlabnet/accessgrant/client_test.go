@@ -0,0 +1,153 @@
+package accessgrant
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+var (
+	project   = "group/project"
+	expiresAt = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func setup(t *testing.T) (*Client, func()) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/access_grants",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					require.Equal(t, project, r.URL.Query().Get("project"))
+					require.Equal(t, "1", r.URL.Query().Get("key_id"))
+
+					body := map[string]interface{}{
+						"success": true,
+						"grants": []map[string]interface{}{
+							{"username": "jane", "project": project, "role": "developer", "granted_by": "john", "expires_at": expiresAt},
+						},
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+					return
+				}
+
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				var request *Request
+				require.NoError(t, json.Unmarshal(b, &request))
+
+				switch request.KeyId {
+				case "1":
+					require.Equal(t, "jane", request.Grantee)
+					require.Equal(t, "developer", request.Role)
+					require.Equal(t, int64(7200), request.ExpiresIn)
+
+					body := map[string]interface{}{
+						"success": true,
+						"grant":   map[string]interface{}{"username": "jane", "project": project, "role": "developer", "expires_at": expiresAt},
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+				case "2":
+					body := map[string]interface{}{
+						"success": false,
+						"message": "Only maintainers of the project can grant access",
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			},
+		},
+		{
+			Path: "/api/v4/internal/access_grants/revoke",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				var request *Request
+				require.NoError(t, json.Unmarshal(b, &request))
+				require.Equal(t, "maintainer", request.Username)
+				require.Empty(t, request.KeyId)
+
+				body := map[string]interface{}{
+					"success": true,
+					"grant":   map[string]interface{}{"username": request.Grantee, "project": request.Project, "role": "developer"},
+				}
+				require.NoError(t, json.NewEncoder(w).Encode(body))
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+
+	client, err := NewClient(&config.Config{GitlabUrl: url})
+	require.NoError(t, err)
+
+	return client, cleanup
+}
+
+func TestCreate(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	grant, err := client.Create(&commandargs.Shell{GitlabKeyId: "1"}, "jane", project, "developer", 2*time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, &Grant{Username: "jane", Project: project, Role: "developer", ExpiresAt: expiresAt}, grant)
+}
+
+func TestRevoke(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	grant, err := client.Revoke(&commandargs.Shell{GitlabUsername: "maintainer"}, "jane", project)
+	require.NoError(t, err)
+	require.Equal(t, &Grant{Username: "jane", Project: project, Role: "developer"}, grant)
+}
+
+func TestList(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	grants, err := client.List(&commandargs.Shell{GitlabKeyId: "1"}, project)
+	require.NoError(t, err)
+	require.Equal(t, []Grant{{Username: "jane", Project: project, Role: "developer", GrantedBy: "john", ExpiresAt: expiresAt}}, grants)
+}
+
+func TestErrorResponses(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		keyId         string
+		expectedError string
+	}{
+		{
+			desc:          "A response with an error message",
+			keyId:         "2",
+			expectedError: "Only maintainers of the project can grant access",
+		},
+		{
+			desc:          "An error response without message",
+			keyId:         "3",
+			expectedError: "Internal API error (500)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			grant, err := client.Create(&commandargs.Shell{GitlabKeyId: tc.keyId}, "jane", project, "developer", time.Hour)
+
+			require.EqualError(t, err, tc.expectedError)
+			require.Nil(t, grant)
+		})
+	}
+}
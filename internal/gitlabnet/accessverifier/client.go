@@ -9,6 +9,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/projectid"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/sshenv"
 )
 
@@ -18,6 +19,7 @@ const (
 )
 
 type Client struct {
+	config *config.Config
 	client *client.GitlabNetClient
 }
 
@@ -29,6 +31,12 @@ type Request struct {
 	KeyId    string                  `json:"key_id,omitempty"`
 	Username string                  `json:"username,omitempty"`
 	CheckIp  string                  `json:"check_ip,omitempty"`
+	AgitFlow bool                    `json:"agit_flow,omitempty"`
+
+	// ProjectId is set for project-id/<id> paths, GitLab looks the project
+	// up by it instead of the path
+	ProjectId string `json:"project_id,omitempty"`
+	Wiki      bool   `json:"wiki,omitempty"`
 }
 
 type Gitaly struct {
@@ -63,6 +71,9 @@ type Response struct {
 	GitProtocol      string        `json:"git_protocol"`
 	Payload          CustomPayload `json:"payload"`
 	ConsoleMessages  []string      `json:"gl_console_messages"`
+	ProjectRegion    string        `json:"gl_project_region"`
+	RegionSshHost    string        `json:"gl_region_ssh_host"`
+	AgitRefPrefix    string        `json:"gl_agit_ref_prefix"`
 	Who              string
 	StatusCode       int
 }
@@ -73,12 +84,17 @@ func NewClient(config *config.Config) (*Client, error) {
 		return nil, fmt.Errorf("Error creating http client: %v", err)
 	}
 
-	return &Client{client: client}, nil
+	return &Client{config: config, client: client}, nil
 }
 
 func (c *Client) Verify(args *commandargs.Shell, action commandargs.CommandType, repo string) (*Response, error) {
 	request := &Request{Action: action, Repo: repo, Protocol: protocol, Changes: anyChanges}
 
+	if ref := projectid.Parse(repo); ref != nil {
+		request.ProjectId = ref.Id
+		request.Wiki = ref.Wiki
+	}
+
 	if args.GitlabUsername != "" {
 		request.Username = args.GitlabUsername
 	} else {
@@ -87,6 +103,10 @@ func (c *Client) Verify(args *commandargs.Shell, action commandargs.CommandType,
 
 	request.CheckIp = sshenv.LocalAddr()
 
+	// Pushes may target refs/for/<branch>, which users without push access
+	// to the branch can use to propose changes
+	request.AgitFlow = action == commandargs.ReceivePack && c.config.Agit.Enabled
+
 	response, err := c.client.Post("/allowed", request)
 	if err != nil {
 		return nil, err
@@ -233,3 +233,105 @@ func setup(t *testing.T, allowedPayload string) (*Client, func()) {
 
 	return client, cleanup
 }
+
+func TestAgitFlow(t *testing.T) {
+	var agitFlow bool
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/allowed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var request *Request
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+				agitFlow = request.AgitFlow
+
+				body := map[string]interface{}{"status": true, "gl_agit_ref_prefix": "refs/agit/1/"}
+				require.NoError(t, json.NewEncoder(w).Encode(body))
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	testCases := []struct {
+		desc             string
+		enabled          bool
+		action           commandargs.CommandType
+		expectedAgitFlow bool
+	}{
+		{
+			desc:             "Push with review pushes enabled",
+			enabled:          true,
+			action:           receivePackAction,
+			expectedAgitFlow: true,
+		},
+		{
+			desc:             "Fetch with review pushes enabled",
+			enabled:          true,
+			action:           uploadPackAction,
+			expectedAgitFlow: false,
+		},
+		{
+			desc:             "Push with review pushes disabled",
+			enabled:          false,
+			action:           receivePackAction,
+			expectedAgitFlow: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			client, err := NewClient(&config.Config{GitlabUrl: url, Agit: config.AgitConfig{Enabled: tc.enabled}})
+			require.NoError(t, err)
+
+			response, err := client.Verify(&commandargs.Shell{GitlabKeyId: "1"}, tc.action, repo)
+			require.NoError(t, err)
+			require.Equal(t, "refs/agit/1/", response.AgitRefPrefix)
+			require.Equal(t, tc.expectedAgitFlow, agitFlow)
+		})
+	}
+}
+
+func TestProjectIdPaths(t *testing.T) {
+	var received *Request
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/allowed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+				body := map[string]interface{}{"status": true}
+				require.NoError(t, json.NewEncoder(w).Encode(body))
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	testCases := []struct {
+		repo              string
+		expectedProjectId string
+		expectedWiki      bool
+	}{
+		{repo: "project-id/1234.git", expectedProjectId: "1234"},
+		{repo: "project-id/1234.wiki.git", expectedProjectId: "1234", expectedWiki: true},
+		{repo: "group/project.git"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.repo, func(t *testing.T) {
+			received = nil
+
+			client, err := NewClient(&config.Config{GitlabUrl: url})
+			require.NoError(t, err)
+
+			_, err = client.Verify(&commandargs.Shell{GitlabKeyId: "1"}, uploadPackAction, tc.repo)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.repo, received.Repo)
+			require.Equal(t, tc.expectedProjectId, received.ProjectId)
+			require.Equal(t, tc.expectedWiki, received.Wiki)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package agit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet"
+)
+
+const (
+	mergeRequestPath = "/agit_merge_request"
+)
+
+type Client struct {
+	config *config.Config
+	client *client.GitlabNetClient
+}
+
+// Request asks GitLab to create or update the merge request of a push to
+// refs/for/<target>. Target may end with a topic, e.g. main/my-topic, GitLab
+// matches it against the existing branches.
+type Request struct {
+	GlRepository string `json:"gl_repository"`
+	UserId       string `json:"gl_id"`
+	Username     string `json:"gl_username"`
+	Target       string `json:"target"`
+	Ref          string `json:"ref"`
+	Oid          string `json:"oid"`
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type Response struct {
+	Success         bool   `json:"success"`
+	Message         string `json:"message"`
+	Created         bool   `json:"created"`
+	MergeRequestIid int64  `json:"merge_request_iid"`
+	MergeRequestUrl string `json:"merge_request_url"`
+}
+
+func NewClient(config *config.Config) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{config: config, client: client}, nil
+}
+
+// MergeRequest creates or updates the merge request from the hidden ref the
+// commits were pushed to.
+func (c *Client) MergeRequest(request *Request) (*Response, error) {
+	response, err := c.client.Post(mergeRequestPath, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return parse(response)
+}
+
+func parse(hr *http.Response) (*Response, error) {
+	response := &Response{}
+	if err := gitlabnet.ParseJSON(hr, response); err != nil {
+		return nil, err
+	}
+
+	if !response.Success {
+		return nil, errors.New(response.Message)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,108 @@
+package agit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+func setup(t *testing.T) (*Client, func()) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/agit_merge_request",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				var request *Request
+				require.NoError(t, json.Unmarshal(b, &request))
+
+				switch request.Target {
+				case "main/topic":
+					require.Equal(t, "project-1", request.GlRepository)
+					require.Equal(t, "refs/agit/1/abc/main/topic", request.Ref)
+					require.Equal(t, "Fix the build", request.Title)
+
+					body := map[string]interface{}{
+						"success":           true,
+						"created":           true,
+						"merge_request_iid": 7,
+						"merge_request_url": "https://gitlab.example.com/group/project/-/merge_requests/7",
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+				case "missing":
+					body := map[string]interface{}{
+						"success": false,
+						"message": "The target branch missing doesn't exist",
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+
+	client, err := NewClient(&config.Config{GitlabUrl: url})
+	require.NoError(t, err)
+
+	return client, cleanup
+}
+
+func TestMergeRequest(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	response, err := client.MergeRequest(&Request{
+		GlRepository: "project-1",
+		Target:       "main/topic",
+		Ref:          "refs/agit/1/abc/main/topic",
+		Title:        "Fix the build",
+	})
+	require.NoError(t, err)
+	require.Equal(t, &Response{
+		Success:         true,
+		Created:         true,
+		MergeRequestIid: 7,
+		MergeRequestUrl: "https://gitlab.example.com/group/project/-/merge_requests/7",
+	}, response)
+}
+
+func TestErrorResponses(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		target        string
+		expectedError string
+	}{
+		{
+			desc:          "A response with an error message",
+			target:        "missing",
+			expectedError: "The target branch missing doesn't exist",
+		},
+		{
+			desc:          "An error response without message",
+			target:        "broken",
+			expectedError: "Internal API error (500)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			response, err := client.MergeRequest(&Request{Target: tc.target})
+
+			require.EqualError(t, err, tc.expectedError)
+			require.Nil(t, response)
+		})
+	}
+}
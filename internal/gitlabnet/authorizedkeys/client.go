@@ -19,8 +19,9 @@ type Client struct {
 }
 
 type Response struct {
-	Id  int64  `json:"id"`
-	Key string `json:"key"`
+	Id              int64    `json:"id"`
+	Key             string   `json:"key"`
+	AllowedCommands []string `json:"allowed_commands"`
 }
 
 func NewClient(config *config.Config) (*Client, error) {
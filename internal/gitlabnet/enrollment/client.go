@@ -0,0 +1,78 @@
+package enrollment
+
+import (
+	"fmt"
+	"net/http"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet"
+)
+
+const (
+	enrollPath = "/enroll_deploy_key"
+)
+
+type Client struct {
+	config *config.Config
+	client *client.GitlabNetClient
+}
+
+// Request redeems a one-time code. The code is only valid once and
+// identifies the project the key is added to.
+type Request struct {
+	Code     string `json:"code"`
+	Key      string `json:"key"`
+	RemoteIp string `json:"remote_ip,omitempty"`
+}
+
+// RefusedError is returned when GitLab refuses the code
+type RefusedError struct {
+	Message string
+}
+
+func (e *RefusedError) Error() string {
+	return e.Message
+}
+
+type Response struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	KeyId   int64  `json:"key_id"`
+	Title   string `json:"title"`
+	Project string `json:"project"`
+	CanPush bool   `json:"can_push"`
+}
+
+func NewClient(config *config.Config) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{config: config, client: client}, nil
+}
+
+// Enroll adds key as a deploy key to the project the code was generated for
+func (c *Client) Enroll(request *Request) (*Response, error) {
+	response, err := c.client.Post(enrollPath, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return parse(response)
+}
+
+func parse(hr *http.Response) (*Response, error) {
+	response := &Response{}
+	if err := gitlabnet.ParseJSON(hr, response); err != nil {
+		return nil, err
+	}
+
+	if !response.Success {
+		return nil, &RefusedError{Message: response.Message}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,100 @@
+package enrollment
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+const (
+	key = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBmhkEhEIE1ovGritMH9yeeCkmVEnE7NDt1wstiTR9+Q"
+)
+
+func setup(t *testing.T) (*Client, func()) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/enroll_deploy_key",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				var request *Request
+				require.NoError(t, json.Unmarshal(b, &request))
+				require.Equal(t, key, request.Key)
+
+				switch request.Code {
+				case "valid":
+					body := map[string]interface{}{
+						"success":  true,
+						"key_id":   7,
+						"title":    "ci-runner-1",
+						"project":  "group/project",
+						"can_push": false,
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+				case "used":
+					body := map[string]interface{}{
+						"success": false,
+						"message": "The enrollment code is invalid or expired",
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+
+	client, err := NewClient(&config.Config{GitlabUrl: url})
+	require.NoError(t, err)
+
+	return client, cleanup
+}
+
+func TestEnroll(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	response, err := client.Enroll(&Request{Code: "valid", Key: key})
+	require.NoError(t, err)
+	require.Equal(t, &Response{Success: true, KeyId: 7, Title: "ci-runner-1", Project: "group/project"}, response)
+}
+
+func TestErrorResponses(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		code          string
+		expectedError string
+	}{
+		{
+			desc:          "A response with an error message",
+			code:          "used",
+			expectedError: "The enrollment code is invalid or expired",
+		},
+		{
+			desc:          "An error response without message",
+			code:          "broken",
+			expectedError: "Internal API error (500)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			response, err := client.Enroll(&Request{Code: tc.code, Key: key})
+
+			require.EqualError(t, err, tc.expectedError)
+			require.Nil(t, response)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package healthcheck
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"gitlab.com/gitlab-org/gitlab-shell/client"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
@@ -23,6 +24,10 @@ type Response struct {
 	GitlabVersion  string `json:"gitlab_version"`
 	GitlabRevision string `json:"gitlab_rev"`
 	Redis          bool   `json:"redis"`
+
+	// ClockDrift is how far the local clock is ahead of the GitLab clock,
+	// nil when GitLab didn't send a Date header.
+	ClockDrift *time.Duration `json:"-"`
 }
 
 func NewClient(config *config.Config) (*Client, error) {
@@ -35,14 +40,25 @@ func NewClient(config *config.Config) (*Client, error) {
 }
 
 func (c *Client) Check() (*Response, error) {
+	start := time.Now()
 	resp, err := c.client.Get(checkPath)
 	if err != nil {
 		return nil, err
 	}
+	end := time.Now()
 
 	defer resp.Body.Close()
 
-	return parse(resp)
+	response, err := parse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if drift, ok := client.ClockDrift(resp, start, end); ok {
+		response.ClockDrift = &drift
+	}
+
+	return response, nil
 }
 
 func parse(hr *http.Response) (*Response, error) {
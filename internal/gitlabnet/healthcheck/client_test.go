@@ -35,6 +35,11 @@ func TestCheck(t *testing.T) {
 
 	result, err := client.Check()
 	require.NoError(t, err)
+
+	require.NotNil(t, result.ClockDrift)
+	require.InDelta(t, 0, result.ClockDrift.Seconds(), 1)
+
+	result.ClockDrift = nil
 	require.Equal(t, testResponse, result)
 }
 
@@ -0,0 +1,74 @@
+package hostkeys
+
+import (
+	"fmt"
+	"net/http"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet"
+)
+
+const (
+	hostKeysPath = "/host_keys"
+)
+
+type Client struct {
+	config *config.Config
+	client *client.GitlabNetClient
+}
+
+type HostKey struct {
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"public_key"`
+}
+
+type Request struct {
+	Host     string    `json:"host"`
+	Port     int       `json:"port,omitempty"`
+	HostKeys []HostKey `json:"host_keys"`
+}
+
+type Response struct {
+	HostKeys []HostKey `json:"host_keys"`
+}
+
+func NewClient(config *config.Config) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{config: config, client: client}, nil
+}
+
+// Published returns the host keys GitLab currently displays to its users
+func (c *Client) Published() (*Response, error) {
+	response, err := c.client.Get(hostKeysPath)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return parse(response)
+}
+
+func (c *Client) Publish(request *Request) (*Response, error) {
+	response, err := c.client.Post(hostKeysPath, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return parse(response)
+}
+
+func parse(hr *http.Response) (*Response, error) {
+	response := &Response{}
+	if err := gitlabnet.ParseJSON(hr, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,65 @@
+package hostkeys
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+var (
+	hostKeys = []HostKey{{Type: "ssh-ed25519", Fingerprint: "SHA256:fingerprint", PublicKey: "ssh-ed25519 AAAA"}}
+)
+
+func setup(t *testing.T) (*Client, func()) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/host_keys",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"host_keys": hostKeys}))
+				case http.MethodPost:
+					b, err := ioutil.ReadAll(r.Body)
+					require.NoError(t, err)
+
+					var request *Request
+					require.NoError(t, json.Unmarshal(b, &request))
+					require.Equal(t, "gitlab.example.com", request.Host)
+
+					require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"host_keys": request.HostKeys}))
+				}
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+
+	client, err := NewClient(&config.Config{GitlabUrl: url})
+	require.NoError(t, err)
+
+	return client, cleanup
+}
+
+func TestPublished(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	response, err := client.Published()
+	require.NoError(t, err)
+	require.Equal(t, &Response{HostKeys: hostKeys}, response)
+}
+
+func TestPublish(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	response, err := client.Publish(&Request{Host: "gitlab.example.com", HostKeys: hostKeys})
+	require.NoError(t, err)
+	require.Equal(t, &Response{HostKeys: hostKeys}, response)
+}
@@ -0,0 +1,79 @@
+package jobtrace
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet"
+)
+
+const (
+	tracePath = "/job_trace"
+)
+
+type Client struct {
+	config *config.Config
+	client *client.GitlabNetClient
+}
+
+// Response holds the part of the trace starting at the requested offset.
+// Offset is where the next part starts, and Complete tells whether the job
+// finished and its trace won't grow anymore.
+type Response struct {
+	Success  bool   `json:"success"`
+	Message  string `json:"message"`
+	Content  string `json:"content"`
+	Offset   int64  `json:"offset"`
+	Complete bool   `json:"complete"`
+	Status   string `json:"status"`
+}
+
+func NewClient(config *config.Config) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{config: config, client: client}, nil
+}
+
+// Get returns the trace of the job from offset. GitLab checks that the user
+// of the key may read the job.
+func (c *Client) Get(args *commandargs.Shell, project string, jobId, offset int64) (*Response, error) {
+	params := url.Values{}
+	params.Add("project", project)
+	params.Add("job_id", strconv.FormatInt(jobId, 10))
+	params.Add("offset", strconv.FormatInt(offset, 10))
+	if args.GitlabUsername != "" {
+		params.Add("username", args.GitlabUsername)
+	} else {
+		params.Add("key_id", args.GitlabKeyId)
+	}
+
+	response, err := c.client.Get(tracePath + "?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return parse(response)
+}
+
+func parse(hr *http.Response) (*Response, error) {
+	response := &Response{}
+	if err := gitlabnet.ParseJSON(hr, response); err != nil {
+		return nil, err
+	}
+
+	if !response.Success {
+		return nil, errors.New(response.Message)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,95 @@
+package jobtrace
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+func setup(t *testing.T) (*Client, func()) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/job_trace",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+
+				switch query.Get("job_id") {
+				case "1":
+					require.Equal(t, "group/project", query.Get("project"))
+					require.Equal(t, "12", query.Get("offset"))
+					require.Equal(t, "1", query.Get("key_id"))
+
+					body := map[string]interface{}{
+						"success":  true,
+						"content":  "Job succeeded\n",
+						"offset":   26,
+						"complete": true,
+						"status":   "success",
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+				case "2":
+					body := map[string]interface{}{
+						"success": false,
+						"message": "Job not found",
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+
+	client, err := NewClient(&config.Config{GitlabUrl: url})
+	require.NoError(t, err)
+
+	return client, cleanup
+}
+
+func TestGet(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	response, err := client.Get(&commandargs.Shell{GitlabKeyId: "1"}, "group/project", 1, 12)
+	require.NoError(t, err)
+	require.Equal(t, &Response{Success: true, Content: "Job succeeded\n", Offset: 26, Complete: true, Status: "success"}, response)
+}
+
+func TestErrorResponses(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		jobId         int64
+		expectedError string
+	}{
+		{
+			desc:          "A response with an error message",
+			jobId:         2,
+			expectedError: "Job not found",
+		},
+		{
+			desc:          "An error response without message",
+			jobId:         3,
+			expectedError: "Internal API error (500)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			response, err := client.Get(&commandargs.Shell{GitlabKeyId: "1"}, "group/project", tc.jobId, 0)
+
+			require.EqualError(t, err, tc.expectedError)
+			require.Nil(t, response)
+		})
+	}
+}
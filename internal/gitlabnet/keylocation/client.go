@@ -0,0 +1,44 @@
+package keylocation
+
+import (
+	"fmt"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet"
+)
+
+const (
+	alertsPath = "/key_location_alerts"
+)
+
+type Client struct {
+	config *config.Config
+	client *client.GitlabNetClient
+}
+
+type Request struct {
+	KeyId    string `json:"key_id"`
+	IpPrefix string `json:"ip_prefix"`
+	RemoteIp string `json:"remote_ip"`
+}
+
+func NewClient(config *config.Config) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{config: config, client: client}, nil
+}
+
+// Notify tells GitLab a key was used from a network it wasn't used from
+// before, so the owner can be alerted.
+func (c *Client) Notify(request *Request) error {
+	response, err := c.client.Post(alertsPath, request)
+	if err != nil {
+		return err
+	}
+
+	return response.Body.Close()
+}
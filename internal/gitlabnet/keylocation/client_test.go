@@ -0,0 +1,44 @@
+package keylocation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+func TestNotify(t *testing.T) {
+	var received *Request
+
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/key_location_alerts",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+				require.NoError(t, json.Unmarshal(b, &received))
+
+				if received.KeyId == "broken" {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	client, err := NewClient(&config.Config{GitlabUrl: url})
+	require.NoError(t, err)
+
+	request := &Request{KeyId: "1", IpPrefix: "192.0.2.0/24", RemoteIp: "192.0.2.10"}
+	require.NoError(t, client.Notify(request))
+	require.Equal(t, request, received)
+
+	require.EqualError(t, client.Notify(&Request{KeyId: "broken"}), "Internal API error (500)")
+}
@@ -9,6 +9,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/projectid"
 )
 
 type Client struct {
@@ -22,6 +23,7 @@ type Request struct {
 	Repo      string `json:"project"`
 	KeyId     string `json:"key_id,omitempty"`
 	UserId    string `json:"user_id,omitempty"`
+	ProjectId string `json:"project_id,omitempty"`
 }
 
 type Response struct {
@@ -42,6 +44,10 @@ func NewClient(config *config.Config, args *commandargs.Shell) (*Client, error)
 
 func (c *Client) Authenticate(operation, repo, userId string) (*Response, error) {
 	request := &Request{Operation: operation, Repo: repo}
+	if ref := projectid.Parse(repo); ref != nil {
+		request.ProjectId = ref.Id
+	}
+
 	if c.args.GitlabKeyId != "" {
 		request.KeyId = c.args.GitlabKeyId
 	} else {
@@ -133,3 +133,32 @@ func TestSuccessfulRequests(t *testing.T) {
 		})
 	}
 }
+
+func TestProjectIdPath(t *testing.T) {
+	var received *Request
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/lfs_authenticate",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+				body := map[string]interface{}{"repository_http_path": "https://gitlab.com/group/renamed.git"}
+				require.NoError(t, json.NewEncoder(w).Encode(body))
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartHttpServer(t, requests)
+	defer cleanup()
+
+	args := &commandargs.Shell{GitlabKeyId: keyId, CommandType: commandargs.LfsAuthenticate}
+	client, err := NewClient(&config.Config{GitlabUrl: url}, args)
+	require.NoError(t, err)
+
+	response, err := client.Authenticate("download", "project-id/1234.git", "")
+	require.NoError(t, err)
+	require.Equal(t, "https://gitlab.com/group/renamed.git", response.RepoPath)
+
+	require.Equal(t, "project-id/1234.git", received.Repo)
+	require.Equal(t, "1234", received.ProjectId)
+}
@@ -0,0 +1,50 @@
+package transferreport
+
+import (
+	"fmt"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet"
+)
+
+const (
+	reportPath = "/git_transfer_completed"
+)
+
+type Client struct {
+	client *client.GitlabNetClient
+}
+
+type Request struct {
+	Action       string  `json:"action"`
+	GlRepository string  `json:"gl_repository"`
+	ProjectPath  string  `json:"gl_project_path"`
+	UserId       string  `json:"gl_id"`
+	Username     string  `json:"gl_username"`
+	KeyId        int     `json:"gl_key_id,omitempty"`
+	GitProtocol  string  `json:"git_protocol"`
+	ExitCode     int32   `json:"exit_code"`
+	Error        string  `json:"error,omitempty"`
+	BytesIn      int64   `json:"bytes_in"`
+	BytesOut     int64   `json:"bytes_out"`
+	DurationMs   float64 `json:"duration_ms"`
+}
+
+func NewClient(config *config.Config) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{client: client}, nil
+}
+
+func (c *Client) Send(request *Request) error {
+	response, err := c.client.Post(reportPath, request)
+	if err != nil {
+		return err
+	}
+
+	return response.Body.Close()
+}
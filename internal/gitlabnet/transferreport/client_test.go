@@ -0,0 +1,41 @@
+package transferreport
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+func TestSend(t *testing.T) {
+	var received *Request
+
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/git_transfer_completed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+				if received.GlRepository == "broken" {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+	defer cleanup()
+
+	client, err := NewClient(&config.Config{GitlabUrl: url})
+	require.NoError(t, err)
+
+	request := &Request{Action: "git-upload-pack", GlRepository: "project-1", UserId: "user-1", ExitCode: 0, BytesIn: 10, BytesOut: 20}
+	require.NoError(t, client.Send(request))
+	require.Equal(t, request, received)
+
+	require.EqualError(t, client.Send(&Request{GlRepository: "broken"}), "Internal API error (500)")
+}
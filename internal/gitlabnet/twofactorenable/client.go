@@ -0,0 +1,110 @@
+package twofactorenable
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/discover"
+)
+
+const (
+	provisionPath = "/two_factor_otp_provision"
+	activatePath  = "/two_factor_otp_activate"
+)
+
+type Client struct {
+	config *config.Config
+	client *client.GitlabNetClient
+}
+
+type Response struct {
+	Success       bool     `json:"success"`
+	Message       string   `json:"message"`
+	Secret        string   `json:"secret"`
+	ProvisionUri  string   `json:"provisioning_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type RequestBody struct {
+	KeyId  string `json:"key_id,omitempty"`
+	UserId int64  `json:"user_id,omitempty"`
+	OTP    string `json:"otp_attempt,omitempty"`
+}
+
+func NewClient(config *config.Config) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{config: config, client: client}, nil
+}
+
+// Provision generates a new TOTP secret for the user. Two-factor
+// authentication isn't enabled until the secret is confirmed with Activate.
+func (c *Client) Provision(args *commandargs.Shell) (*Response, error) {
+	requestBody, err := c.getRequestBody(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.post(provisionPath, requestBody)
+}
+
+// Activate enables two-factor authentication when otp was generated from the
+// provisioned secret, and returns the new recovery codes.
+func (c *Client) Activate(args *commandargs.Shell, otp string) (*Response, error) {
+	requestBody, err := c.getRequestBody(args)
+	if err != nil {
+		return nil, err
+	}
+	requestBody.OTP = otp
+
+	return c.post(activatePath, requestBody)
+}
+
+func (c *Client) post(path string, requestBody *RequestBody) (*Response, error) {
+	response, err := c.client.Post(path, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return parse(response)
+}
+
+func parse(hr *http.Response) (*Response, error) {
+	response := &Response{}
+	if err := gitlabnet.ParseJSON(hr, response); err != nil {
+		return nil, err
+	}
+
+	if !response.Success {
+		return nil, errors.New(response.Message)
+	}
+
+	return response, nil
+}
+
+func (c *Client) getRequestBody(args *commandargs.Shell) (*RequestBody, error) {
+	if args.GitlabKeyId != "" {
+		return &RequestBody{KeyId: args.GitlabKeyId}, nil
+	}
+
+	client, err := discover.NewClient(c.config)
+	if err != nil {
+		return nil, err
+	}
+
+	userInfo, err := client.GetByCommandArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RequestBody{UserId: userInfo.UserId}, nil
+}
@@ -0,0 +1,100 @@
+package twofactorenable
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/gitlabnet/discover"
+)
+
+const (
+	provisionUri = "otpauth://totp/GitLab:jane-doe?secret=JBSWY3DPEHPK3PXP&issuer=GitLab"
+)
+
+func setup(t *testing.T) (*Client, func()) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/two_factor_otp_provision",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				requestBody := readRequestBody(t, r)
+
+				if requestBody.KeyId == "forbidden" {
+					json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "Two-factor authentication is already enabled"})
+					return
+				}
+
+				require.True(t, requestBody.KeyId == "1" || requestBody.UserId == 1)
+				json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "secret": "JBSWY3DPEHPK3PXP", "provisioning_uri": provisionUri})
+			},
+		},
+		{
+			Path: "/api/v4/internal/two_factor_otp_activate",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				requestBody := readRequestBody(t, r)
+
+				if requestBody.OTP != "123456" {
+					json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "Invalid code"})
+					return
+				}
+
+				json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "recovery_codes": []string{"recovery", "codes"}})
+			},
+		},
+		{
+			Path: "/api/v4/internal/discover",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(&discover.Response{UserId: 1, Username: "jane-doe"})
+			},
+		},
+	}
+
+	url, cleanup := testserver.StartSocketHttpServer(t, requests)
+
+	client, err := NewClient(&config.Config{GitlabUrl: url})
+	require.NoError(t, err)
+
+	return client, cleanup
+}
+
+func readRequestBody(t *testing.T, r *http.Request) *RequestBody {
+	b, err := ioutil.ReadAll(r.Body)
+	require.NoError(t, err)
+
+	var requestBody *RequestBody
+	require.NoError(t, json.Unmarshal(b, &requestBody))
+
+	return requestBody
+}
+
+func TestProvision(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	for _, args := range []*commandargs.Shell{{GitlabKeyId: "1"}, {GitlabUsername: "jane-doe"}} {
+		response, err := client.Provision(args)
+		require.NoError(t, err)
+		require.Equal(t, &Response{Success: true, Secret: "JBSWY3DPEHPK3PXP", ProvisionUri: provisionUri}, response)
+	}
+
+	_, err := client.Provision(&commandargs.Shell{GitlabKeyId: "forbidden"})
+	require.EqualError(t, err, "Two-factor authentication is already enabled")
+}
+
+func TestActivate(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	response, err := client.Activate(&commandargs.Shell{GitlabKeyId: "1"}, "123456")
+	require.NoError(t, err)
+	require.Equal(t, []string{"recovery", "codes"}, response.RecoveryCodes)
+
+	_, err = client.Activate(&commandargs.Shell{GitlabKeyId: "1"}, "654321")
+	require.EqualError(t, err, "Invalid code")
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// gitalyErrorMessages explain failed Gitaly calls to users. The gRPC errors
+// are meant for administrators and only logged.
+var gitalyErrorMessages = map[codes.Code]string{
+	codes.Unavailable:       "The Git storage service is unavailable at the moment. Please try again in a few minutes.",
+	codes.ResourceExhausted: "The Git storage service is too busy at the moment. Please try again in a few minutes.",
+	codes.DeadlineExceeded:  "The Git operation took too long and was stopped. Please try again, fetching less history may help, e.g. with --depth.",
+	codes.NotFound:          "The repository couldn't be found on the Git storage. Please try again, and contact your GitLab administrator if the problem persists.",
+	codes.PermissionDenied:  "The Git storage service refused the operation. Please contact your GitLab administrator.",
+	codes.Canceled:          "The Git operation was canceled. Please try again.",
+	// Usually a wrong Gitaly token or clocks that differ too much
+	codes.Unauthenticated: "The server can't reach the Git storage at the moment. Please contact your GitLab administrator.",
+}
+
+// genericGitalyErrorMessage explains the other codes, whose details may reveal
+// internals
+const genericGitalyErrorMessage = "The Git operation failed on the Git storage service. Please try again, and contact your GitLab administrator if the problem persists."
+
+// GitalyError is a failed Gitaly call explained to the user
+type GitalyError struct {
+	Code    codes.Code
+	Message string
+}
+
+func (e *GitalyError) Error() string {
+	return e.Message
+}
+
+// translateError replaces gRPC errors by GitalyError after logging them.
+// Errors without a gRPC status are returned as is.
+func (gc *GitalyCommand) translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	message, ok := gitalyErrorMessages[st.Code()]
+	if !ok {
+		message = genericGitalyErrorMessage
+	}
+
+	log.WithError(err).WithFields(log.Fields{
+		"command":      gc.ServiceName,
+		"grpc_code":    st.Code().String(),
+		"grpc_message": st.Message(),
+	}).Error("Gitaly call failed")
+
+	return &GitalyError{Code: st.Code(), Message: message}
+}
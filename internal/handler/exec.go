@@ -54,7 +54,7 @@ func (gc *GitalyCommand) RunGitalyCommand(handler GitalyHandlerFunc) error {
 
 	gitalyConn.close()
 
-	return err
+	return gc.translateError(err)
 }
 
 func (gc *GitalyCommand) LogExecution(repository *pb.Repository, response *accessverifier.Response, protocol string) {
@@ -1,16 +1,24 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/gitaly/client"
+	pb "gitlab.com/gitlab-org/gitaly/proto/go/gitalypb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
+	"gitlab.com/gitlab-org/gitlab-shell/client/testserver"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
 )
 
 func makeHandler(t *testing.T, err error) func(context.Context, *grpc.ClientConn) (int32, error) {
@@ -36,6 +44,94 @@ func TestRunGitalyCommand(t *testing.T) {
 	require.Equal(t, err, expectedErr)
 }
 
+func TestRunGitalyCommandErrors(t *testing.T) {
+	testCases := []struct {
+		code            codes.Code
+		expectedMessage string
+	}{
+		{
+			code:            codes.Unavailable,
+			expectedMessage: "The Git storage service is unavailable at the moment. Please try again in a few minutes.",
+		},
+		{
+			code:            codes.ResourceExhausted,
+			expectedMessage: "The Git storage service is too busy at the moment. Please try again in a few minutes.",
+		},
+		{
+			code:            codes.DeadlineExceeded,
+			expectedMessage: "The Git operation took too long and was stopped. Please try again, fetching less history may help, e.g. with --depth.",
+		},
+		{
+			code:            codes.NotFound,
+			expectedMessage: "The repository couldn't be found on the Git storage. Please try again, and contact your GitLab administrator if the problem persists.",
+		},
+		{
+			code:            codes.PermissionDenied,
+			expectedMessage: "The Git storage service refused the operation. Please contact your GitLab administrator.",
+		},
+		{
+			code:            codes.Canceled,
+			expectedMessage: "The Git operation was canceled. Please try again.",
+		},
+		{
+			code:            codes.Unauthenticated,
+			expectedMessage: "The server can't reach the Git storage at the moment. Please contact your GitLab administrator.",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.code.String(), func(t *testing.T) {
+			address, cleanup := testserver.StartFailingGitalyServer(t, status.Error(tc.code, "storage gitaly-1: internal details"))
+			defer cleanup()
+
+			hook := testhelper.SetupLogger()
+
+			cmd := GitalyCommand{Config: &config.Config{}, ServiceName: "git-upload-pack", Address: address}
+			err := cmd.RunGitalyCommand(func(ctx context.Context, conn *grpc.ClientConn) (int32, error) {
+				request := &pb.SSHUploadPackRequest{Repository: &pb.Repository{RelativePath: "group/repo.git"}}
+				return client.UploadPack(ctx, conn, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{}, request)
+			})
+
+			require.EqualError(t, err, tc.expectedMessage)
+			require.NotContains(t, err.Error(), "internal details")
+
+			gitalyErr, ok := err.(*GitalyError)
+			require.True(t, ok)
+			require.Equal(t, tc.code, gitalyErr.Code)
+
+			require.True(t, testhelper.WaitForLogEvent(hook))
+			entry := hook.LastEntry()
+			require.Contains(t, entry.Message, "level=error")
+			require.Contains(t, entry.Message, "Gitaly call failed")
+			require.Contains(t, entry.Message, "grpc_code="+tc.code.String())
+			require.Contains(t, entry.Message, "command=git-upload-pack")
+			require.Contains(t, entry.Message, `grpc_message="storage gitaly-1: internal details"`)
+		})
+	}
+}
+
+func TestRunGitalyCommandUnknownError(t *testing.T) {
+	cmd := GitalyCommand{Config: &config.Config{}, Address: "tcp://localhost:9999"}
+
+	for _, code := range []codes.Code{codes.Internal, codes.Unknown, codes.FailedPrecondition} {
+		t.Run(code.String(), func(t *testing.T) {
+			hook := testhelper.SetupLogger()
+
+			err := cmd.RunGitalyCommand(makeHandler(t, status.Error(code, "open /var/opt/gitlab/git-data: no such file")))
+			require.Equal(t, &GitalyError{Code: code, Message: genericGitalyErrorMessage}, err)
+			require.NotContains(t, err.Error(), "git-data")
+
+			require.True(t, testhelper.WaitForLogEvent(hook))
+			require.Contains(t, hook.LastEntry().Message, "grpc_code="+code.String())
+			require.Contains(t, hook.LastEntry().Message, "git-data")
+		})
+	}
+
+	// Errors without a status aren't from Gitaly
+	expectedErr := errors.New("broken pipe")
+	require.Equal(t, expectedErr, cmd.RunGitalyCommand(makeHandler(t, expectedErr)))
+}
+
 func TestMissingGitalyAddress(t *testing.T) {
 	cmd := GitalyCommand{Config: &config.Config{}}
 
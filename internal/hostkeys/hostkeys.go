@@ -0,0 +1,119 @@
+package hostkeys
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	DefaultHostKeyFiles = "/etc/ssh/ssh_host_*_key.pub"
+	DefaultSshPort      = 22
+
+	// https://www.iana.org/assignments/dns-sshfp-rr-parameters
+	sshfpSha256 = 2
+)
+
+var (
+	sshfpAlgorithms = map[string]int{
+		ssh.KeyAlgoRSA:      1,
+		ssh.KeyAlgoDSA:      2,
+		ssh.KeyAlgoECDSA256: 3,
+		ssh.KeyAlgoECDSA384: 3,
+		ssh.KeyAlgoECDSA521: 3,
+		ssh.KeyAlgoED25519:  4,
+	}
+)
+
+type HostKey struct {
+	File      string
+	PublicKey ssh.PublicKey
+}
+
+// Load reads the public host keys of sshd. When no files are given, the
+// keys in the default sshd location are used.
+func Load(files []string) ([]*HostKey, error) {
+	if len(files) == 0 {
+		matches, err := filepath.Glob(DefaultHostKeyFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		files = matches
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No host keys found in %s", DefaultHostKeyFiles)
+	}
+
+	var keys []*HostKey
+	for _, file := range files {
+		key, err := load(file)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func load(file string) (*HostKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid host key %s: %v", file, err)
+	}
+
+	return &HostKey{File: file, PublicKey: publicKey}, nil
+}
+
+func (k *HostKey) Type() string {
+	return k.PublicKey.Type()
+}
+
+func (k *HostKey) Fingerprint() string {
+	return ssh.FingerprintSHA256(k.PublicKey)
+}
+
+// SSHFPRecord returns a DNS SSHFP record with the SHA-256 fingerprint of the
+// key. Key types without an assigned SSHFP algorithm return an empty string.
+func (k *HostKey) SSHFPRecord(host string) string {
+	algorithm, ok := sshfpAlgorithms[k.Type()]
+	if !ok {
+		return ""
+	}
+
+	sum := sha256.Sum256(k.PublicKey.Marshal())
+
+	return fmt.Sprintf("%s. IN SSHFP %d %d %s", strings.TrimSuffix(host, "."), algorithm, sshfpSha256, hex.EncodeToString(sum[:]))
+}
+
+// String returns the key in the authorized_keys format, without a comment
+func (k *HostKey) String() string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k.PublicKey)))
+}
+
+// KnownHostsLine returns the line clients can add to their known_hosts file
+func (k *HostKey) KnownHostsLine(host string, port int) string {
+	return fmt.Sprintf("%s %s", KnownHostsAddress(host, port), k.String())
+}
+
+// KnownHostsAddress formats a host the way OpenSSH stores it in known_hosts
+func KnownHostsAddress(host string, port int) string {
+	if port == 0 || port == DefaultSshPort {
+		return host
+	}
+
+	return fmt.Sprintf("[%s]:%d", host, port)
+}
@@ -0,0 +1,85 @@
+package hostkeys
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/testhelper"
+)
+
+const (
+	ed25519Key = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIYJb/hz8JexXKsDYZ0rNU+K/qZJN5LWE3o4zzsFGkPY"
+)
+
+func TestLoad(t *testing.T) {
+	cleanup, err := testhelper.PrepareTestRootDir()
+	require.NoError(t, err)
+	defer cleanup()
+
+	files := []string{
+		path.Join(testhelper.TestRoot, "hostkeys/ssh_host_ed25519_key.pub"),
+		path.Join(testhelper.TestRoot, "hostkeys/ssh_host_rsa_key.pub"),
+	}
+
+	keys, err := Load(files)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+
+	testCases := []struct {
+		desc        string
+		key         *HostKey
+		keyType     string
+		fingerprint string
+		sshfp       string
+	}{
+		{
+			desc:        "ED25519 key",
+			key:         keys[0],
+			keyType:     "ssh-ed25519",
+			fingerprint: "SHA256:aqF0VxuREXrdcC1ShOcYlg8ytsVJlI28xdFa5OrvjtI",
+			sshfp:       "gitlab.example.com. IN SSHFP 4 2 6aa174571b91117add702d5284e718960f32b6c549948dbcc5d15ae4eaef8ed2",
+		},
+		{
+			desc:        "RSA key",
+			key:         keys[1],
+			keyType:     "ssh-rsa",
+			fingerprint: "SHA256:2xkcgig+EYl7geFr/skvJNujUpuqjaJB2ibvuhWHp3M",
+			sshfp:       "gitlab.example.com. IN SSHFP 1 2 db191c82283e11897b81e16bfec92f24dba3529baa8da241da26efba1587a773",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			require.Equal(t, tc.keyType, tc.key.Type())
+			require.Equal(t, tc.fingerprint, tc.key.Fingerprint())
+			require.Equal(t, tc.sshfp, tc.key.SSHFPRecord("gitlab.example.com"))
+		})
+	}
+}
+
+func TestLoadFailure(t *testing.T) {
+	cleanup, err := testhelper.PrepareTestRootDir()
+	require.NoError(t, err)
+	defer cleanup()
+
+	_, err = Load([]string{path.Join(testhelper.TestRoot, "hostkeys/missing.pub")})
+	require.Error(t, err)
+
+	_, err = Load([]string{path.Join(testhelper.TestRoot, "config.yml")})
+	require.Error(t, err)
+}
+
+func TestKnownHostsLine(t *testing.T) {
+	cleanup, err := testhelper.PrepareTestRootDir()
+	require.NoError(t, err)
+	defer cleanup()
+
+	keys, err := Load([]string{path.Join(testhelper.TestRoot, "hostkeys/ssh_host_ed25519_key.pub")})
+	require.NoError(t, err)
+
+	require.Equal(t, "gitlab.example.com "+ed25519Key, keys[0].KnownHostsLine("gitlab.example.com", 0))
+	require.Equal(t, "gitlab.example.com "+ed25519Key, keys[0].KnownHostsLine("gitlab.example.com", 22))
+	require.Equal(t, "[gitlab.example.com]:2222 "+ed25519Key, keys[0].KnownHostsLine("gitlab.example.com", 2222))
+}
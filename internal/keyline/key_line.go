@@ -5,20 +5,30 @@ import (
 	"fmt"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
 	"gitlab.com/gitlab-org/gitlab-shell/internal/executable"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/shellquote"
 )
 
 var (
-	keyRegex = regexp.MustCompile(`\A[a-z0-9-]+\z`)
+	// NoAllowedCommandsError is returned when a key is restricted to no
+	// commands at all, which authorized_keys can't express
+	NoAllowedCommandsError = errors.New("No commands are allowed")
+
+	keyRegex     = regexp.MustCompile(`\A[a-z0-9-]+\z`)
+	commandRegex = regexp.MustCompile(`\A[a-z0-9_-]+\z`)
 )
 
 const (
 	PublicKeyPrefix = "key"
 	PrincipalPrefix = "username"
+	AnonymousPrefix = "anonymous"
 	SshOptions      = "no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty"
+
+	allowedCommandsArgument = "allowed-commands"
 )
 
 type KeyLine struct {
@@ -26,6 +36,9 @@ type KeyLine struct {
 	Value  string // This can be either a public key or a principal name
 	Prefix string
 	Config *config.Config
+
+	// AllowedCommands restricts the commands the key may run, when not nil
+	AllowedCommands []string
 }
 
 func NewPublicKeyLine(id, publicKey string, config *config.Config) (*KeyLine, error) {
@@ -36,23 +49,91 @@ func NewPrincipalKeyLine(keyId, principal string, config *config.Config) (*KeyLi
 	return newKeyLine(keyId, principal, PrincipalPrefix, config)
 }
 
+// NewAnonymousKeyLine builds a line for a public key that isn't known to
+// GitLab. The resulting command doesn't identify any user.
+func NewAnonymousKeyLine(publicKey string, config *config.Config) (*KeyLine, error) {
+	if err := validateValue(publicKey); err != nil {
+		return nil, err
+	}
+
+	return &KeyLine{Value: publicKey, Prefix: AnonymousPrefix, Config: config}, nil
+}
+
+// ToString renders the authorized_keys line. sshd runs the command with the
+// user's shell, so the environment and the command path are quoted for it.
 func (k *KeyLine) ToString() string {
-	sslCertDirEnvVar := k.sslCertDirEnvVar()
-	command := fmt.Sprintf("%s %s-%s", path.Join(k.Config.RootDir, executable.BinDir, executable.GitlabShell), k.Prefix, k.Id)
+	words := append(k.envAssignments(), shellquote.Quote(k.commandPath()), k.arguments())
+	command := strings.Join(words, " ")
+
+	// Within the option only double quotes need escaping
+	command = strings.Replace(command, `"`, `\"`, -1)
+
+	return fmt.Sprintf(`command="%s",%s %s`, command, SshOptions, k.Value)
+}
 
-	if sslCertDirEnvVar != "" {
-		sslCertDirEnvVar = fmt.Sprintf(`%s `, sslCertDirEnvVar)
+// RestrictCommands limits the key to the given gitlab-shell commands. Nil
+// commands leave the key unrestricted, an empty list is refused as the key
+// would be unrestricted without the argument.
+func (k *KeyLine) RestrictCommands(commands []string) error {
+	if commands != nil && len(commands) == 0 {
+		return NoAllowedCommandsError
 	}
 
-	return fmt.Sprintf(`command="%s%s",%s %s`, sslCertDirEnvVar, command, SshOptions, k.Value)
+	for _, command := range commands {
+		if !commandRegex.MatchString(command) {
+			return errors.New(fmt.Sprintf("Invalid allowed command: %s", command))
+		}
+	}
+
+	k.AllowedCommands = commands
+
+	return nil
+}
+
+func (k *KeyLine) arguments() string {
+	if k.AllowedCommands == nil {
+		return k.who()
+	}
+
+	return fmt.Sprintf("%s %s=%s", k.who(), allowedCommandsArgument, strings.Join(k.AllowedCommands, ","))
 }
 
-func (k *KeyLine) sslCertDirEnvVar() string {
+func (k *KeyLine) who() string {
+	if k.Id == "" {
+		return k.Prefix
+	}
+
+	return fmt.Sprintf("%s-%s", k.Prefix, k.Id)
+}
+
+func (k *KeyLine) commandPath() string {
+	if k.Config.KeyLines.CommandPath != "" {
+		return k.Config.KeyLines.CommandPath
+	}
+
+	return path.Join(k.Config.RootDir, executable.BinDir, executable.GitlabShell)
+}
+
+// envAssignments returns the variables to set, SSL_CERT_DIR from
+// ssl_cert_dir first and the others ordered by name.
+func (k *KeyLine) envAssignments() []string {
+	var assignments []string
+
 	if k.Config.SslCertDir != "" {
-		return fmt.Sprintf(`SSL_CERT_DIR=%s`, k.Config.SslCertDir)
+		assignments = append(assignments, "SSL_CERT_DIR="+shellquote.Quote(k.Config.SslCertDir))
+	}
+
+	var names []string
+	for name := range k.Config.KeyLines.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		assignments = append(assignments, name+"="+shellquote.Quote(k.Config.KeyLines.Env[name]))
 	}
 
-	return ""
+	return assignments
 }
 
 func newKeyLine(id, value, prefix string, config *config.Config) (*KeyLine, error) {
@@ -63,11 +144,24 @@ func newKeyLine(id, value, prefix string, config *config.Config) (*KeyLine, erro
 	return &KeyLine{Id: id, Value: value, Prefix: prefix, Config: config}, nil
 }
 
-func validate(id string, value string) error {
+// ValidateId checks that id can identify a key or a user in a key line
+func ValidateId(id string) error {
 	if !keyRegex.MatchString(id) {
 		return errors.New(fmt.Sprintf("Invalid key_id: %s", id))
 	}
 
+	return nil
+}
+
+func validate(id string, value string) error {
+	if err := ValidateId(id); err != nil {
+		return err
+	}
+
+	return validateValue(value)
+}
+
+func validateValue(value string) error {
 	if strings.Contains(value, "\n") {
 		return errors.New(fmt.Sprintf("Invalid value: %s", value))
 	}
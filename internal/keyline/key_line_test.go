@@ -69,6 +69,37 @@ func TestFailingNewPrincipalKeyLine(t *testing.T) {
 	}
 }
 
+func TestNewAnonymousKeyLine(t *testing.T) {
+	cfg := &config.Config{RootDir: "/tmp"}
+
+	result, err := NewAnonymousKeyLine("ssh-ed25519 public-key", cfg)
+	require.NoError(t, err)
+	require.Equal(t, &KeyLine{Value: "ssh-ed25519 public-key", Prefix: AnonymousPrefix, Config: cfg}, result)
+
+	result, err = NewAnonymousKeyLine("ssh-ed25519 public\nkey", cfg)
+	require.Empty(t, result)
+	require.EqualError(t, err, "Invalid value: ssh-ed25519 public\nkey")
+}
+
+func TestRestrictCommands(t *testing.T) {
+	keyLine, err := NewPublicKeyLine("1", "public-key", &config.Config{RootDir: "/tmp"})
+	require.NoError(t, err)
+
+	require.NoError(t, keyLine.RestrictCommands([]string{"git-lfs-authenticate", "2fa_recovery_codes"}))
+	require.Equal(t, []string{"git-lfs-authenticate", "2fa_recovery_codes"}, keyLine.AllowedCommands)
+
+	err = keyLine.RestrictCommands([]string{"git-upload-pack\" evil"})
+	require.EqualError(t, err, "Invalid allowed command: git-upload-pack\" evil")
+
+	// Without the argument the key would be unrestricted
+	require.Equal(t, NoAllowedCommandsError, keyLine.RestrictCommands([]string{}))
+	require.Equal(t, []string{"git-lfs-authenticate", "2fa_recovery_codes"}, keyLine.AllowedCommands)
+
+	require.NoError(t, keyLine.RestrictCommands(nil))
+	require.Nil(t, keyLine.AllowedCommands)
+	require.Equal(t, `command="/tmp/bin/gitlab-shell key-1",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty public-key`, keyLine.ToString())
+}
+
 func TestToString(t *testing.T) {
 	testCases := []struct {
 		desc           string
@@ -95,6 +126,70 @@ func TestToString(t *testing.T) {
 			},
 			expectedOutput: `command="SSL_CERT_DIR=/tmp/certs /tmp/bin/gitlab-shell key-1",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty public-key`,
 		},
+		{
+			desc: "Without an id",
+			keyLine: &KeyLine{
+				Value:  "ssh-ed25519 public-key",
+				Prefix: "anonymous",
+				Config: &config.Config{RootDir: "/tmp"},
+			},
+			expectedOutput: `command="/tmp/bin/gitlab-shell anonymous",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-ed25519 public-key`,
+		},
+		{
+			desc: "With allowed commands",
+			keyLine: &KeyLine{
+				Id:              "1",
+				Value:           "public-key",
+				Prefix:          "key",
+				Config:          &config.Config{RootDir: "/tmp"},
+				AllowedCommands: []string{"git-lfs-authenticate", "git-upload-archive"},
+			},
+			expectedOutput: `command="/tmp/bin/gitlab-shell key-1 allowed-commands=git-lfs-authenticate,git-upload-archive",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty public-key`,
+		},
+		{
+			desc: "With a command path and environment",
+			keyLine: &KeyLine{
+				Id:     "1",
+				Value:  "public-key",
+				Prefix: "key",
+				Config: &config.Config{
+					RootDir:    "/tmp",
+					SslCertDir: "/tmp/my certs",
+					KeyLines: config.KeyLinesConfig{
+						CommandPath: "/opt/gitlab-shell/bin/gitlab-shell",
+						Env:         map[string]string{"SSL_CERT_FILE": "/etc/cert.pem", "GITLAB_SHELL_DIR": "/opt/gitlab-shell"},
+					},
+				},
+			},
+			expectedOutput: `command="SSL_CERT_DIR='/tmp/my certs' GITLAB_SHELL_DIR=/opt/gitlab-shell SSL_CERT_FILE=/etc/cert.pem /opt/gitlab-shell/bin/gitlab-shell key-1",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty public-key`,
+		},
+		{
+			desc: "With a principal and a quoted command path",
+			keyLine: &KeyLine{
+				Id:     "alex",
+				Value:  "alex@example.com",
+				Prefix: "username",
+				Config: &config.Config{
+					RootDir:  "/tmp",
+					KeyLines: config.KeyLinesConfig{CommandPath: `/opt/it's "$HOME"/gitlab-shell`},
+				},
+			},
+			expectedOutput: `command="'/opt/it'\''s \"$HOME\"/gitlab-shell' username-alex",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty alex@example.com`,
+		},
+		{
+			desc: "With a backslash before a double quote",
+			keyLine: &KeyLine{
+				Id:     "1",
+				Value:  "public-key",
+				Prefix: "key",
+				Config: &config.Config{
+					RootDir:  "/tmp",
+					KeyLines: config.KeyLinesConfig{Env: map[string]string{"GITLAB_SHELL_DIR": `/opt/a\"b`}},
+				},
+			},
+			// sshd only unescapes \" so the backslash is kept
+			expectedOutput: `command="GITLAB_SHELL_DIR='/opt/a\\"b' /tmp/bin/gitlab-shell key-1",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty public-key`,
+		},
 	}
 
 	for _, tc := range testCases {
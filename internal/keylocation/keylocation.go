@@ -0,0 +1,115 @@
+package keylocation
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/statefile"
+)
+
+const (
+	stateFile = "key-locations.json"
+)
+
+var (
+	// now is overridden in tests
+	now = time.Now
+)
+
+// Tracker remembers the network prefixes each SSH key was used from. To keep
+// the state file small, only the most recently seen prefixes and keys are
+// kept.
+type Tracker struct {
+	Dir    string
+	Config config.KeyLocationAlertsConfig
+}
+
+type key struct {
+	LastSeen time.Time            `json:"last_seen"`
+	Prefixes map[string]time.Time `json:"prefixes"`
+}
+
+// Record notes that keyId was used from ip. It returns the prefix of ip and
+// whether the key was used before but never from that prefix. The first use
+// of a key isn't reported, there's nothing to compare it to.
+func (t *Tracker) Record(keyId, ip string) (string, bool, error) {
+	prefix, err := t.Prefix(ip)
+	if err != nil {
+		return "", false, err
+	}
+
+	keys := map[string]*key{}
+	isNew := false
+
+	err = statefile.Update(t.filename(), &keys, func() error {
+		current := now()
+
+		k, ok := keys[keyId]
+		if !ok {
+			k = &key{Prefixes: map[string]time.Time{}}
+			keys[keyId] = k
+		} else if _, seen := k.Prefixes[prefix]; !seen {
+			isNew = true
+		}
+
+		k.LastSeen = current
+		k.Prefixes[prefix] = current
+
+		for len(k.Prefixes) > t.Config.MaxPrefixesPerKey {
+			delete(k.Prefixes, oldestPrefix(k.Prefixes))
+		}
+
+		for len(keys) > t.Config.MaxKeys {
+			delete(keys, oldestKey(keys))
+		}
+
+		return nil
+	})
+
+	return prefix, isNew, err
+}
+
+// Prefix returns the network ip belongs to, e.g. 192.0.2.0/24
+func (t *Tracker) Prefix(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("Invalid IP address: %q", ip)
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		mask := net.CIDRMask(t.Config.IPv4PrefixLength, 32)
+		return (&net.IPNet{IP: v4.Mask(mask), Mask: mask}).String(), nil
+	}
+
+	mask := net.CIDRMask(t.Config.IPv6PrefixLength, 128)
+	return (&net.IPNet{IP: parsed.Mask(mask), Mask: mask}).String(), nil
+}
+
+func (t *Tracker) filename() string {
+	return filepath.Join(t.Dir, stateFile)
+}
+
+func oldestPrefix(prefixes map[string]time.Time) string {
+	var oldest string
+	for prefix, seen := range prefixes {
+		if oldest == "" || seen.Before(prefixes[oldest]) {
+			oldest = prefix
+		}
+	}
+
+	return oldest
+}
+
+func oldestKey(keys map[string]*key) string {
+	var oldest string
+	for id, k := range keys {
+		if oldest == "" || k.LastSeen.Before(keys[oldest].LastSeen) {
+			oldest = id
+		}
+	}
+
+	return oldest
+}
@@ -0,0 +1,95 @@
+package keylocation
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+var (
+	defaultConfig = config.KeyLocationAlertsConfig{
+		Enabled:           true,
+		IPv4PrefixLength:  24,
+		IPv6PrefixLength:  48,
+		MaxPrefixesPerKey: 2,
+		MaxKeys:           2,
+	}
+)
+
+func setup(t *testing.T) (*Tracker, func(time.Duration), func()) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-keylocation")
+	require.NoError(t, err)
+
+	current := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	advance := func(d time.Duration) { current = current.Add(d) }
+
+	cleanup := func() {
+		now = time.Now
+		os.RemoveAll(dir)
+	}
+
+	return &Tracker{Dir: dir, Config: defaultConfig}, advance, cleanup
+}
+
+func TestRecord(t *testing.T) {
+	tracker, advance, cleanup := setup(t)
+	defer cleanup()
+
+	steps := []struct {
+		keyId          string
+		ip             string
+		expectedPrefix string
+		expectedNew    bool
+	}{
+		{keyId: "1", ip: "192.0.2.10", expectedPrefix: "192.0.2.0/24", expectedNew: false},
+		{keyId: "1", ip: "192.0.2.200", expectedPrefix: "192.0.2.0/24", expectedNew: false},
+		{keyId: "1", ip: "198.51.100.7", expectedPrefix: "198.51.100.0/24", expectedNew: true},
+		{keyId: "1", ip: "2001:db8:1234:5678::1", expectedPrefix: "2001:db8:1234::/48", expectedNew: true},
+		// Only two prefixes are kept per key, the oldest one was forgotten
+		{keyId: "1", ip: "192.0.2.10", expectedPrefix: "192.0.2.0/24", expectedNew: true},
+		{keyId: "2", ip: "192.0.2.10", expectedPrefix: "192.0.2.0/24", expectedNew: false},
+		{keyId: "3", ip: "192.0.2.10", expectedPrefix: "192.0.2.0/24", expectedNew: false},
+		// Only two keys are kept, key 1 was used the longest time ago
+		{keyId: "1", ip: "203.0.113.1", expectedPrefix: "203.0.113.0/24", expectedNew: false},
+		{keyId: "3", ip: "203.0.113.1", expectedPrefix: "203.0.113.0/24", expectedNew: true},
+	}
+
+	for _, step := range steps {
+		advance(time.Minute)
+
+		prefix, isNew, err := tracker.Record(step.keyId, step.ip)
+		require.NoError(t, err)
+		require.Equal(t, step.expectedPrefix, prefix, "key %s from %s", step.keyId, step.ip)
+		require.Equal(t, step.expectedNew, isNew, "key %s from %s", step.keyId, step.ip)
+	}
+}
+
+func TestRecordInvalidAddress(t *testing.T) {
+	tracker, _, cleanup := setup(t)
+	defer cleanup()
+
+	_, _, err := tracker.Record("1", "")
+	require.EqualError(t, err, `Invalid IP address: ""`)
+}
+
+func TestPrefix(t *testing.T) {
+	tracker := &Tracker{Config: config.KeyLocationAlertsConfig{IPv4PrefixLength: 16, IPv6PrefixLength: 64}}
+
+	prefix, err := tracker.Prefix("192.0.2.10")
+	require.NoError(t, err)
+	require.Equal(t, "192.0.0.0/16", prefix)
+
+	prefix, err = tracker.Prefix("2001:db8:1234:5678:9abc::1")
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8:1234:5678::/64", prefix)
+
+	prefix, err = tracker.Prefix("::ffff:192.0.2.10")
+	require.NoError(t, err)
+	require.Equal(t, "192.0.0.0/16", prefix)
+}
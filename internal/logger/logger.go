@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/internal/pseudonym"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -41,13 +42,38 @@ func Configure(cfg *config.Config) error {
 		return err
 	}
 
+	formatter, err := buildFormatter(cfg)
+	if err != nil {
+		// Logging in clear text would defeat the purpose of pseudonymization
+		output.Close()
+		setupBootstrapLogger()
+		logPrint("Unable to configure log pseudonymization", err)
+		return err
+	}
+
 	logWriter = output
 	log.SetOutput(logWriter)
+	log.SetFormatter(formatter)
+
+	return nil
+}
+
+func buildFormatter(cfg *config.Config) (log.Formatter, error) {
+	var formatter log.Formatter = &log.TextFormatter{}
 	if cfg.LogFormat == "json" {
-		log.SetFormatter(&log.JSONFormatter{})
+		formatter = &log.JSONFormatter{}
 	}
 
-	return nil
+	if !cfg.LogPseudonymization.Enabled {
+		return formatter, nil
+	}
+
+	pseudonymizer, err := pseudonym.New(cfg.LogPseudonymization)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pseudonym.Formatter{Formatter: formatter, Pseudonymizer: pseudonymizer}, nil
 }
 
 // If our log file is not available we want to log somewhere else, but
@@ -36,6 +36,40 @@ func TestConfigure(t *testing.T) {
 	require.True(t, strings.Contains(string(data), `msg":"this is a test"`))
 }
 
+func TestConfigurePseudonymization(t *testing.T) {
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "logtest-")
+	require.NoError(t, err)
+	defer tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	saltFile := tmpFile.Name() + ".salt"
+	defer os.Remove(saltFile)
+
+	config := config.Config{
+		LogFile:   tmpFile.Name(),
+		LogFormat: "json",
+		LogPseudonymization: config.LogPseudonymizationConfig{
+			Enabled:          true,
+			SaltFile:         saltFile,
+			RotationDays:     30,
+			IPv4PrefixLength: 24,
+			IPv6PrefixLength: 48,
+		},
+	}
+
+	err = Configure(&config)
+	require.NoError(t, err)
+	defer log.SetFormatter(&log.TextFormatter{})
+
+	log.WithFields(log.Fields{"username": "jane-doe", "remote_ip": "192.0.2.123"}).Info("this is a test")
+
+	data, err := ioutil.ReadFile(tmpFile.Name())
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "jane-doe")
+	require.Contains(t, string(data), `"remote_ip":"192.0.2.0/24"`)
+	require.Regexp(t, `"username":"p\d+-[0-9a-f]{16}"`, string(data))
+}
+
 func TestElapsedTimeMs(t *testing.T) {
 	testCases := []struct {
 		delta    float64
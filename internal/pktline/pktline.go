@@ -14,6 +14,10 @@ import (
 const (
 	maxPktSize = 0xffff
 	pktDelim   = "0001"
+	pktFlush   = "0000"
+
+	// MaxPayloadSize is the largest payload fitting in a packet
+	MaxPayloadSize = maxPktSize - 4
 )
 
 // NewScanner returns a bufio.Scanner that splits on Git pktline boundaries
@@ -34,6 +38,64 @@ func PktDone() []byte {
 	return []byte("0009done\n")
 }
 
+// PktFlush returns the bytes for a flush packet.
+func PktFlush() []byte {
+	return []byte(pktFlush)
+}
+
+// IsFlush detects the flush packet '0000'
+func IsFlush(pkt []byte) bool {
+	return bytes.Equal(pkt, []byte(pktFlush))
+}
+
+// Encode returns the packet carrying payload
+func Encode(payload []byte) []byte {
+	return append([]byte(fmt.Sprintf("%04x", len(payload)+4)), payload...)
+}
+
+// Payload returns the data of pkt without the length prefix
+func Payload(pkt []byte) []byte {
+	if len(pkt) < 4 {
+		return nil
+	}
+
+	return pkt[4:]
+}
+
+// Split returns the first packet of data, or nil when data doesn't hold a
+// complete packet yet.
+func Split(data []byte) ([]byte, error) {
+	_, pkt, err := pktLineSplitter(data, false)
+
+	return pkt, err
+}
+
+// Read reads a single packet from r without reading past it, so the data
+// following the packets, e.g. a packfile, can still be read from r.
+func Read(r io.Reader) ([]byte, error) {
+	prefix := make([]byte, 4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+
+	pktLength, err := strconv.ParseUint(string(prefix), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("pktline: decode length: %v", err)
+	}
+
+	if pktLength < 4 {
+		return prefix, nil
+	}
+
+	pkt := make([]byte, pktLength)
+	copy(pkt, prefix)
+	if _, err := io.ReadFull(r, pkt[4:]); err != nil {
+		return nil, err
+	}
+
+	return pkt, nil
+}
+
 func pktLineSplitter(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if len(data) < 4 {
 		if atEOF && len(data) > 0 {
@@ -1,6 +1,7 @@
 package pktline
 
 import (
+	"io/ioutil"
 	"strings"
 	"testing"
 
@@ -85,3 +86,55 @@ func TestIsDone(t *testing.T) {
 		})
 	}
 }
+
+func TestEncode(t *testing.T) {
+	require.Equal(t, []byte("0010hello world!"), Encode([]byte("hello world!")))
+	require.Equal(t, []byte("0004"), Encode(nil))
+}
+
+func TestSplit(t *testing.T) {
+	testCases := []struct {
+		desc string
+		in   string
+		out  []byte
+		fail bool
+	}{
+		{desc: "complete packet", in: "0010hello world!0000", out: []byte("0010hello world!")},
+		{desc: "flush packet", in: "00000010hello world!", out: []byte("0000")},
+		{desc: "incomplete packet", in: "0010hello", out: nil},
+		{desc: "incomplete prefix", in: "00", out: nil},
+		{desc: "invalid prefix", in: "zzzz", fail: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			pkt, err := Split([]byte(tc.in))
+			if tc.fail {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.out, pkt)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	r := strings.NewReader("0010hello world!0000PACK")
+
+	pkt, err := Read(r)
+	require.NoError(t, err)
+	require.Equal(t, []byte("0010hello world!"), pkt)
+	require.Equal(t, []byte("hello world!"), Payload(pkt))
+
+	pkt, err = Read(r)
+	require.NoError(t, err)
+	require.True(t, IsFlush(pkt))
+
+	rest, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "PACK", string(rest))
+
+	_, err = Read(strings.NewReader("0010hello"))
+	require.Error(t, err)
+}
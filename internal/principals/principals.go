@@ -0,0 +1,106 @@
+package principals
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+// IssuedPrefix starts the principals of the certificates gitlab-shell issues,
+// followed by the GitLab username. They aren't rewritten by the rules, so the
+// certificates can be used whatever rules are configured.
+const IssuedPrefix = "gitlab-shell:"
+
+type rule struct {
+	regexp  *regexp.Regexp
+	replace string
+}
+
+// Mapper rewrites the principals of an SSH certificate into GitLab
+// usernames. Rules are tried in order and the first matching rule wins.
+// Principals that no rule matches are dropped. Without rules, principals are
+// used as given.
+type Mapper struct {
+	rules []rule
+}
+
+// Mapping is the outcome of mapping a single principal. Rule is the 1-based
+// index of the rule that matched, or 0 when no rules are configured or the
+// principal was issued by gitlab-shell.
+type Mapping struct {
+	Principal string
+	Rule      int
+	Dropped   bool
+	Issued    bool
+}
+
+func NewMapper(rules []config.PrincipalRule) (*Mapper, error) {
+	mapper := &Mapper{}
+
+	for i, r := range rules {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid principal rule %d: %v", i+1, err)
+		}
+
+		mapper.rules = append(mapper.rules, rule{regexp: re, replace: r.Replace})
+	}
+
+	return mapper, nil
+}
+
+func (m *Mapper) Map(principal string) *Mapping {
+	if strings.HasPrefix(principal, IssuedPrefix) {
+		username := strings.TrimPrefix(principal, IssuedPrefix)
+
+		return &Mapping{Principal: username, Dropped: username == "", Issued: true}
+	}
+
+	if len(m.rules) == 0 {
+		return &Mapping{Principal: principal}
+	}
+
+	for i, r := range m.rules {
+		if !r.regexp.MatchString(principal) {
+			continue
+		}
+
+		mapped := r.regexp.ReplaceAllString(principal, r.replace)
+
+		return &Mapping{Principal: mapped, Rule: i + 1, Dropped: mapped == ""}
+	}
+
+	return &Mapping{Dropped: true}
+}
+
+// MappedPrincipal is a principal along with the GitLab username it maps to
+type MappedPrincipal struct {
+	Principal string
+	Username  string
+}
+
+// MapAll returns the principals that aren't dropped in their original order,
+// without duplicates.
+func (m *Mapper) MapAll(principals []string) []*MappedPrincipal {
+	var result []*MappedPrincipal
+	seen := make(map[string]bool)
+
+	for _, principal := range principals {
+		mapping := m.Map(principal)
+		if mapping.Dropped || seen[principal] {
+			continue
+		}
+
+		seen[principal] = true
+		result = append(result, &MappedPrincipal{Principal: principal, Username: mapping.Principal})
+	}
+
+	return result
+}
+
+// HasRules tells whether principals are rewritten at all
+func (m *Mapper) HasRules() bool {
+	return len(m.rules) > 0
+}
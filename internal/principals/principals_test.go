@@ -0,0 +1,119 @@
+package principals
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+var (
+	corpRules = []config.PrincipalRule{
+		{Match: `\A([a-z0-9_.-]+)@corp\.example\z`, Replace: "$1"},
+		{Match: `\Aeng:([a-z0-9_.-]+)\z`, Replace: "eng-$1"},
+		{Match: `\Aservice:`, Replace: ""},
+		{Match: `\A[a-z0-9_.-]+\z`, Replace: "$0"},
+	}
+)
+
+func TestMap(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		rules     []config.PrincipalRule
+		principal string
+		expected  *Mapping
+	}{
+		{
+			desc:      "Without rules",
+			principal: "jdoe@corp.example",
+			expected:  &Mapping{Principal: "jdoe@corp.example"},
+		},
+		{
+			desc:      "With a stripped domain",
+			rules:     corpRules,
+			principal: "jdoe@corp.example",
+			expected:  &Mapping{Principal: "jdoe", Rule: 1},
+		},
+		{
+			desc:      "With a mapped prefix",
+			rules:     corpRules,
+			principal: "eng:jdoe",
+			expected:  &Mapping{Principal: "eng-jdoe", Rule: 2},
+		},
+		{
+			desc:      "With a rule producing an empty principal",
+			rules:     corpRules,
+			principal: "service:",
+			expected:  &Mapping{Rule: 3, Dropped: true},
+		},
+		{
+			desc:      "With a plain username",
+			rules:     corpRules,
+			principal: "jdoe",
+			expected:  &Mapping{Principal: "jdoe", Rule: 4},
+		},
+		{
+			desc:      "With a principal issued by gitlab-shell",
+			rules:     corpRules,
+			principal: "gitlab-shell:jdoe",
+			expected:  &Mapping{Principal: "jdoe", Issued: true},
+		},
+		{
+			desc:      "With a principal issued by gitlab-shell without rules",
+			principal: "gitlab-shell:jdoe",
+			expected:  &Mapping{Principal: "jdoe", Issued: true},
+		},
+		{
+			desc:      "With a principal issued by gitlab-shell without a username",
+			rules:     corpRules,
+			principal: "gitlab-shell:",
+			expected:  &Mapping{Dropped: true, Issued: true},
+		},
+		{
+			desc:      "With another domain",
+			rules:     corpRules,
+			principal: "jdoe@other.example",
+			expected:  &Mapping{Dropped: true},
+		},
+		{
+			desc:      "With an unknown prefix",
+			rules:     corpRules,
+			principal: "ops:jdoe",
+			expected:  &Mapping{Dropped: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			mapper, err := NewMapper(tc.rules)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, mapper.Map(tc.principal))
+		})
+	}
+}
+
+func TestMapAll(t *testing.T) {
+	mapper, err := NewMapper(corpRules)
+	require.NoError(t, err)
+
+	principals := []string{"jdoe@corp.example", "ops:jdoe", "jdoe", "eng:jdoe", "service:", "jdoe"}
+
+	require.Equal(t, []*MappedPrincipal{
+		{Principal: "jdoe@corp.example", Username: "jdoe"},
+		{Principal: "jdoe", Username: "jdoe"},
+		{Principal: "eng:jdoe", Username: "eng-jdoe"},
+	}, mapper.MapAll(principals))
+	require.True(t, mapper.HasRules())
+
+	mapper, err = NewMapper(nil)
+	require.NoError(t, err)
+	require.False(t, mapper.HasRules())
+}
+
+func TestInvalidRule(t *testing.T) {
+	_, err := NewMapper([]config.PrincipalRule{{Match: "valid"}, {Match: "(invalid"}})
+
+	require.EqualError(t, err, "Invalid principal rule 2: error parsing regexp: missing closing ): `(invalid`")
+}
@@ -0,0 +1,57 @@
+package projectid
+
+import (
+	"regexp"
+)
+
+const (
+	pathPrefix = "project-id/"
+	wikiSuffix = ".wiki"
+)
+
+var (
+	// e.g. project-id/1234.git or /project-id/1234.wiki.git
+	pathRegex = regexp.MustCompile(`\A/?project-id/([1-9][0-9]*)(\.wiki)?(\.git)?/?\z`)
+
+	// GitLab identifies repositories as project-1234 or wiki-1234
+	glRepositoryRegex = regexp.MustCompile(`\A(project|wiki)-([1-9][0-9]*)\z`)
+)
+
+// Ref is a repository addressed by the ID of its project, which doesn't
+// change when the project is renamed or transferred.
+type Ref struct {
+	Id   string
+	Wiki bool
+}
+
+// Parse returns the reference of a project-id/<id>[.wiki][.git] path, or nil
+// for other paths.
+func Parse(repo string) *Ref {
+	match := pathRegex.FindStringSubmatch(repo)
+	if match == nil {
+		return nil
+	}
+
+	return &Ref{Id: match[1], Wiki: match[2] != ""}
+}
+
+// FromGlRepository returns the reference of a gl_repository, or nil when it
+// doesn't belong to a project.
+func FromGlRepository(glRepository string) *Ref {
+	match := glRepositoryRegex.FindStringSubmatch(glRepository)
+	if match == nil {
+		return nil
+	}
+
+	return &Ref{Id: match[2], Wiki: match[1] == "wiki"}
+}
+
+// Path returns the repository path without the .git suffix
+func (r *Ref) Path() string {
+	path := pathPrefix + r.Id
+	if r.Wiki {
+		path += wikiSuffix
+	}
+
+	return path
+}
@@ -0,0 +1,48 @@
+package projectid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		repo        string
+		expectedRef *Ref
+	}{
+		{repo: "project-id/1234", expectedRef: &Ref{Id: "1234"}},
+		{repo: "project-id/1234.git", expectedRef: &Ref{Id: "1234"}},
+		{repo: "/project-id/1234.git", expectedRef: &Ref{Id: "1234"}},
+		{repo: "project-id/1234.git/", expectedRef: &Ref{Id: "1234"}},
+		{repo: "project-id/1234.wiki", expectedRef: &Ref{Id: "1234", Wiki: true}},
+		{repo: "project-id/1234.wiki.git", expectedRef: &Ref{Id: "1234", Wiki: true}},
+		{repo: "group/project.git"},
+		{repo: "project-id/group/project.git"},
+		{repo: "project-id/0123.git"},
+		{repo: "project-id/12a.git"},
+		{repo: "project-id/.git"},
+		{repo: "group/project-id/1234.git"},
+		{repo: "project-id/1234.git.wiki"},
+		{repo: "project-id/1234\n.git"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.repo, func(t *testing.T) {
+			require.Equal(t, tc.expectedRef, Parse(tc.repo))
+		})
+	}
+}
+
+func TestFromGlRepository(t *testing.T) {
+	require.Equal(t, &Ref{Id: "1234"}, FromGlRepository("project-1234"))
+	require.Equal(t, &Ref{Id: "1234", Wiki: true}, FromGlRepository("wiki-1234"))
+	require.Nil(t, FromGlRepository("group-1234"))
+	require.Nil(t, FromGlRepository("snippet-1234"))
+	require.Nil(t, FromGlRepository(""))
+}
+
+func TestPath(t *testing.T) {
+	require.Equal(t, "project-id/1234", (&Ref{Id: "1234"}).Path())
+	require.Equal(t, "project-id/1234.wiki", (&Ref{Id: "1234", Wiki: true}).Path())
+}
@@ -0,0 +1,180 @@
+package pseudonym
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// Fields identifying users. The names are kept so log parsers keep
+	// working, only the values are replaced.
+	identityFields = []string{"username", "gl_username", "user_id", "gl_id", "gl_key_id", "grantee", "fingerprint"}
+
+	ipFields = []string{"remote_ip", "ip_prefix"}
+
+	// Fields holding URLs of the internal API, whose query strings identify
+	// users
+	urlFields = []string{"url"}
+
+	// Query parameters replaced like the identity field they hold, so their
+	// pseudonyms match. The values of other parameters are replaced like
+	// the URL field.
+	queryFields = map[string]string{"key_id": "gl_key_id", "username": "username", "user_id": "user_id"}
+
+	// Fields holding an identity denials are counted for: key-<id>,
+	// username-<username> or ip-<address>. Each part is replaced like the
+	// field it comes from, so pseudonyms of gl_key_id, username and remote_ip
+	// are used to look them up.
+	denialIdentityFields = []string{"identity"}
+)
+
+// IsPseudonymized reports whether the values of field are replaced by
+// pseudonyms.
+func IsPseudonymized(field string) bool {
+	fields := append(append(append([]string{}, identityFields...), ipFields...), urlFields...)
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Formatter pseudonymizes the fields of log entries before handing them to
+// the wrapped formatter.
+type Formatter struct {
+	Formatter     log.Formatter
+	Pseudonymizer *Pseudonymizer
+}
+
+func (f *Formatter) Format(entry *log.Entry) ([]byte, error) {
+	data := make(log.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+
+	for _, field := range identityFields {
+		if value, ok := stringValue(data, field); ok {
+			data[field] = f.Pseudonymizer.Pseudonym(field, value, entry.Time)
+		}
+	}
+
+	for _, field := range ipFields {
+		if value, ok := stringValue(data, field); ok {
+			data[field] = f.truncateIp(field, value, entry)
+		}
+	}
+
+	for _, field := range urlFields {
+		if value, ok := stringValue(data, field); ok {
+			data[field] = f.pseudonymizeUrl(field, value, entry)
+		}
+	}
+
+	for _, field := range denialIdentityFields {
+		if value, ok := stringValue(data, field); ok {
+			data[field] = f.pseudonymizeDenialIdentity(field, value, entry)
+		}
+	}
+
+	pseudonymized := *entry
+	pseudonymized.Data = data
+
+	return f.Formatter.Format(&pseudonymized)
+}
+
+// IP addresses are truncated to their network, as are networks narrower than
+// it. Addresses that can't be parsed are hashed so they can't leak either.
+func (f *Formatter) truncateIp(field, value string, entry *log.Entry) string {
+	ip := net.ParseIP(value)
+	prefixLength := -1
+	if ip == nil {
+		if _, network, err := net.ParseCIDR(value); err == nil {
+			ip = network.IP
+			prefixLength, _ = network.Mask.Size()
+		}
+	}
+
+	if ip == nil {
+		return f.Pseudonymizer.Pseudonym(field, value, entry.Time)
+	}
+
+	cfg := f.Pseudonymizer.Config
+	if v4 := ip.To4(); v4 != nil {
+		mask := net.CIDRMask(shortestPrefix(cfg.IPv4PrefixLength, prefixLength), 32)
+		return (&net.IPNet{IP: v4.Mask(mask), Mask: mask}).String()
+	}
+
+	mask := net.CIDRMask(shortestPrefix(cfg.IPv6PrefixLength, prefixLength), 128)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+func shortestPrefix(configured, given int) int {
+	if given >= 0 && given < configured {
+		return given
+	}
+
+	return configured
+}
+
+// The query values of URLs are replaced, the rest is kept to tell the
+// requests apart.
+func (f *Formatter) pseudonymizeUrl(field, value string, entry *log.Entry) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		return f.Pseudonymizer.Pseudonym(field, value, entry.Time)
+	}
+
+	u.User = nil
+	if u.RawQuery == "" {
+		return u.String()
+	}
+
+	query := u.Query()
+	for name, values := range query {
+		valueField, ok := queryFields[name]
+		if !ok {
+			valueField = field
+		}
+
+		for i, v := range values {
+			values[i] = f.Pseudonymizer.Pseudonym(valueField, v, entry.Time)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func (f *Formatter) pseudonymizeDenialIdentity(field, value string, entry *log.Entry) string {
+	switch {
+	case strings.HasPrefix(value, "key-"):
+		return "key-" + f.Pseudonymizer.Pseudonym("gl_key_id", strings.TrimPrefix(value, "key-"), entry.Time)
+	case strings.HasPrefix(value, "username-"):
+		return "username-" + f.Pseudonymizer.Pseudonym("username", strings.TrimPrefix(value, "username-"), entry.Time)
+	case strings.HasPrefix(value, "ip-"):
+		return "ip-" + f.truncateIp("remote_ip", strings.TrimPrefix(value, "ip-"), entry)
+	default:
+		return f.Pseudonymizer.Pseudonym(field, value, entry.Time)
+	}
+}
+
+// Empty values are kept, they don't identify anyone.
+func stringValue(data log.Fields, field string) (string, bool) {
+	value, ok := data[field]
+	if !ok || value == nil {
+		return "", false
+	}
+
+	s := fmt.Sprint(value)
+	if s == "" || s == "0" {
+		return "", false
+	}
+
+	return s, true
+}
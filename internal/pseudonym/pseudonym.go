@@ -0,0 +1,138 @@
+package pseudonym
+
+// Pseudonyms replace user identifiers in the logs. They are keyed hashes, so
+// the same user gets the same pseudonym within a rotation period and log
+// entries can still be correlated, but only someone holding the salt can tell
+// which user a pseudonym belongs to.
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+const (
+	saltSize    = 32
+	minSaltSize = 16
+
+	// Long enough to make collisions between users unlikely
+	hashLength = 16
+)
+
+var (
+	pseudonymRegex = regexp.MustCompile(`\Ap(\d+)-[0-9a-f]+\z`)
+
+	InvalidPseudonymError = errors.New("Invalid pseudonym")
+)
+
+type Pseudonymizer struct {
+	Salt   []byte
+	Config config.LogPseudonymizationConfig
+}
+
+func New(cfg config.LogPseudonymizationConfig) (*Pseudonymizer, error) {
+	salt, err := LoadSalt(cfg.SaltFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pseudonymizer{Salt: salt, Config: cfg}, nil
+}
+
+// LoadSalt reads the salt from filename, generating it on first use.
+func LoadSalt(filename string) ([]byte, error) {
+	salt, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return createSalt(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(salt) < minSaltSize {
+		return nil, fmt.Errorf("The salt in %s is shorter than %d bytes", filename, minSaltSize)
+	}
+
+	return salt, nil
+}
+
+func createSalt(filename string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		// Another process created it first
+		return LoadSalt(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(salt); err != nil {
+		return nil, err
+	}
+
+	return salt, nil
+}
+
+// Period is the number of the rotation period t falls in.
+func (p *Pseudonymizer) Period(t time.Time) int64 {
+	return t.Unix() / int64(p.Config.RotationDays*24*60*60)
+}
+
+// Pseudonym returns the pseudonym of the value of field at time t, e.g.
+// p689-0f3b6c2ad9e14b7a. The rotation period is part of the pseudonym so it
+// can be mapped back without knowing when it was logged.
+func (p *Pseudonymizer) Pseudonym(field, value string, t time.Time) string {
+	return p.pseudonym(p.Period(t), field, value)
+}
+
+func (p *Pseudonymizer) pseudonym(period int64, field, value string) string {
+	mac := hmac.New(sha256.New, p.periodKey(period))
+	mac.Write([]byte(field + "\x00" + value))
+
+	return fmt.Sprintf("p%d-%s", period, hex.EncodeToString(mac.Sum(nil))[:hashLength])
+}
+
+func (p *Pseudonymizer) periodKey(period int64) []byte {
+	mac := hmac.New(sha256.New, p.Salt)
+	mac.Write([]byte("period " + strconv.FormatInt(period, 10)))
+
+	return mac.Sum(nil)
+}
+
+// Matches reports whether pseudonym was produced for the value of field.
+func (p *Pseudonymizer) Matches(pseudonym, field, value string) (bool, error) {
+	match := pseudonymRegex.FindStringSubmatch(pseudonym)
+	if match == nil {
+		return false, InvalidPseudonymError
+	}
+
+	period, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return false, InvalidPseudonymError
+	}
+
+	expected := p.pseudonym(period, field, value)
+
+	return hmac.Equal([]byte(expected), []byte(pseudonym)), nil
+}
@@ -0,0 +1,77 @@
+package pseudonym
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/config"
+)
+
+func newPseudonymizer() *Pseudonymizer {
+	return &Pseudonymizer{
+		Salt:   []byte("0123456789abcdef0123456789abcdef"),
+		Config: config.LogPseudonymizationConfig{RotationDays: 30, IPv4PrefixLength: 24, IPv6PrefixLength: 48},
+	}
+}
+
+func TestPseudonym(t *testing.T) {
+	p := newPseudonymizer()
+	at := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	pseudonym := p.Pseudonym("username", "jane-doe", at)
+	require.Regexp(t, `\Ap613-[0-9a-f]{16}\z`, pseudonym)
+
+	require.Equal(t, pseudonym, p.Pseudonym("username", "jane-doe", at.Add(24*time.Hour)))
+	require.NotEqual(t, pseudonym, p.Pseudonym("username", "john-doe", at))
+	require.NotEqual(t, pseudonym, p.Pseudonym("gl_username", "jane-doe", at))
+	require.NotEqual(t, pseudonym, p.Pseudonym("username", "jane-doe", at.Add(30*24*time.Hour)))
+
+	other := newPseudonymizer()
+	other.Salt = []byte("another salt, another pseudonym")
+	require.NotEqual(t, pseudonym, other.Pseudonym("username", "jane-doe", at))
+}
+
+func TestMatches(t *testing.T) {
+	p := newPseudonymizer()
+	pseudonym := p.Pseudonym("user_id", "user-1", time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	match, err := p.Matches(pseudonym, "user_id", "user-1")
+	require.NoError(t, err)
+	require.True(t, match)
+
+	match, err = p.Matches(pseudonym, "user_id", "user-2")
+	require.NoError(t, err)
+	require.False(t, match)
+
+	_, err = p.Matches("jane-doe", "user_id", "user-1")
+	require.Equal(t, InvalidPseudonymError, err)
+}
+
+func TestLoadSalt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pseudonym")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "salt")
+
+	salt, err := LoadSalt(filename)
+	require.NoError(t, err)
+	require.Len(t, salt, saltSize)
+
+	info, err := os.Stat(filename)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := LoadSalt(filename)
+	require.NoError(t, err)
+	require.Equal(t, salt, loaded)
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte("short"), 0600))
+	_, err = LoadSalt(filename)
+	require.EqualError(t, err, "The salt in "+filename+" is shorter than 16 bytes")
+}
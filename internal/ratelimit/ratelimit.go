@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"path/filepath"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/internal/statefile"
+)
+
+// Limiter is a fixed window rate limiter whose counters are shared by all
+// gitlab-shell processes through a state file.
+type Limiter struct {
+	Name   string
+	Dir    string
+	Limit  int
+	Window time.Duration
+}
+
+type window struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+var (
+	// now is overridden in tests
+	now = time.Now
+)
+
+// Allow records a request for key and reports whether it is within the
+// limit. A Limit of zero or less disables the limiter.
+func (l *Limiter) Allow(key string) (bool, error) {
+	if l.Limit <= 0 {
+		return true, nil
+	}
+
+	windows := map[string]*window{}
+	allowed := false
+
+	err := statefile.Update(l.filename(), &windows, func() error {
+		current := now()
+
+		for k, w := range windows {
+			if current.Sub(w.Start) >= l.Window {
+				delete(windows, k)
+			}
+		}
+
+		w, ok := windows[key]
+		if !ok {
+			w = &window{Start: current}
+			windows[key] = w
+		}
+
+		if w.Count < l.Limit {
+			w.Count++
+			allowed = true
+		}
+
+		return nil
+	})
+
+	return allowed, err
+}
+
+func (l *Limiter) filename() string {
+	return filepath.Join(l.Dir, "ratelimit-"+l.Name+".json")
+}
@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-ratelimit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	current := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	limiter := &Limiter{Name: "test", Dir: dir, Limit: 2, Window: time.Minute}
+
+	for _, expected := range []bool{true, true, false} {
+		allowed, err := limiter.Allow("127.0.0.1")
+		require.NoError(t, err)
+		require.Equal(t, expected, allowed)
+	}
+
+	allowed, err := limiter.Allow("127.0.0.2")
+	require.NoError(t, err)
+	require.True(t, allowed, "keys are limited separately")
+
+	current = current.Add(time.Minute)
+
+	allowed, err = limiter.Allow("127.0.0.1")
+	require.NoError(t, err)
+	require.True(t, allowed, "the limit is reset once the window has passed")
+}
+
+func TestAllowWithoutLimit(t *testing.T) {
+	limiter := &Limiter{Name: "test", Dir: "/non-existent"}
+
+	allowed, err := limiter.Allow("127.0.0.1")
+	require.NoError(t, err)
+	require.True(t, allowed)
+}
@@ -0,0 +1,123 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+const (
+	// Prefix marks encrypted values in config.yml
+	Prefix = "enc:x25519:"
+
+	keySize   = 32
+	nonceSize = 24
+)
+
+var (
+	// The errors never include the value, it may be partially decrypted
+	// or be pasted secrets
+	MalformedError = errors.New("the encrypted value is malformed")
+	DecryptError   = errors.New("the encrypted value can't be decrypted with the identity")
+)
+
+// Identity is the X25519 key pair values are encrypted to. Values are
+// sealed with an ephemeral key, so encrypting only needs the public key.
+type Identity struct {
+	privateKey [keySize]byte
+	publicKey  [keySize]byte
+}
+
+// IsEncrypted tells whether value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), Prefix)
+}
+
+// LoadIdentity reads the private key, 32 base64 encoded bytes, e.g. from
+// `openssl rand -base64 32`. The file must be a regular file only accessible
+// by the user gitlab-shell runs as.
+func LoadIdentity(filename string) (*Identity, error) {
+	info, err := os.Lstat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", filename)
+	}
+
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s must only be accessible by its owner", filename)
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return nil, fmt.Errorf("%s must be owned by the user gitlab-shell runs as", filename)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(privateKey) != keySize {
+		return nil, fmt.Errorf("%s must hold %d base64 encoded bytes", filename, keySize)
+	}
+
+	identity := &Identity{}
+	copy(identity.privateKey[:], privateKey)
+	curve25519.ScalarBaseMult(&identity.publicKey, &identity.privateKey)
+
+	return identity, nil
+}
+
+// Encrypt returns the value to put in config.yml for plaintext
+func (i *Identity) Encrypt(plaintext []byte) (string, error) {
+	ephemeralPublicKey, ephemeralPrivateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	var nonce [nonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "", err
+	}
+
+	sealed := append(ephemeralPublicKey[:], nonce[:]...)
+	sealed = box.Seal(sealed, plaintext, &nonce, &i.publicKey, ephemeralPrivateKey)
+
+	return Prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of a value returned by Encrypt
+func (i *Identity) Decrypt(value string) ([]byte, error) {
+	if !IsEncrypted(value) {
+		return nil, MalformedError
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(value), Prefix))
+	if err != nil || len(sealed) < keySize+nonceSize+box.Overhead {
+		return nil, MalformedError
+	}
+
+	var ephemeralPublicKey [keySize]byte
+	var nonce [nonceSize]byte
+	copy(ephemeralPublicKey[:], sealed[:keySize])
+	copy(nonce[:], sealed[keySize:keySize+nonceSize])
+
+	plaintext, ok := box.Open(nil, sealed[keySize+nonceSize:], &nonce, &ephemeralPublicKey, &i.privateKey)
+	if !ok {
+		return nil, DecryptError
+	}
+
+	return plaintext, nil
+}
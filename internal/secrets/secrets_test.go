@@ -0,0 +1,116 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeIdentity(t *testing.T, dir, name string, key []byte, perm os.FileMode) string {
+	filename := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(filename, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), perm))
+	require.NoError(t, os.Chmod(filename, perm))
+
+	return filename
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	identity, err := LoadIdentity(writeIdentity(t, dir, "identity", make([]byte, 32), 0600))
+	require.NoError(t, err)
+
+	encrypted, err := identity.Encrypt([]byte("s3cret"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(encrypted, Prefix))
+	require.NotContains(t, encrypted, "s3cret")
+	require.True(t, IsEncrypted(encrypted))
+
+	plaintext, err := identity.Decrypt(encrypted + "\n")
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", string(plaintext))
+
+	// Values are encrypted with a new ephemeral key each time
+	other, err := identity.Encrypt([]byte("s3cret"))
+	require.NoError(t, err)
+	require.NotEqual(t, encrypted, other)
+}
+
+func TestFailingDecrypt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	identity, err := LoadIdentity(writeIdentity(t, dir, "identity", make([]byte, 32), 0600))
+	require.NoError(t, err)
+
+	otherKey := make([]byte, 32)
+	otherKey[5] = 1
+	otherIdentity, err := LoadIdentity(writeIdentity(t, dir, "other", otherKey, 0600))
+	require.NoError(t, err)
+
+	encrypted, err := otherIdentity.Encrypt([]byte("s3cret"))
+	require.NoError(t, err)
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, Prefix))
+	require.NoError(t, err)
+	sealed[len(sealed)-1] ^= 1
+	tampered := Prefix + base64.StdEncoding.EncodeToString(sealed)
+
+	testCases := []struct {
+		desc          string
+		value         string
+		expectedError error
+	}{
+		{desc: "Without the prefix", value: "s3cret", expectedError: MalformedError},
+		{desc: "With invalid base64", value: Prefix + "not base64!", expectedError: MalformedError},
+		{desc: "Too short", value: Prefix + base64.StdEncoding.EncodeToString([]byte("short")), expectedError: MalformedError},
+		{desc: "For another identity", value: encrypted, expectedError: DecryptError},
+		{desc: "Tampered with", value: tampered, expectedError: DecryptError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			plaintext, err := identity.Decrypt(tc.value)
+			require.Equal(t, tc.expectedError, err)
+			require.Nil(t, plaintext)
+			require.NotContains(t, err.Error(), strings.TrimPrefix(tc.value, Prefix))
+		})
+	}
+}
+
+func TestFailingLoadIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	readable := writeIdentity(t, dir, "readable", make([]byte, 32), 0644)
+	short := writeIdentity(t, dir, "short", make([]byte, 16), 0600)
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(writeIdentity(t, dir, "identity", make([]byte, 32), 0600), link))
+
+	testCases := []struct {
+		filename      string
+		expectedError string
+	}{
+		{filename: readable, expectedError: readable + " must only be accessible by its owner"},
+		{filename: short, expectedError: short + " must hold 32 base64 encoded bytes"},
+		{filename: link, expectedError: link + " is not a regular file"},
+		{filename: filepath.Join(dir, "missing"), expectedError: "lstat " + filepath.Join(dir, "missing") + ": no such file or directory"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(filepath.Base(tc.filename), func(t *testing.T) {
+			identity, err := LoadIdentity(tc.filename)
+			require.Nil(t, identity)
+			require.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
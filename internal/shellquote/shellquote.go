@@ -0,0 +1,21 @@
+package shellquote
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// Words made of these characters need no quoting in a shell
+	safeRegex = regexp.MustCompile(`\A[A-Za-z0-9_@%+=:,./-]+\z`)
+)
+
+// Quote returns value as a single shell word, single quoted unless it's made
+// of safe characters only
+func Quote(value string) string {
+	if safeRegex.MatchString(value) {
+		return value
+	}
+
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
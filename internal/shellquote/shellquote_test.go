@@ -0,0 +1,32 @@
+package shellquote
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuote(t *testing.T) {
+	testCases := []struct {
+		value          string
+		expectedOutput string
+	}{
+		{value: "/opt/gitlab-shell", expectedOutput: "/opt/gitlab-shell"},
+		{value: "", expectedOutput: "''"},
+		{value: "/opt/gitlab shell", expectedOutput: "'/opt/gitlab shell'"},
+		{value: "it's", expectedOutput: `'it'\''s'`},
+		{value: "''", expectedOutput: `''\'''\'''`},
+		{value: "$(reboot)", expectedOutput: "'$(reboot)'"},
+		{value: "`reboot`; reboot", expectedOutput: "'`reboot`; reboot'"},
+		{value: `back\slash`, expectedOutput: `'back\slash'`},
+		{value: "*.pem", expectedOutput: "'*.pem'"},
+		{value: "~/certs", expectedOutput: "'~/certs'"},
+		{value: "/opt/é", expectedOutput: "'/opt/é'"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			require.Equal(t, tc.expectedOutput, Quote(tc.value))
+		})
+	}
+}
@@ -1,10 +1,20 @@
 package sshenv
 
 import (
+	"bufio"
+	"errors"
 	"os"
 	"strings"
 )
 
+const (
+	// sshd writes the methods the user authenticated with to the file named
+	// by this variable when ExposeAuthInfo is enabled
+	userAuthEnv = "SSH_USER_AUTH"
+
+	publicKeyMethod = "publickey"
+)
+
 func LocalAddr() string {
 	address := os.Getenv("SSH_CONNECTION")
 
@@ -13,3 +23,38 @@ func LocalAddr() string {
 	}
 	return ""
 }
+
+// AuthenticatedPublicKey returns the public key the user authenticated with,
+// in the authorized_keys format, e.g. "ssh-ed25519 AAAA...".
+func AuthenticatedPublicKey() (string, error) {
+	filename := os.Getenv(userAuthEnv)
+	if filename == "" {
+		return "", errors.New("The authenticated key isn't available, ExposeAuthInfo must be enabled in sshd_config")
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && fields[0] == publicKeyMethod {
+			keys = append(keys, fields[1]+" "+fields[2])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	// With several keys there's no telling which one is meant
+	if len(keys) != 1 {
+		return "", errors.New("Exactly one public key must have been used to authenticate")
+	}
+
+	return keys[0], nil
+}
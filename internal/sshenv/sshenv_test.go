@@ -1,6 +1,8 @@
 package sshenv
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -18,3 +20,62 @@ func TestLocalAddr(t *testing.T) {
 func TestEmptyLocalAddr(t *testing.T) {
 	require.Equal(t, LocalAddr(), "")
 }
+
+func TestAuthenticatedPublicKey(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		authInfo      string
+		expectedKey   string
+		expectedError string
+	}{
+		{
+			desc:        "With a public key",
+			authInfo:    "publickey ssh-ed25519 AAAAC3NzaC1lZDI1NTE5\n",
+			expectedKey: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5",
+		},
+		{
+			desc:        "With a public key and another method",
+			authInfo:    "publickey ssh-ed25519 AAAAC3NzaC1lZDI1NTE5\nkeyboard-interactive\n",
+			expectedKey: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5",
+		},
+		{
+			desc:          "With several public keys",
+			authInfo:      "publickey ssh-ed25519 AAAAC3NzaC1lZDI1NTE5\npublickey ssh-rsa AAAAB3NzaC1yc2E\n",
+			expectedError: "Exactly one public key must have been used to authenticate",
+		},
+		{
+			desc:          "Without public keys",
+			authInfo:      "password\n",
+			expectedError: "Exactly one public key must have been used to authenticate",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			file, err := ioutil.TempFile("", "auth-info")
+			require.NoError(t, err)
+			defer os.Remove(file.Name())
+
+			_, err = file.WriteString(tc.authInfo)
+			require.NoError(t, err)
+			require.NoError(t, file.Close())
+
+			cleanup, err := testhelper.Setenv("SSH_USER_AUTH", file.Name())
+			require.NoError(t, err)
+			defer cleanup()
+
+			key, err := AuthenticatedPublicKey()
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedKey, key)
+			}
+		})
+	}
+}
+
+func TestAuthenticatedPublicKeyWithoutAuthInfo(t *testing.T) {
+	_, err := AuthenticatedPublicKey()
+	require.EqualError(t, err, "The authenticated key isn't available, ExposeAuthInfo must be enabled in sshd_config")
+}
@@ -0,0 +1,103 @@
+package statefile
+
+// Small JSON documents shared between gitlab-shell processes. Every SSH
+// session runs in its own process, so anything that needs to be remembered
+// across sessions (rate limits, denial counters, ...) is kept on disk and
+// guarded with an advisory lock.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Update loads the JSON document stored at filename into v, calls fn and
+// writes v back. An exclusive lock is held on the file for the duration of
+// the call so concurrent processes don't lose each other's updates. A
+// missing or unreadable document leaves v untouched.
+func Update(filename string, v interface{}, fn func() error) error {
+	file, err := open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+
+	if err := load(file, v); err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	return store(file, v)
+}
+
+// Read loads the JSON document stored at filename into v while holding a
+// shared lock on the file.
+func Read(filename string, v interface{}) error {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_SH); err != nil {
+		return err
+	}
+
+	return load(file, v)
+}
+
+func open(filename string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0600)
+}
+
+func load(file *os.File, v interface{}) error {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	// The state is only ever a cache of recent activity, so a corrupted
+	// document is discarded rather than blocking every SSH session.
+	json.Unmarshal(data, v)
+
+	return nil
+}
+
+func store(file *os.File, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+
+	return err
+}
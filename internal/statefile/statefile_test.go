@@ -0,0 +1,62 @@
+package statefile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-statefile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "nested", "state.json")
+
+	for i := 1; i <= 2; i++ {
+		counters := map[string]int{}
+		err := Update(filename, &counters, func() error {
+			counters["runs"]++
+			return nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, map[string]int{"runs": i}, counters)
+	}
+
+	info, err := os.Stat(filename)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	counters := map[string]int{}
+	require.NoError(t, Read(filename, &counters))
+	require.Equal(t, map[string]int{"runs": 2}, counters)
+}
+
+func TestUpdateWithCorruptedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitlab-shell-statefile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "state.json")
+	require.NoError(t, ioutil.WriteFile(filename, []byte("{broken"), 0600))
+
+	counters := map[string]int{}
+	err = Update(filename, &counters, func() error {
+		counters["runs"]++
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"runs": 1}, counters)
+}
+
+func TestReadMissingFile(t *testing.T) {
+	counters := map[string]int{}
+
+	require.NoError(t, Read("/non-existent/state.json", &counters))
+	require.Empty(t, counters)
+}